@@ -2,20 +2,45 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/events"
+	"github.com/rovilay/auth-service/grpcserver"
+	"github.com/rovilay/auth-service/handlers"
+	"github.com/rovilay/auth-service/health"
+	"github.com/rovilay/auth-service/mailer"
 	"github.com/rovilay/auth-service/repository"
+	"github.com/rovilay/auth-service/webhooks"
 	"github.com/rs/zerolog"
 )
 
+// healthCheckTimeout bounds the readiness checks so that a hanging
+// dependency fails the probe instead of timing it out.
+const healthCheckTimeout = time.Second * 2
+
+var errMissingSigningKey = errors.New("JWT signing key is not configured")
+
 type App struct {
 	router http.Handler
+	routes chi.Routes
 	config *config.AppConfig
 	log    *zerolog.Logger
 	repo   repository.UserRepository
+	mailer mailer.Mailer
+	health *health.Registry
+	// dispatcher is nil when no event sinks are configured, events then stay
+	// in the outbox.
+	dispatcher    *events.Dispatcher
+	webhookWorker *webhooks.Worker
+	// grpc is nil when GRPC_PORT is 0.
+	grpc *grpcserver.Server
 }
 
 func NewApp(repo repository.UserRepository, c *config.AppConfig, log *zerolog.Logger) *App {
@@ -25,38 +50,150 @@ func NewApp(repo repository.UserRepository, c *config.AppConfig, log *zerolog.Lo
 		log:    &logger,
 		config: c,
 		repo:   repo,
+		mailer: mailer.NewLogMailer(&logger),
+		health: health.NewRegistry(healthCheckTimeout, &logger),
+	}
+
+	if db, ok := repo.(repository.HealthChecker); ok {
+		app.health.Register("database", db.Ping)
+	}
+	app.health.Register("signing_key", func(context.Context) error {
+		if c.JwtSecret == "" {
+			return errMissingSigningKey
+		}
+		return nil
+	})
+
+	sinks, err := events.NewSinks(c.EventSinks)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("[ERROR] failed to create event sinks")
+	}
+
+	if webhookRepo, ok := repo.(repository.WebhookRepository); ok {
+		sinks = append(sinks, webhooks.NewSink(webhookRepo))
+		app.webhookWorker = webhooks.NewWorker(webhookRepo, c.EventDispatchInterval, c.WebhookTimeout, c.WebhookMaxAttempts, &logger)
+	}
+
+	if outbox, ok := repo.(repository.OutboxRepository); ok && len(sinks) > 0 {
+		app.dispatcher = events.NewDispatcher(outbox, sinks, c.EventDispatchInterval, &logger)
 	}
 
 	app.loadRoutes()
 
+	if c.GRPCPort != 0 {
+		users := handlers.NewUserHandler(repo, c, &logger)
+		app.grpc = grpcserver.New(users, app.health, &logger)
+	}
+
 	return app
 }
 
+// Health returns the registry of readiness checks served at /readyz.
+func (a *App) Health() *health.Registry {
+	return a.health
+}
+
+// Routes returns the registered routes, e.g. to compare them with the
+// OpenAPI spec.
+func (a *App) Routes() chi.Routes {
+	return a.routes
+}
+
 func (a *App) Start(ctx context.Context) error {
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", a.config.ServerPort),
 		Handler: a.router,
 	}
 
-	a.log.Println("starting server on port: ", a.config.ServerPort)
+	// listen on both ports before starting anything, so that a port that is
+	// taken doesn't leave the other server or the workers running
+	lis, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on server port: %w", err)
+	}
+
+	var grpcLis net.Listener
+	if a.grpc != nil {
+		grpcLis, err = net.Listen("tcp", fmt.Sprintf(":%d", a.config.GRPCPort))
+		if err != nil {
+			lis.Close()
+			return fmt.Errorf("failed to listen on gRPC port: %w", err)
+		}
+	}
 
-	ch := make(chan error, 1)
+	if a.dispatcher != nil {
+		go a.dispatcher.Run(ctx)
+	}
+	if a.webhookWorker != nil {
+		go a.webhookWorker.Run(ctx)
+	}
+
+	ch := make(chan error, 2)
+
+	a.log.Println("starting server on port: ", a.config.ServerPort)
 
 	go func() {
-		if err := server.ListenAndServe(); err != nil {
+		if err := server.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			ch <- fmt.Errorf("failed to start server: %w", err)
 		}
-		close(ch)
 	}()
 
+	if a.grpc != nil {
+		a.log.Println("starting gRPC server on port: ", a.config.GRPCPort)
+
+		go func() {
+			if err := a.grpc.Serve(grpcLis); err != nil {
+				ch <- fmt.Errorf("failed to start gRPC server: %w", err)
+			}
+		}()
+	}
+
 	select {
 	case err := <-ch:
-		return err
+		// don't leave the other server running on its own
+		timeout, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		return errors.Join(err, a.shutdown(timeout, server))
 	case <-ctx.Done():
+		// fail readiness first and keep serving while load balancers drain
+		// traffic away from this instance
+		a.health.SetShuttingDown()
+		if a.grpc != nil {
+			a.grpc.Drain()
+		}
+		a.log.Info().Dur("delay", a.config.ShutdownDelay).Msg("draining before shutdown")
+		time.Sleep(a.config.ShutdownDelay)
+
 		// wait 10 seconds before server shutdown
 		timeout, cancel := context.WithTimeout(context.Background(), time.Second*10)
 		defer cancel()
 
-		return server.Shutdown(timeout)
+		return a.shutdown(timeout, server)
 	}
 }
+
+// shutdown stops the HTTP and gRPC servers concurrently, waiting for pending
+// requests until ctx is done.
+func (a *App) shutdown(ctx context.Context, server *http.Server) error {
+	var wg sync.WaitGroup
+	var httpErr, grpcErr error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		httpErr = server.Shutdown(ctx)
+	}()
+
+	if a.grpc != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			grpcErr = a.grpc.Shutdown(ctx)
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(httpErr, grpcErr)
+}
@@ -0,0 +1,18 @@
+// Package apptest provides helpers for checking the routes of the app.
+package apptest
+
+import "github.com/rovilay/auth-service/repository"
+
+// FeatureRepository implements every optional repository interface so that
+// the app registers the routes of all features, whatever the configured
+// database supports. Its methods are never called.
+type FeatureRepository struct {
+	repository.UserRepository
+	repository.HealthChecker
+	repository.OutboxRepository
+	repository.WebhookRepository
+	repository.OrganizationRepository
+	repository.TokenRepository
+	repository.ServiceAccountRepository
+	repository.SessionRepository
+}
@@ -4,17 +4,75 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rovilay/auth-service/handlers"
+	"github.com/rovilay/auth-service/logging"
+	"github.com/rovilay/auth-service/metrics"
+	"github.com/rovilay/auth-service/openapi"
+	"github.com/rovilay/auth-service/tracing"
 	"github.com/rs/cors"
 )
 
+// DocsPath serves the Swagger UI when SWAGGER_UI is enabled. It isn't part
+// of the API and therefore not documented in the OpenAPI spec.
+const DocsPath = "/docs"
+
+// apiVersion is a version of the API mounted under its prefix. Each version
+// registers its own handlers, so that a new version can change request and
+// response shapes without affecting clients of the older ones.
+type apiVersion struct {
+	prefix string
+	load   func(router chi.Router)
+}
+
+// apiVersions returns the mounted versions of the API, oldest first.
+func (a *App) apiVersions() []apiVersion {
+	return []apiVersion{
+		{prefix: "/v1", load: a.loadV1Routes},
+	}
+}
+
+// legacyDeprecatedAt is when the unversioned routes were deprecated in favour
+// of /v1.
+var legacyDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
 func (a *App) loadRoutes() {
 	router := chi.NewRouter()
 
-	router.Use(middleware.Logger)
+	router.Use(tracing.Middleware)
+	router.Use(logging.Middleware(a.log))
+	router.NotFound(handlers.NotFound)
+	router.MethodNotAllowed(handlers.MethodNotAllowed)
+	router.Use(metrics.Middleware)
+
+	var validator *openapi.Validator
+	if a.config.OpenAPIValidation {
+		v, err := openapi.NewValidator()
+		if err != nil {
+			a.log.Fatal().Err(err).Msg("[ERROR] failed to load OpenAPI validator")
+		}
+		validator = v
+	}
+
+	router.Get("/healthz", a.health.Liveness)
+	router.Get("/readyz", a.health.Readiness)
+	router.Get("/metrics", metrics.Handler().ServeHTTP)
+	router.Get("/openapi.json", openapi.Handler)
+	if a.config.SwaggerUI {
+		router.Get(DocsPath, openapi.SwaggerUI)
+	}
+
+	// proxies are configured with a fixed URL, so forward auth isn't
+	// versioned
+	router.Get("/auth/verify", handlers.NewUserHandler(a.repo, a.config, a.log).VerifyForwardAuth)
+
+	// the kube-apiserver webhook config points to a fixed URL as well, it
+	// authenticates with K8S_WEBHOOK_TOKEN
+	if a.config.K8sWebhookToken != "" {
+		router.Post("/k8s/tokenreview", handlers.NewUserHandler(a.repo, a.config, a.log).TokenReview)
+	}
 
 	router.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		var res struct {
@@ -34,24 +92,64 @@ func (a *App) loadRoutes() {
 		w.Write(msg)
 	})
 
-	a.loadUserRoutes(router)
+	versions := a.apiVersions()
+	for _, version := range versions {
+		router.Route(version.prefix, func(r chi.Router) {
+			// a group's middlewares run after routing, so that requests
+			// rejected by the validator are labeled with their route
+			r.Group(func(r chi.Router) {
+				if validator != nil {
+					r.Use(validator.Middleware(""))
+				}
+				version.load(r)
+			})
+		})
+	}
+
+	// the unversioned routes are aliases of v1 kept for existing clients
+	if a.config.LegacyRoutes {
+		legacy := versions[0]
+		router.Group(func(r chi.Router) {
+			r.Use(deprecated(legacy.prefix, a.config.LegacyRoutesSunset))
+			if validator != nil {
+				r.Use(validator.Middleware(legacy.prefix))
+			}
+			legacy.load(r)
+		})
+	}
 
-	// CORS configuration
+	// CORS configuration, browsers only send the session cookie to the
+	// allowed origins
 	corsRouter := cors.Default().Handler(router)
+	if len(a.config.CORSAllowedOrigins) > 0 {
+		corsRouter = cors.New(cors.Options{
+			AllowedOrigins:   a.config.CORSAllowedOrigins,
+			AllowedMethods:   []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+			AllowedHeaders:   []string{"Authorization", "Content-Type", "If-Match", handlers.HeaderCSRFToken, logging.HeaderRequestID},
+			ExposedHeaders:   []string{"ETag", logging.HeaderRequestID},
+			AllowCredentials: true,
+		}).Handler(router)
+	}
 
+	a.routes = router
 	a.router = corsRouter
 }
 
-func (a *App) loadUserRoutes(router chi.Router) {
-	h := handlers.NewUserHandler(a.repo, a.log)
+// deprecated marks responses of the unversioned routes as deprecated, see
+// RFC 9745 and RFC 8594, and links to the route under prefix. No Sunset
+// header is sent when sunset is zero.
+func deprecated(prefix string, sunset time.Time) func(http.Handler) http.Handler {
+	deprecation := fmt.Sprintf("@%d", legacyDeprecatedAt.Unix())
 
-	router.Post("/signup", h.Signup)
-	router.Post("/login", h.Login)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecation)
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, prefix+r.URL.Path))
 
-	router.Group(func(r chi.Router) {
-		r.Use(h.MiddlewareAuth)
-		r.Get("/users/{id}", h.GetUser)
-		r.Put("/users/{id}", h.UpdateUser)
-		r.Put("/users/{id}/password", h.UpdatePassword)
-	})
+			next.ServeHTTP(w, r)
+		})
+	}
 }
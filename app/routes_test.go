@@ -0,0 +1,27 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/rovilay/auth-service/app/apptest"
+	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/openapi"
+	"github.com/rs/zerolog"
+)
+
+func TestRoutesMatchOpenAPISpec(t *testing.T) {
+	logger := zerolog.Nop()
+	// the deprecated unversioned aliases aren't documented, the optional
+	// features are
+	c := &config.AppConfig{JwtSecret: "secret", Sessions: true, K8sWebhookToken: "secret"}
+
+	a := NewApp(apptest.FeatureRepository{}, c, &logger)
+
+	drift, err := openapi.Drift(a.Routes(), DocsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range drift {
+		t.Error(d)
+	}
+}
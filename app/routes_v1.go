@@ -0,0 +1,134 @@
+package app
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/rovilay/auth-service/handlers"
+	"github.com/rovilay/auth-service/repository"
+)
+
+// loadV1Routes registers version 1 of the API.
+func (a *App) loadV1Routes(router chi.Router) {
+	h := handlers.NewUserHandler(a.repo, a.config, a.log)
+	a.loadUserRoutes(router, h)
+	a.loadAdminRoutes(router, h)
+
+	var oh *handlers.OrganizationHandler
+	if orgRepo, ok := a.repo.(repository.OrganizationRepository); ok {
+		oh = handlers.NewOrganizationHandler(orgRepo, a.repo, a.mailer, a.config, a.log)
+		a.loadOrganizationRoutes(router, h, oh)
+	}
+
+	if saRepo, ok := a.repo.(repository.ServiceAccountRepository); ok {
+		a.loadServiceAccountRoutes(router, h, oh, saRepo)
+	}
+}
+
+func (a *App) loadUserRoutes(router chi.Router, h *handlers.UserHandler) {
+	router.Post("/signup", h.Signup)
+	router.Post("/login", h.Login)
+
+	// sessions authenticate themselves with the cookie, the other routes
+	// accept it in place of a bearer token
+	if _, ok := a.repo.(repository.SessionRepository); ok && a.config.Sessions {
+		router.Post("/sessions", h.CreateSession)
+		router.Get("/sessions/current", h.GetSession)
+		router.Delete("/sessions/current", h.DeleteSession)
+	}
+
+	router.Group(func(r chi.Router) {
+		r.Use(h.MiddlewareAuth)
+		r.Get("/users/{id}", h.GetUser)
+		r.Put("/users/{id}", h.UpdateUser)
+		r.Patch("/users/{id}", h.PatchUser)
+		r.Delete("/users/{id}", h.DeleteUser)
+		r.Put("/users/{id}/password", h.UpdatePassword)
+
+		if _, ok := a.repo.(repository.TokenRepository); ok {
+			r.Get("/users/{id}/tokens", h.ListAccessTokens)
+			r.Post("/users/{id}/tokens", h.CreateAccessToken)
+			r.Delete("/users/{id}/tokens/{tokenID}", h.RevokeAccessToken)
+		}
+	})
+}
+
+// loadAdminRoutes registers the routes reserved for the users listed in
+// ADMIN_USER_IDS.
+func (a *App) loadAdminRoutes(router chi.Router, h *handlers.UserHandler) {
+	router.Group(func(r chi.Router) {
+		r.Use(h.MiddlewareAuthenticate)
+		r.Use(h.MiddlewareAdmin)
+		r.Patch("/admin/users/{id}/metadata", h.UpdateAdminMetadata)
+
+		if webhookRepo, ok := a.repo.(repository.WebhookRepository); ok {
+			wh := handlers.NewWebhookHandler(webhookRepo, a.config, a.log)
+			r.Route("/admin/webhooks", func(r chi.Router) {
+				r.Get("/", wh.ListWebhooks)
+				r.Post("/", wh.CreateWebhook)
+				r.Get("/{webhookID}", wh.GetWebhook)
+				r.Delete("/{webhookID}", wh.DeleteWebhook)
+				r.Get("/{webhookID}/deliveries", wh.ListWebhookDeliveries)
+				r.Post("/{webhookID}/deliveries/{deliveryID}/redeliver", wh.RedeliverWebhookDelivery)
+			})
+		}
+	})
+}
+
+func (a *App) loadOrganizationRoutes(router chi.Router, uh *handlers.UserHandler, h *handlers.OrganizationHandler) {
+	router.Group(func(r chi.Router) {
+		r.Use(uh.MiddlewareAuthenticate)
+		r.Post("/organizations", h.CreateOrganization)
+		r.Post("/invitations/accept", h.AcceptInvitation)
+
+		r.Route("/organizations/{orgID}/invitations", func(r chi.Router) {
+			r.Use(h.MiddlewareOrgAdmin)
+			r.Get("/", h.ListInvitations)
+			r.Post("/", h.CreateInvitation)
+			r.Post("/{invitationID}/resend", h.ResendInvitation)
+			r.Delete("/{invitationID}", h.RevokeInvitation)
+		})
+	})
+}
+
+// loadServiceAccountRoutes registers service accounts owned by users and, when
+// organizations are supported, by organizations.
+func (a *App) loadServiceAccountRoutes(
+	router chi.Router,
+	uh *handlers.UserHandler,
+	oh *handlers.OrganizationHandler,
+	repo repository.ServiceAccountRepository,
+) {
+	h := handlers.NewServiceAccountHandler(repo, a.config, a.log)
+
+	router.Post("/oauth/token", h.Token)
+
+	accountRoutes := func(r chi.Router) {
+		r.Get("/", h.ListServiceAccounts)
+		r.Post("/", h.CreateServiceAccount)
+
+		r.Route("/{accountID}", func(r chi.Router) {
+			r.Use(h.MiddlewareServiceAccountOwner)
+			r.Get("/", h.GetServiceAccount)
+			r.Delete("/", h.DeleteServiceAccount)
+			r.Post("/secret", h.RotateServiceAccountSecret)
+
+			if _, ok := repo.(repository.TokenRepository); ok {
+				r.Get("/tokens", h.ListAccessTokens)
+				r.Post("/tokens", h.CreateAccessToken)
+				r.Delete("/tokens/{tokenID}", h.RevokeAccessToken)
+			}
+		})
+	}
+
+	router.Group(func(r chi.Router) {
+		r.Use(uh.MiddlewareAuth)
+		r.Route("/users/{id}/service-accounts", accountRoutes)
+	})
+
+	if oh != nil {
+		router.Group(func(r chi.Router) {
+			r.Use(uh.MiddlewareAuthenticate)
+			r.Use(oh.MiddlewareOrgAdmin)
+			r.Route("/organizations/{orgID}/service-accounts", accountRoutes)
+		})
+	}
+}
@@ -0,0 +1,327 @@
+// Package client is a Go client of the auth-service HTTP API. It
+// authenticates with the credentials it is given, refreshes the token before
+// it expires, retries idempotent requests on transient failures and returns
+// error responses as *Error, which matches the errors of this package with
+// errors.Is.
+//
+// To validate tokens of the service without calling it, use the verifier
+// package.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rovilay/auth-service/models"
+)
+
+const (
+	// DefaultMaxRetries is the number of times an idempotent request is
+	// retried by default.
+	DefaultMaxRetries = 3
+	// firstRetryDelay doubles with every retry up to maxRetryDelay.
+	firstRetryDelay = 200 * time.Millisecond
+	maxRetryDelay   = 5 * time.Second
+	// refreshBefore is how long before it expires a token is replaced.
+	refreshBefore = time.Minute
+)
+
+// Client calls version 1 of the API. It is safe for concurrent use.
+type Client struct {
+	// HTTPClient sends the requests, http.DefaultClient when nil.
+	HTTPClient *http.Client
+	// MaxRetries is how often an idempotent request (GET, PUT, DELETE) is
+	// retried after a network error or a 429, 502, 503 or 504 response.
+	// Retries back off exponentially and honor Retry-After. 0 disables them.
+	MaxRetries int
+
+	baseURL     string
+	credentials Credentials
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// New returns a client of the service at baseURL, e.g.
+// https://auth.example.com. credentials authenticate the requests that need
+// a token, they may be nil when only public endpoints are called.
+func New(baseURL string, credentials Credentials) *Client {
+	return &Client{
+		MaxRetries:  DefaultMaxRetries,
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		credentials: credentials,
+	}
+}
+
+// Credentials obtain a token for the client.
+type Credentials interface {
+	token(ctx context.Context, c *Client) (string, error)
+}
+
+type staticToken string
+
+func (t staticToken) token(context.Context, *Client) (string, error) {
+	return string(t), nil
+}
+
+// Token authenticates with a fixed token, e.g. a personal access token. It
+// can't be refreshed.
+func Token(token string) Credentials {
+	return staticToken(token)
+}
+
+type password struct {
+	email, password string
+}
+
+func (p password) token(ctx context.Context, c *Client) (string, error) {
+	return c.Login(ctx, models.LoginInput{Email: p.email, Password: p.password})
+}
+
+// Password authenticates as a user. The client logs in again when the token
+// is about to expire.
+func Password(email, pass string) Credentials {
+	return password{email: email, password: pass}
+}
+
+type clientCredentials struct {
+	id, secret string
+}
+
+func (cc clientCredentials) token(ctx context.Context, c *Client) (string, error) {
+	res, err := c.ClientCredentialsToken(ctx, cc.id, cc.secret)
+	if err != nil {
+		return "", err
+	}
+	return res.AccessToken, nil
+}
+
+// ClientCredentials authenticates as a service account with the OAuth 2.0
+// client credentials grant. A new token is requested when the current one is
+// about to expire.
+func ClientCredentials(clientID, clientSecret string) Credentials {
+	return clientCredentials{id: clientID, secret: clientSecret}
+}
+
+// accessToken returns the current token, obtaining a new one when there is
+// none, it is about to expire or refresh is set.
+func (c *Client) accessToken(ctx context.Context, refresh bool) (string, error) {
+	if c.credentials == nil {
+		return "", ErrMissingAuthToken
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// tokens without a known expiry are used until they are rejected
+	valid := c.token != "" && (c.expiry.IsZero() || time.Until(c.expiry) > refreshBefore)
+	if valid && !refresh {
+		return c.token, nil
+	}
+
+	token, err := c.credentials.token(ctx, c)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain token: %w", err)
+	}
+
+	c.token, c.expiry = token, expiry(token)
+	return token, nil
+}
+
+// expiry reads the exp claim of a JWT without verifying it, the zero time
+// when token isn't a JWT or has no expiry.
+func expiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// request describes a call of the API.
+type request struct {
+	method string
+	path   string
+	// body is sent as JSON, form as application/x-www-form-urlencoded.
+	body        any
+	form        url.Values
+	contentType string
+	ifMatch     string
+	auth        bool
+}
+
+// do sends req and decodes the response into out, which may be nil. It
+// returns the headers of the response.
+func (c *Client) do(ctx context.Context, req request, out any) (http.Header, error) {
+	var body []byte
+	contentType := req.contentType
+	switch {
+	case req.form != nil:
+		body = []byte(req.form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	case req.body != nil:
+		b, err := json.Marshal(req.body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = b
+		if contentType == "" {
+			contentType = "application/json"
+		}
+	}
+
+	var token string
+	if req.auth {
+		t, err := c.accessToken(ctx, false)
+		if err != nil {
+			return nil, err
+		}
+		token = t
+	}
+
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		res, err := c.send(ctx, req, body, contentType, token)
+		if err == nil && res.StatusCode < http.StatusBadRequest {
+			defer res.Body.Close()
+			if out != nil && res.StatusCode != http.StatusNoContent {
+				if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+					return nil, fmt.Errorf("failed to decode response: %w", err)
+				}
+			}
+			return res.Header, nil
+		}
+
+		var wait time.Duration
+		if err == nil {
+			wait = retryAfter(res)
+			err = decodeError(res)
+			res.Body.Close()
+		}
+
+		// a rejected token didn't change anything, the request can be sent
+		// again with a new one whatever its method
+		if req.auth && !refreshed && (errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrInvalidAccessToken)) {
+			refreshed = true
+			t, refreshErr := c.accessToken(ctx, true)
+			if refreshErr != nil || t == token {
+				return nil, err
+			}
+			token = t
+			attempt--
+			continue
+		}
+
+		if attempt >= c.MaxRetries || !idempotent(req.method) || !temporary(err) {
+			return nil, err
+		}
+
+		if wait == 0 {
+			wait = retryDelay(attempt)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req request, body []byte, contentType, token string) (*http.Response, error) {
+	r, err := http.NewRequestWithContext(ctx, req.method, c.baseURL+req.path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	if req.ifMatch != "" {
+		r.Header.Set("If-Match", req.ifMatch)
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(r)
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// temporary reports whether err may not happen again, i.e. it is a network
+// error or a response that asks to retry.
+func temporary(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Temporary()
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// retryDelay is the backoff before retry attempt+1, with jitter so that
+// clients don't retry in lockstep.
+func retryDelay(attempt int) time.Duration {
+	delay := maxRetryDelay
+	if attempt < 8 {
+		delay = min(firstRetryDelay<<attempt, maxRetryDelay)
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+}
+
+// retryAfter is the delay the Retry-After header asks for, capped at
+// maxRetryDelay. Only delays in seconds are supported.
+func retryAfter(res *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return min(time.Duration(seconds)*time.Second, maxRetryDelay)
+}
+
+// pathf builds a path from format and escaped path segments.
+func pathf(format string, segments ...string) string {
+	args := make([]any, len(segments))
+	for i, segment := range segments {
+		args[i] = url.PathEscape(segment)
+	}
+	return fmt.Sprintf(format, args...)
+}
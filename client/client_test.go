@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/problem"
+)
+
+const userID = "c55c6cde-bcef-4abd-8fae-c5818bd14e30"
+
+// server counts the requests of every route and answers them with handle.
+type server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func newServer(t *testing.T, handle func(w http.ResponseWriter, r *http.Request, n int)) *server {
+	s := &server{requests: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		route := r.Method + " " + r.URL.Path
+		s.requests[route]++
+		n := s.requests[route]
+		s.mu.Unlock()
+
+		handle(w, r, n)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *server) count(route string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[route]
+}
+
+func writeProblem(w http.ResponseWriter, status int, code problem.Code) {
+	w.Header().Set("Content-Type", problem.ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"status": status, "code": code})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestRefreshesRejectedToken(t *testing.T) {
+	tokens := []string{"first", "second"}
+	s := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		switch r.URL.Path {
+		case "/v1/login":
+			writeJSON(w, map[string]string{"token": tokens[min(n, len(tokens))-1]})
+		case "/v1/users/" + userID:
+			if r.Header.Get("Authorization") != "Bearer second" {
+				writeProblem(w, http.StatusUnauthorized, problem.CodeInvalidToken)
+				return
+			}
+			writeJSON(w, map[string]string{"id": userID})
+		}
+	})
+
+	c := New(s.URL, Password("jane@example.com", "secret12"))
+
+	user, err := c.GetUser(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID.String() != userID {
+		t.Errorf("got user %s, want %s", user.ID, userID)
+	}
+	if n := s.count("POST /v1/login"); n != 2 {
+		t.Errorf("logged in %d times, want 2", n)
+	}
+	if n := s.count("GET /v1/users/" + userID); n != 2 {
+		t.Errorf("sent %d requests, want 2", n)
+	}
+}
+
+func TestRefreshesRejectedTokenOnce(t *testing.T) {
+	s := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		switch r.URL.Path {
+		case "/v1/login":
+			writeJSON(w, map[string]string{"token": "token"})
+		default:
+			writeProblem(w, http.StatusUnauthorized, problem.CodeInvalidToken)
+		}
+	})
+
+	c := New(s.URL, Password("jane@example.com", "secret12"))
+
+	_, err := c.GetUser(context.Background(), userID)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("got %v, want ErrInvalidToken", err)
+	}
+	if n := s.count("POST /v1/login"); n != 2 {
+		t.Errorf("logged in %d times, want 2", n)
+	}
+	// the new token is the rejected one, sending it again is pointless
+	if n := s.count("GET /v1/users/" + userID); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
+
+func TestRetriesIdempotentRequests(t *testing.T) {
+	s := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		if n < 3 {
+			writeProblem(w, http.StatusServiceUnavailable, problem.CodeInternal)
+			return
+		}
+		writeJSON(w, map[string]string{"id": userID})
+	})
+
+	c := New(s.URL, Token("ast_token"))
+
+	if _, err := c.GetUser(context.Background(), userID); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.count("GET /v1/users/" + userID); n != 3 {
+		t.Errorf("sent %d requests, want 3", n)
+	}
+}
+
+func TestStopsRetryingAfterMaxRetries(t *testing.T) {
+	s := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		writeProblem(w, http.StatusServiceUnavailable, problem.CodeInternal)
+	})
+
+	c := New(s.URL, Token("ast_token"))
+	c.MaxRetries = 1
+
+	_, err := c.GetUser(context.Background(), userID)
+	var e *Error
+	if !errors.As(err, &e) || e.Status != http.StatusServiceUnavailable {
+		t.Fatalf("got %v, want a 503 *Error", err)
+	}
+	if n := s.count("GET /v1/users/" + userID); n != 2 {
+		t.Errorf("sent %d requests, want 2", n)
+	}
+}
+
+func TestDoesNotRetryPost(t *testing.T) {
+	s := newServer(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		writeProblem(w, http.StatusServiceUnavailable, problem.CodeInternal)
+	})
+
+	c := New(s.URL, Token("ast_token"))
+
+	_, err := c.CreateWebhook(context.Background(), models.CreateWebhookInput{})
+	var e *Error
+	if !errors.As(err, &e) || e.Status != http.StatusServiceUnavailable {
+		t.Fatalf("got %v, want a 503 *Error", err)
+	}
+	if n := s.count("POST /v1/admin/webhooks"); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
+
+func TestEveryProblemCodeHasAnError(t *testing.T) {
+	for _, code := range problem.Codes() {
+		if codes[string(code)] == nil {
+			t.Errorf("problem code %s has no error", code)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// The errors mirror the utils errors of the service. Match them with
+// errors.Is, use errors.As with *Error for the details of the response.
+var (
+	ErrBadRequest               = errors.New("invalid request")
+	ErrMalformedBody            = errors.New("malformed request body")
+	ErrValidationFailed         = errors.New("request contains invalid fields")
+	ErrDuplicateEntry           = errors.New("duplicate user entry")
+	ErrForeignKeyViolation      = errors.New("foreign key violation (invalid user reference?)")
+	ErrDuplicateInvitation      = errors.New("a pending invitation already exists for this email")
+	ErrInvalidInvitation        = errors.New("invitation is invalid or has expired")
+	ErrUnsupportedGrantType     = errors.New("unsupported grant type")
+	ErrInvalidMetadata          = errors.New("invalid metadata")
+	ErrInvalidEventFilter       = errors.New("invalid event filter")
+	ErrInvalidCursor            = errors.New("invalid pagination cursor")
+	ErrInvalidPassword          = errors.New("invalid password")
+	ErrNotFound                 = errors.New("user not found")
+	ErrOrganizationNotFound     = errors.New("organization not found")
+	ErrInvitationNotFound       = errors.New("invitation not found")
+	ErrAccessTokenNotFound      = errors.New("access token not found")
+	ErrServiceAccountNotFound   = errors.New("service account not found")
+	ErrWebhookNotFound          = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound  = errors.New("webhook delivery not found")
+	ErrRouteNotFound            = errors.New("route not found")
+	ErrMethodNotAllowed         = errors.New("method not allowed")
+	ErrForbidden                = errors.New("insufficient permissions")
+	ErrInvitationRequired       = errors.New("signup requires a valid invitation")
+	ErrInsufficientScope        = errors.New("access token lacks the required scope")
+	ErrMissingAuthToken         = errors.New("missing authorization token")
+	ErrInvalidAccessToken       = errors.New("access token is invalid, expired or revoked")
+	ErrInvalidSession           = errors.New("session is invalid or expired")
+	ErrInvalidCSRFToken         = errors.New("missing or invalid CSRF token")
+	ErrInvalidToken             = errors.New("token is invalid or expired")
+	ErrUserUnAuthorized         = errors.New("user is Unauthorized")
+	ErrInvalidCredentials       = errors.New("invalid email or password")
+	ErrInvalidClientCredentials = errors.New("invalid client credentials")
+	ErrPreconditionFailed       = errors.New("resource does not match If-Match precondition")
+	ErrConflict                 = errors.New("request conflicts with the current state of the resource")
+	ErrVersionConflict          = errors.New("user was modified concurrently")
+	ErrUnsupportedMediaType     = errors.New("unsupported media type")
+	ErrSomethingWentWrong       = errors.New("something went wrong")
+)
+
+// codes maps the problem codes of the service to the errors.
+var codes = map[string]error{
+	"bad_request":                ErrBadRequest,
+	"malformed_body":             ErrMalformedBody,
+	"validation_failed":          ErrValidationFailed,
+	"duplicate_entry":            ErrDuplicateEntry,
+	"invalid_reference":          ErrForeignKeyViolation,
+	"duplicate_invitation":       ErrDuplicateInvitation,
+	"invalid_invitation":         ErrInvalidInvitation,
+	"unsupported_grant_type":     ErrUnsupportedGrantType,
+	"invalid_metadata":           ErrInvalidMetadata,
+	"invalid_event_filter":       ErrInvalidEventFilter,
+	"invalid_cursor":             ErrInvalidCursor,
+	"invalid_password":           ErrInvalidPassword,
+	"user_not_found":             ErrNotFound,
+	"organization_not_found":     ErrOrganizationNotFound,
+	"invitation_not_found":       ErrInvitationNotFound,
+	"access_token_not_found":     ErrAccessTokenNotFound,
+	"service_account_not_found":  ErrServiceAccountNotFound,
+	"webhook_not_found":          ErrWebhookNotFound,
+	"webhook_delivery_not_found": ErrWebhookDeliveryNotFound,
+	"not_found":                  ErrRouteNotFound,
+	"method_not_allowed":         ErrMethodNotAllowed,
+	"forbidden":                  ErrForbidden,
+	"invitation_required":        ErrInvitationRequired,
+	"insufficient_scope":         ErrInsufficientScope,
+	"missing_token":              ErrMissingAuthToken,
+	"invalid_access_token":       ErrInvalidAccessToken,
+	"invalid_session":            ErrInvalidSession,
+	"invalid_csrf_token":         ErrInvalidCSRFToken,
+	"invalid_token":              ErrInvalidToken,
+	"unauthorized":               ErrUserUnAuthorized,
+	"invalid_credentials":        ErrInvalidCredentials,
+	"invalid_client_credentials": ErrInvalidClientCredentials,
+	"precondition_failed":        ErrPreconditionFailed,
+	"conflict":                   ErrConflict,
+	"version_conflict":           ErrVersionConflict,
+	"unsupported_media_type":     ErrUnsupportedMediaType,
+	"internal_error":             ErrSomethingWentWrong,
+}
+
+// Error is an error response of the service, decoded from its
+// application/problem+json body. Responses without a problem body, e.g. from
+// a proxy, only have Status and Title set.
+type Error struct {
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Title     string       `json:"title"`
+	Detail    string       `json:"detail"`
+	Instance  string       `json:"instance"`
+	RequestID string       `json:"request_id"`
+	Errors    []FieldError `json:"errors"`
+}
+
+// FieldError describes why a single request field failed validation. Code is
+// the failed validation rule, e.g. required or min.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	reason := e.Code
+	if reason == "" {
+		reason = e.Title
+	}
+
+	msg := fmt.Sprintf("auth-service: %d %s", e.Status, reason)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Unwrap returns the error of the problem code, nil for unknown codes.
+func (e *Error) Unwrap() error {
+	return codes[e.Code]
+}
+
+// Temporary reports whether the request may succeed when it is sent again.
+func (e *Error) Temporary() bool {
+	switch e.Status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func decodeError(res *http.Response) error {
+	e := &Error{}
+	// the body is only trusted when it is a problem, anything else is
+	// reported by its status
+	if strings.HasPrefix(res.Header.Get("Content-Type"), "application/problem+json") {
+		json.NewDecoder(res.Body).Decode(e)
+	}
+
+	e.Status = res.StatusCode
+	if e.Title == "" {
+		e.Title = http.StatusText(res.StatusCode)
+	}
+	return e
+}
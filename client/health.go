@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rovilay/auth-service/health"
+)
+
+// Liveness reports whether the service process is alive.
+func (c *Client) Liveness(ctx context.Context) (*health.Report, error) {
+	return c.probe(ctx, "/healthz")
+}
+
+// Readiness runs the readiness checks of the service. A service that isn't
+// ready returns a report with status unavailable, not an error. Probes are
+// never retried.
+func (c *Client) Readiness(ctx context.Context) (*health.Report, error) {
+	return c.probe(ctx, "/readyz")
+}
+
+func (c *Client) probe(ctx context.Context, path string) (*health.Report, error) {
+	res, err := c.send(ctx, request{method: http.MethodGet, path: path}, nil, "", "")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusServiceUnavailable {
+		return nil, decodeError(res)
+	}
+
+	var report health.Report
+	if err := json.NewDecoder(res.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &report, nil
+}
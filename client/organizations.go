@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rovilay/auth-service/models"
+)
+
+// CreateOrganization creates an organization owned by the authenticated user.
+func (c *Client) CreateOrganization(ctx context.Context, input models.CreateOrganizationInput) (*models.Organization, error) {
+	var org models.Organization
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/v1/organizations", body: input, auth: true}, &org)
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// AcceptInvitation adds the authenticated user to the organization of the
+// invitation token.
+func (c *Client) AcceptInvitation(ctx context.Context, token string) (*models.Membership, error) {
+	var membership models.Membership
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/v1/invitations/accept",
+		body:   models.AcceptInvitationInput{Token: token},
+		auth:   true,
+	}, &membership)
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+func (c *Client) ListInvitations(ctx context.Context, orgID string) ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	_, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   pathf("/v1/organizations/%s/invitations", orgID),
+		auth:   true,
+	}, &invitations)
+	return invitations, err
+}
+
+func (c *Client) CreateInvitation(ctx context.Context, orgID string, input models.CreateInvitationInput) (*models.Invitation, error) {
+	return c.invitation(ctx, request{
+		method: http.MethodPost,
+		path:   pathf("/v1/organizations/%s/invitations", orgID),
+		body:   input,
+		auth:   true,
+	})
+}
+
+// ResendInvitation sends the invitation email again with a new token.
+func (c *Client) ResendInvitation(ctx context.Context, orgID, invitationID string) (*models.Invitation, error) {
+	return c.invitation(ctx, request{
+		method: http.MethodPost,
+		path:   pathf("/v1/organizations/%s/invitations/%s/resend", orgID, invitationID),
+		auth:   true,
+	})
+}
+
+func (c *Client) RevokeInvitation(ctx context.Context, orgID, invitationID string) error {
+	_, err := c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   pathf("/v1/organizations/%s/invitations/%s", orgID, invitationID),
+		auth:   true,
+	}, nil)
+	return err
+}
+
+func (c *Client) invitation(ctx context.Context, req request) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if _, err := c.do(ctx, req, &invitation); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/rovilay/auth-service/models"
+)
+
+// Owner is the user or organization that owns service accounts.
+type Owner struct {
+	path string
+}
+
+func UserOwner(userID string) Owner {
+	return Owner{path: pathf("/v1/users/%s/service-accounts", userID)}
+}
+
+func OrganizationOwner(orgID string) Owner {
+	return Owner{path: pathf("/v1/organizations/%s/service-accounts", orgID)}
+}
+
+func (o Owner) account(accountID string, rest string) string {
+	return o.path + "/" + url.PathEscape(accountID) + rest
+}
+
+func (c *Client) ListServiceAccounts(ctx context.Context, owner Owner) ([]models.ServiceAccount, error) {
+	var accounts []models.ServiceAccount
+	_, err := c.do(ctx, request{method: http.MethodGet, path: owner.path, auth: true}, &accounts)
+	return accounts, err
+}
+
+// CreateServiceAccount creates a service account. The response is the only
+// time the client secret is returned.
+func (c *Client) CreateServiceAccount(ctx context.Context, owner Owner, input models.CreateServiceAccountInput) (*models.ServiceAccountCredentialsResponse, error) {
+	return c.serviceAccountCredentials(ctx, request{method: http.MethodPost, path: owner.path, body: input, auth: true})
+}
+
+func (c *Client) GetServiceAccount(ctx context.Context, owner Owner, accountID string) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	_, err := c.do(ctx, request{method: http.MethodGet, path: owner.account(accountID, ""), auth: true}, &account)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (c *Client) DeleteServiceAccount(ctx context.Context, owner Owner, accountID string) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: owner.account(accountID, ""), auth: true}, nil)
+	return err
+}
+
+// RotateServiceAccountSecret replaces the client secret, the old one stops
+// working immediately.
+func (c *Client) RotateServiceAccountSecret(ctx context.Context, owner Owner, accountID string) (*models.ServiceAccountCredentialsResponse, error) {
+	return c.serviceAccountCredentials(ctx, request{
+		method: http.MethodPost,
+		path:   owner.account(accountID, "/secret"),
+		auth:   true,
+	})
+}
+
+func (c *Client) ListServiceAccountTokens(ctx context.Context, owner Owner, accountID string) ([]models.AccessToken, error) {
+	var tokens []models.AccessToken
+	_, err := c.do(ctx, request{method: http.MethodGet, path: owner.account(accountID, "/tokens"), auth: true}, &tokens)
+	return tokens, err
+}
+
+// CreateServiceAccountToken creates an access token of the service account.
+// The response is the only time the token is returned.
+func (c *Client) CreateServiceAccountToken(
+	ctx context.Context,
+	owner Owner,
+	accountID string,
+	input models.CreateAccessTokenInput,
+) (*models.CreateAccessTokenResponse, error) {
+	var res models.CreateAccessTokenResponse
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   owner.account(accountID, "/tokens"),
+		body:   input,
+		auth:   true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) RevokeServiceAccountToken(ctx context.Context, owner Owner, accountID, tokenID string) error {
+	_, err := c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   owner.account(accountID, "/tokens/"+url.PathEscape(tokenID)),
+		auth:   true,
+	}, nil)
+	return err
+}
+
+// ClientCredentialsToken exchanges the client credentials of a service
+// account for a token. It doesn't change the credentials of the client.
+func (c *Client) ClientCredentialsToken(ctx context.Context, clientID, clientSecret string) (*models.ClientCredentialsResponse, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	}
+
+	var res models.ClientCredentialsResponse
+	if _, err := c.do(ctx, request{method: http.MethodPost, path: "/v1/oauth/token", form: form}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) serviceAccountCredentials(ctx context.Context, req request) (*models.ServiceAccountCredentialsResponse, error) {
+	var res models.ServiceAccountCredentialsResponse
+	if _, err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rovilay/auth-service/models"
+)
+
+// User is a user account. ETag identifies the version of the user, pass it
+// as ifMatch to only update the version that was read.
+type User struct {
+	models.UserResponse
+	ETag string `json:"-"`
+}
+
+type tokenResponse struct {
+	Token string `json:"token"`
+}
+
+// signupRequest is the body of a signup, models.SignupInput would also send
+// the fields of models.User that are set by the service.
+type signupRequest struct {
+	Firstname       string `json:"firstname"`
+	Lastname        string `json:"lastname"`
+	Username        string `json:"username,omitempty"`
+	Email           string `json:"email"`
+	Password        string `json:"password"`
+	InvitationToken string `json:"invitation_token,omitempty"`
+}
+
+// Signup creates a user account and returns a token for it.
+func (c *Client) Signup(ctx context.Context, input models.SignupInput) (string, error) {
+	body := signupRequest{
+		Firstname:       input.Firstname,
+		Lastname:        input.Lastname,
+		Username:        input.Username,
+		Email:           input.Email,
+		Password:        input.Password,
+		InvitationToken: input.InvitationToken,
+	}
+
+	var res tokenResponse
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/v1/signup", body: body}, &res)
+	if err != nil {
+		return "", err
+	}
+	return res.Token, nil
+}
+
+// Login returns a token for the user. It doesn't change the credentials of
+// the client.
+func (c *Client) Login(ctx context.Context, input models.LoginInput) (string, error) {
+	var res tokenResponse
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/v1/login", body: input}, &res)
+	if err != nil {
+		return "", err
+	}
+	return res.Token, nil
+}
+
+func (c *Client) GetUser(ctx context.Context, id string) (*User, error) {
+	return c.user(ctx, request{method: http.MethodGet, path: pathf("/v1/users/%s", id), auth: true})
+}
+
+// UpdateUser replaces the profile fields that are set in input. When ifMatch
+// isn't empty the update fails with ErrPreconditionFailed if the user changed
+// since it was read.
+func (c *Client) UpdateUser(ctx context.Context, id string, input models.UpdateUserInput, ifMatch string) (*User, error) {
+	return c.user(ctx, request{
+		method:  http.MethodPut,
+		path:    pathf("/v1/users/%s", id),
+		body:    input,
+		ifMatch: ifMatch,
+		auth:    true,
+	})
+}
+
+// PatchUser applies a JSON merge patch (RFC 7396) to the profile and the user
+// metadata namespace, e.g. {"metadata": {"theme": "dark"}}. A nil value
+// removes a metadata key.
+func (c *Client) PatchUser(ctx context.Context, id string, patch map[string]any, ifMatch string) (*User, error) {
+	return c.user(ctx, request{
+		method:      http.MethodPatch,
+		path:        pathf("/v1/users/%s", id),
+		body:        patch,
+		contentType: "application/merge-patch+json",
+		ifMatch:     ifMatch,
+		auth:        true,
+	})
+}
+
+func (c *Client) DeleteUser(ctx context.Context, id string) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: pathf("/v1/users/%s", id), auth: true}, nil)
+	return err
+}
+
+func (c *Client) UpdatePassword(ctx context.Context, id string, input models.UpdatePasswordInput) error {
+	_, err := c.do(ctx, request{
+		method: http.MethodPut,
+		path:   pathf("/v1/users/%s/password", id),
+		body:   input,
+		auth:   true,
+	}, nil)
+	return err
+}
+
+// UpdateAdminMetadata applies a JSON merge patch to the admin metadata
+// namespace of the user. It requires an admin.
+func (c *Client) UpdateAdminMetadata(ctx context.Context, id string, patch map[string]any, ifMatch string) (*User, error) {
+	return c.user(ctx, request{
+		method:      http.MethodPatch,
+		path:        pathf("/v1/admin/users/%s/metadata", id),
+		body:        patch,
+		contentType: "application/merge-patch+json",
+		ifMatch:     ifMatch,
+		auth:        true,
+	})
+}
+
+func (c *Client) user(ctx context.Context, req request) (*User, error) {
+	var user User
+	header, err := c.do(ctx, req, &user.UserResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	user.ETag = header.Get("ETag")
+	return &user, nil
+}
+
+// ListAccessTokens lists the personal access tokens of the user.
+func (c *Client) ListAccessTokens(ctx context.Context, userID string) ([]models.AccessToken, error) {
+	var tokens []models.AccessToken
+	_, err := c.do(ctx, request{method: http.MethodGet, path: pathf("/v1/users/%s/tokens", userID), auth: true}, &tokens)
+	return tokens, err
+}
+
+// CreateAccessToken creates a personal access token. The response is the
+// only time the token is returned.
+func (c *Client) CreateAccessToken(ctx context.Context, userID string, input models.CreateAccessTokenInput) (*models.CreateAccessTokenResponse, error) {
+	var res models.CreateAccessTokenResponse
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   pathf("/v1/users/%s/tokens", userID),
+		body:   input,
+		auth:   true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) RevokeAccessToken(ctx context.Context, userID, tokenID string) error {
+	_, err := c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   pathf("/v1/users/%s/tokens/%s", userID, tokenID),
+		auth:   true,
+	}, nil)
+	return err
+}
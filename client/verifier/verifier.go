@@ -0,0 +1,177 @@
+// Package verifier validates tokens issued by auth-service without calling
+// it. It checks the signature with the JWT_SECRET of the service and reads
+// the claims written by utils.GenerateJWT and
+// utils.GenerateServiceAccountJWT.
+//
+// Personal access tokens aren't JWTs and can only be checked by the service,
+// they are rejected.
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/models"
+)
+
+var (
+	ErrMissingToken = errors.New("missing authorization token")
+	ErrInvalidToken = errors.New("token is invalid or expired")
+	// ErrPrincipalNotAllowed is returned for service account tokens when the
+	// verifier only accepts users.
+	ErrPrincipalNotAllowed = errors.New("principal type is not allowed")
+)
+
+// Claims are the verified claims of a token.
+type Claims struct {
+	// Subject is the ID of the user or service account.
+	Subject       uuid.UUID
+	PrincipalType string
+	ExpiresAt     time.Time
+	// Metadata holds the user metadata keys listed in METADATA_CLAIMS of the
+	// service. It is nil for service accounts.
+	Metadata map[string]any
+}
+
+func (c *Claims) IsUser() bool {
+	return c.PrincipalType == models.PrincipalUser
+}
+
+func (c *Claims) Principal() *models.Principal {
+	return &models.Principal{ID: c.Subject, Type: c.PrincipalType}
+}
+
+// Verifier validates HS256 tokens signed with the secret of the service.
+type Verifier struct {
+	secret []byte
+	// UsersOnly rejects service account tokens, like the user routes of the
+	// service do.
+	UsersOnly bool
+}
+
+func New(secret string) *Verifier {
+	return &Verifier{secret: []byte(secret)}
+}
+
+// Verify validates token and returns its claims. Tokens without a
+// principal_type claim predate service accounts and belong to users.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return v.secret, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	mapClaims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok || !parsed.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	claims := &Claims{PrincipalType: models.PrincipalUser}
+	if principalType, _ := mapClaims["principal_type"].(string); principalType != "" {
+		claims.PrincipalType = principalType
+	}
+
+	subject, _ := mapClaims["sub"].(string)
+	if subject == "" {
+		subject, _ = mapClaims["user_id"].(string)
+	}
+	if claims.Subject, err = uuid.Parse(subject); err != nil {
+		return nil, fmt.Errorf("%w: invalid subject", ErrInvalidToken)
+	}
+
+	if exp, ok := mapClaims["exp"].(float64); ok {
+		claims.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	if metadata, ok := mapClaims["metadata"].(map[string]any); ok {
+		claims.Metadata = metadata
+	}
+
+	if v.UsersOnly && !claims.IsUser() {
+		return nil, ErrPrincipalNotAllowed
+	}
+
+	return claims, nil
+}
+
+type claimsContextKey struct{}
+
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by Middleware.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok
+}
+
+// Middleware rejects requests without a valid bearer token with a 401
+// application/problem+json response in the format of the service, and
+// stores the claims of valid ones in the request context. It can be used
+// with chi's Use or wrap any http.Handler.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := bearerToken(r)
+		if err != nil {
+			writeUnauthorized(w, r, err)
+			return
+		}
+
+		claims, err := v.Verify(token)
+		if err != nil {
+			writeUnauthorized(w, r, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+	})
+}
+
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", ErrMissingToken
+	}
+
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", ErrInvalidToken
+	}
+	return token, nil
+}
+
+// writeUnauthorized sends the problem the service sends for the same error.
+func writeUnauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	code, title, bearerError := "invalid_token", "The token is invalid or has expired.", "invalid_token"
+	switch {
+	case errors.Is(err, ErrMissingToken):
+		code, title, bearerError = "missing_token", "An authorization token is required.", "invalid_request"
+	case errors.Is(err, ErrPrincipalNotAllowed):
+		code, title = "unauthorized", "You are not authorized to access this resource."
+	}
+
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error=%q`, bearerError))
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusUnauthorized)
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"type":     "urn:auth-service:problem:" + code,
+		"title":    title,
+		"status":   http.StatusUnauthorized,
+		"instance": r.URL.Path,
+		"code":     code,
+	})
+}
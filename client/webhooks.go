@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rovilay/auth-service/models"
+)
+
+// The webhook endpoints require an admin.
+
+func (c *Client) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/v1/admin/webhooks", auth: true}, &webhooks)
+	return webhooks, err
+}
+
+// CreateWebhook registers a webhook. The response is the only time the
+// signing secret is returned.
+func (c *Client) CreateWebhook(ctx context.Context, input models.CreateWebhookInput) (*models.CreateWebhookResponse, error) {
+	var res models.CreateWebhookResponse
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/v1/admin/webhooks", body: input, auth: true}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) GetWebhook(ctx context.Context, webhookID string) (*models.Webhook, error) {
+	var webhook models.Webhook
+	_, err := c.do(ctx, request{method: http.MethodGet, path: pathf("/v1/admin/webhooks/%s", webhookID), auth: true}, &webhook)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, webhookID string) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: pathf("/v1/admin/webhooks/%s", webhookID), auth: true}, nil)
+	return err
+}
+
+// ListWebhookDeliveries returns the latest deliveries of the webhook, newest
+// first.
+func (c *Client) ListWebhookDeliveries(ctx context.Context, webhookID string) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	_, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   pathf("/v1/admin/webhooks/%s/deliveries", webhookID),
+		auth:   true,
+	}, &deliveries)
+	return deliveries, err
+}
+
+// RedeliverWebhookDelivery queues a delivery again.
+func (c *Client) RedeliverWebhookDelivery(ctx context.Context, webhookID, deliveryID string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   pathf("/v1/admin/webhooks/%s/deliveries/%s/redeliver", webhookID, deliveryID),
+		auth:   true,
+	}, &delivery)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
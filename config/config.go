@@ -2,16 +2,58 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 )
 
 type AppConfig struct {
-	ServerPort   uint16
-	DATABASE_URL string
-	JwtSecret    string
+	ServerPort             uint16
+	GRPCPort               uint16
+	DATABASE_URL           string
+	DatabaseDriver         string
+	DatabaseDSN            string
+	AutoMigrate            bool
+	JwtSecret              string
+	InvitationURL          string
+	InviteOnlySignup       bool
+	InvitationTTL          time.Duration
+	ServiceAccountTokenTTL time.Duration
+	AdminUserIDs           []string
+	UserMetadataSchema     string
+	AdminMetadataSchema    string
+	MetadataClaims         []string
+	EventSinks             []string
+	EventDispatchInterval  time.Duration
+	WebhookTimeout         time.Duration
+	WebhookMaxAttempts     int
+	ShutdownDelay          time.Duration
+	TracingExporter        string
+	LogRedaction           bool
+	OpenAPIValidation      bool
+	SwaggerUI              bool
+	LegacyRoutes           bool
+	LegacyRoutesSunset     time.Time
+	ForwardAuthRules       []ForwardAuthRule
+	ForwardAuthLoginURL    string
+	K8sWebhookToken        string
+	K8sUsernamePrefix      string
+	K8sGroupMappings       []K8sGroupMapping
+	K8sAudiences           []string
+	Sessions               bool
+	SessionCookieName      string
+	SessionCookieDomain    string
+	SessionCookieSecure    bool
+	SessionSameSite        http.SameSite
+	SessionIdleTimeout     time.Duration
+	SessionMaxAge          time.Duration
+	CORSAllowedOrigins     []string
 }
 
 var Config = AppConfig{}
@@ -25,15 +67,402 @@ func LoadConfig(log *zerolog.Logger) AppConfig {
 		}
 	}
 
+	Config.GRPCPort = 0
+	if grpcPort, exists := os.LookupEnv("GRPC_PORT"); exists {
+		if port, err := strconv.ParseUint(grpcPort, 10, 16); err == nil {
+			Config.GRPCPort = uint16(port)
+		}
+	}
+
 	if url, exists := os.LookupEnv("DATABASE_URL"); exists {
 		Config.DATABASE_URL = url
 	}
 
+	driver, dsn, err := parseDatabaseURL(Config.DATABASE_URL)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load config")
+	}
+	Config.DatabaseDriver = driver
+	Config.DatabaseDSN = dsn
+
+	if autoMigrate, exists := os.LookupEnv("AUTO_MIGRATE"); exists {
+		if v, err := strconv.ParseBool(autoMigrate); err == nil {
+			Config.AutoMigrate = v
+		}
+	}
+
 	if secret, exists := os.LookupEnv("JWT_SECRET"); exists {
 		Config.JwtSecret = secret
 	} else {
 		log.Fatal().Err(errors.New("JWT_SECRET is required")).Msg("failed to load config")
 	}
 
+	if invitationURL, exists := os.LookupEnv("INVITATION_URL"); exists {
+		Config.InvitationURL = invitationURL
+	}
+
+	if inviteOnly, exists := os.LookupEnv("INVITE_ONLY_SIGNUP"); exists {
+		if v, err := strconv.ParseBool(inviteOnly); err == nil {
+			Config.InviteOnlySignup = v
+		}
+	}
+
+	Config.InvitationTTL = time.Hour * 24 * 7
+	if ttl, exists := os.LookupEnv("INVITATION_TTL"); exists {
+		if d, err := time.ParseDuration(ttl); err == nil {
+			Config.InvitationTTL = d
+		}
+	}
+
+	Config.ServiceAccountTokenTTL = time.Hour
+	if ttl, exists := os.LookupEnv("SERVICE_ACCOUNT_TOKEN_TTL"); exists {
+		if d, err := time.ParseDuration(ttl); err == nil {
+			Config.ServiceAccountTokenTTL = d
+		}
+	}
+
+	if ids, exists := os.LookupEnv("ADMIN_USER_IDS"); exists {
+		Config.AdminUserIDs = splitList(ids)
+	}
+
+	if schema, exists := os.LookupEnv("USER_METADATA_SCHEMA"); exists {
+		Config.UserMetadataSchema = schema
+	}
+
+	if schema, exists := os.LookupEnv("ADMIN_METADATA_SCHEMA"); exists {
+		Config.AdminMetadataSchema = schema
+	}
+
+	if claims, exists := os.LookupEnv("METADATA_CLAIMS"); exists {
+		Config.MetadataClaims = splitList(claims)
+	}
+
+	if sinks, exists := os.LookupEnv("EVENT_SINKS"); exists {
+		Config.EventSinks = splitList(sinks)
+	}
+
+	Config.EventDispatchInterval = time.Second
+	if interval, exists := os.LookupEnv("EVENT_DISPATCH_INTERVAL"); exists {
+		if d, err := time.ParseDuration(interval); err == nil && d > 0 {
+			Config.EventDispatchInterval = d
+		}
+	}
+
+	Config.WebhookTimeout = time.Second * 10
+	if timeout, exists := os.LookupEnv("WEBHOOK_TIMEOUT"); exists {
+		if d, err := time.ParseDuration(timeout); err == nil && d > 0 {
+			Config.WebhookTimeout = d
+		}
+	}
+
+	Config.WebhookMaxAttempts = 8
+	if attempts, exists := os.LookupEnv("WEBHOOK_MAX_ATTEMPTS"); exists {
+		if n, err := strconv.Atoi(attempts); err == nil && n > 0 {
+			Config.WebhookMaxAttempts = n
+		}
+	}
+
+	Config.ShutdownDelay = time.Second * 5
+	if delay, exists := os.LookupEnv("SHUTDOWN_DELAY"); exists {
+		if d, err := time.ParseDuration(delay); err == nil && d >= 0 {
+			Config.ShutdownDelay = d
+		}
+	}
+
+	if exporter, exists := os.LookupEnv("TRACING_EXPORTER"); exists {
+		Config.TracingExporter = strings.ToLower(strings.TrimSpace(exporter))
+	}
+
+	Config.LogRedaction = true
+	if redaction, exists := os.LookupEnv("LOG_REDACTION"); exists {
+		if v, err := strconv.ParseBool(redaction); err == nil {
+			Config.LogRedaction = v
+		}
+	}
+
+	if validation, exists := os.LookupEnv("OPENAPI_VALIDATION"); exists {
+		if v, err := strconv.ParseBool(validation); err == nil {
+			Config.OpenAPIValidation = v
+		}
+	}
+
+	if swaggerUI, exists := os.LookupEnv("SWAGGER_UI"); exists {
+		if v, err := strconv.ParseBool(swaggerUI); err == nil {
+			Config.SwaggerUI = v
+		}
+	}
+
+	Config.LegacyRoutes = true
+	if legacy, exists := os.LookupEnv("LEGACY_ROUTES"); exists {
+		if v, err := strconv.ParseBool(legacy); err == nil {
+			Config.LegacyRoutes = v
+		}
+	}
+
+	if sunset, exists := os.LookupEnv("LEGACY_ROUTES_SUNSET"); exists && sunset != "" {
+		t, err := parseDate(sunset)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load config")
+		}
+		Config.LegacyRoutesSunset = t
+	}
+
+	if rules, exists := os.LookupEnv("FORWARD_AUTH_RULES"); exists {
+		parsed, err := parseForwardAuthRules(rules)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load config")
+		}
+		Config.ForwardAuthRules = parsed
+	}
+
+	if loginURL, exists := os.LookupEnv("FORWARD_AUTH_LOGIN_URL"); exists {
+		Config.ForwardAuthLoginURL = loginURL
+	}
+
+	if token, exists := os.LookupEnv("K8S_WEBHOOK_TOKEN"); exists {
+		Config.K8sWebhookToken = token
+	}
+
+	if prefix, exists := os.LookupEnv("K8S_USERNAME_PREFIX"); exists {
+		Config.K8sUsernamePrefix = prefix
+	}
+
+	if mappings, exists := os.LookupEnv("K8S_GROUP_MAPPINGS"); exists {
+		parsed, err := parseK8sGroupMappings(mappings)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load config")
+		}
+		Config.K8sGroupMappings = parsed
+	}
+
+	if audiences, exists := os.LookupEnv("K8S_AUDIENCES"); exists {
+		Config.K8sAudiences = splitList(audiences)
+	}
+
+	if sessions, exists := os.LookupEnv("SESSIONS"); exists {
+		if v, err := strconv.ParseBool(sessions); err == nil {
+			Config.Sessions = v
+		}
+	}
+
+	Config.SessionCookieName = "session"
+	if name, exists := os.LookupEnv("SESSION_COOKIE_NAME"); exists && name != "" {
+		Config.SessionCookieName = name
+	}
+
+	if domain, exists := os.LookupEnv("SESSION_COOKIE_DOMAIN"); exists {
+		Config.SessionCookieDomain = domain
+	}
+
+	Config.SessionCookieSecure = true
+	if secure, exists := os.LookupEnv("SESSION_COOKIE_SECURE"); exists {
+		if v, err := strconv.ParseBool(secure); err == nil {
+			Config.SessionCookieSecure = v
+		}
+	}
+
+	Config.SessionSameSite = http.SameSiteLaxMode
+	if sameSite, exists := os.LookupEnv("SESSION_SAME_SITE"); exists && sameSite != "" {
+		mode, err := parseSameSite(sameSite)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load config")
+		}
+		Config.SessionSameSite = mode
+	}
+	if Config.SessionSameSite == http.SameSiteNoneMode && !Config.SessionCookieSecure {
+		log.Fatal().Msg("failed to load config: SESSION_SAME_SITE=none requires SESSION_COOKIE_SECURE=true")
+	}
+
+	Config.SessionIdleTimeout = time.Minute * 30
+	if timeout, exists := os.LookupEnv("SESSION_IDLE_TIMEOUT"); exists {
+		if d, err := time.ParseDuration(timeout); err == nil && d > 0 {
+			Config.SessionIdleTimeout = d
+		}
+	}
+
+	Config.SessionMaxAge = time.Hour * 12
+	if maxAge, exists := os.LookupEnv("SESSION_MAX_AGE"); exists {
+		if d, err := time.ParseDuration(maxAge); err == nil && d > 0 {
+			Config.SessionMaxAge = d
+		}
+	}
+
+	if origins, exists := os.LookupEnv("CORS_ALLOWED_ORIGINS"); exists {
+		Config.CORSAllowedOrigins = splitList(origins)
+	}
+
 	return Config
 }
+
+// RedactedDatabaseURL is DATABASE_URL with the password masked, for logs.
+func (c *AppConfig) RedactedDatabaseURL() string {
+	u, err := url.Parse(c.DATABASE_URL)
+	if err != nil {
+		return "[invalid DATABASE_URL]"
+	}
+	return u.Redacted()
+}
+
+// IsAdmin reports whether the user is one of the configured admins.
+func (c *AppConfig) IsAdmin(userID string) bool {
+	for _, id := range c.AdminUserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDate parses a date like 2027-01-31 or an RFC 3339 timestamp.
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC 3339", value)
+	}
+	return t, nil
+}
+
+const (
+	// ForwardAuthPublic lets anyone through, the identity headers are still
+	// set for authenticated requests.
+	ForwardAuthPublic = "public"
+	// ForwardAuthAuthenticated requires a user or a service account.
+	ForwardAuthAuthenticated = "authenticated"
+	// ForwardAuthUser requires a user, it is the policy of unmatched paths.
+	ForwardAuthUser  = "user"
+	ForwardAuthAdmin = "admin"
+)
+
+// ForwardAuthRule sets the policy of the paths matching Pattern, which is
+// either a path or a path prefix ending with *.
+type ForwardAuthRule struct {
+	Pattern string
+	Policy  string
+}
+
+// parseForwardAuthRules parses a comma separated list of pattern=policy
+// entries, e.g. /public/*=public,/admin/*=admin.
+func parseForwardAuthRules(value string) ([]ForwardAuthRule, error) {
+	var rules []ForwardAuthRule
+	for _, entry := range splitList(value) {
+		pattern, policy, found := strings.Cut(entry, "=")
+		pattern, policy = strings.TrimSpace(pattern), strings.ToLower(strings.TrimSpace(policy))
+		if !found || !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("invalid forward auth rule %q, expected /path=policy", entry)
+		}
+
+		switch policy {
+		case ForwardAuthPublic, ForwardAuthAuthenticated, ForwardAuthUser, ForwardAuthAdmin:
+		default:
+			return nil, fmt.Errorf("invalid forward auth policy %q, expected public, authenticated, user or admin", policy)
+		}
+
+		rules = append(rules, ForwardAuthRule{Pattern: pattern, Policy: policy})
+	}
+	return rules, nil
+}
+
+// K8sGroupMapping adds Group to the Kubernetes groups of the principals
+// matching Source, which is one of
+//
+//	role:<role>                   a forward auth role: user, service_account or admin
+//	org:<org id>                  any member of the organization
+//	org:<org id>:<member role>    members with the role: owner, admin or member
+type K8sGroupMapping struct {
+	Source string
+	Group  string
+}
+
+// parseK8sGroupMappings parses a comma separated list of source=group
+// entries, e.g. role:admin=system:masters,org:<id>=team-a.
+func parseK8sGroupMappings(value string) ([]K8sGroupMapping, error) {
+	var mappings []K8sGroupMapping
+	for _, entry := range splitList(value) {
+		source, group, found := strings.Cut(entry, "=")
+		source, group = strings.TrimSpace(source), strings.TrimSpace(group)
+		if !found || group == "" {
+			return nil, fmt.Errorf("invalid kubernetes group mapping %q, expected source=group", entry)
+		}
+
+		kind, rest, _ := strings.Cut(source, ":")
+		switch kind {
+		case "role":
+			switch rest {
+			case "user", "service_account", "admin":
+			default:
+				return nil, fmt.Errorf("invalid kubernetes group mapping role %q, expected user, service_account or admin", rest)
+			}
+		case "org":
+			orgID, memberRole, hasRole := strings.Cut(rest, ":")
+			if orgID == "" {
+				return nil, fmt.Errorf("invalid kubernetes group mapping %q, missing organization id", entry)
+			}
+			if hasRole && memberRole != "owner" && memberRole != "admin" && memberRole != "member" {
+				return nil, fmt.Errorf("invalid kubernetes group mapping member role %q, expected owner, admin or member", memberRole)
+			}
+		default:
+			return nil, fmt.Errorf("invalid kubernetes group mapping source %q, expected role:<role> or org:<org id>[:<member role>]", source)
+		}
+
+		mappings = append(mappings, K8sGroupMapping{Source: source, Group: group})
+	}
+	return mappings, nil
+}
+
+// parseSameSite parses the SameSite attribute of the session cookie. None
+// requires a secure cookie.
+func parseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("invalid SESSION_SAME_SITE %q, expected strict, lax or none", value)
+	}
+}
+
+// splitList splits a comma separated env value, skipping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+const (
+	DriverPostgres = "pgx"
+	DriverSQLite   = "sqlite"
+)
+
+// parseDatabaseURL picks the database driver from the DATABASE_URL scheme and
+// returns the DSN to open it with. sqlite://path/to/auth.db and
+// sqlite:///abs/path/auth.db select SQLite, postgres:// and postgresql://
+// select postgres.
+func parseDatabaseURL(url string) (string, string, error) {
+	scheme, rest, found := strings.Cut(url, "://")
+	if !found {
+		return "", "", errors.New("invalid DATABASE_URL: missing scheme")
+	}
+
+	switch strings.ToLower(scheme) {
+	case "postgres", "postgresql":
+		return DriverPostgres, url, nil
+	case "sqlite", "sqlite3":
+		if rest == "" {
+			return "", "", errors.New("invalid DATABASE_URL: missing sqlite database path")
+		}
+		return DriverSQLite, rest, nil
+	default:
+		return "", "", fmt.Errorf("unsupported DATABASE_URL scheme %q", scheme)
+	}
+}
@@ -0,0 +1,132 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/repository"
+	"github.com/rs/zerolog"
+)
+
+const (
+	batchSize = 100
+	// lease is how long a claimed event is hidden from other dispatchers. It
+	// must be longer than delivering a batch takes.
+	lease = time.Minute
+	// maxRetryDelay caps the exponential backoff of failing events.
+	maxRetryDelay = time.Hour
+)
+
+// Dispatcher polls the outbox and delivers pending events to every sink. An
+// event is marked dispatched only once all sinks accepted it, a failing event
+// is retried with exponential backoff. Retries can deliver events of a user
+// out of order, consumers should compare updated_at.
+type Dispatcher struct {
+	repo     repository.OutboxRepository
+	sinks    []Sink
+	interval time.Duration
+	log      *zerolog.Logger
+}
+
+func NewDispatcher(repo repository.OutboxRepository, sinks []Sink, interval time.Duration, log *zerolog.Logger) *Dispatcher {
+	logger := log.With().Str("events", "Dispatcher").Logger()
+
+	return &Dispatcher{
+		repo:     repo,
+		sinks:    sinks,
+		interval: interval,
+		log:      &logger,
+	}
+}
+
+// Run dispatches events until ctx is cancelled, then closes the sinks.
+func (d *Dispatcher) Run(ctx context.Context) {
+	defer d.close()
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := d.dispatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.log.Err(err).Msg("failed to dispatch events")
+		}
+
+		// a full batch means there are probably more events waiting
+		if n == batchSize && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch delivers one batch of events and returns its size.
+func (d *Dispatcher) dispatch(ctx context.Context) (int, error) {
+	events, err := d.repo.ClaimEvents(ctx, batchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		log := d.log.With().Str("event_id", event.ID.String()).Str("event_type", event.Type).Logger()
+
+		if err := d.deliver(ctx, event); err != nil {
+			retryAt := time.Now().Add(retryDelay(event.Attempts + 1))
+			log.Err(err).Int("attempts", event.Attempts+1).Time("retry_at", retryAt).Msg("failed to deliver event")
+
+			if err := d.repo.MarkEventFailed(ctx, event.ID, err.Error(), retryAt); err != nil {
+				return len(events), err
+			}
+			continue
+		}
+
+		if err := d.repo.MarkEventDispatched(ctx, event.ID); err != nil {
+			return len(events), err
+		}
+	}
+
+	return len(events), nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, event models.Event) error {
+	var errs []error
+	for i, sink := range d.sinks {
+		if err := sink.Deliver(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("sink %d: %w", i, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (d *Dispatcher) close() {
+	for _, sink := range d.sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				d.log.Err(err).Msg("failed to close event sink")
+			}
+		}
+	}
+}
+
+// retryDelay doubles the delay with every attempt, starting at a second.
+func retryDelay(attempts int) time.Duration {
+	if attempts > 12 {
+		return maxRetryDelay
+	}
+
+	delay := time.Second << (attempts - 1)
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
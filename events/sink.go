@@ -0,0 +1,83 @@
+// Package events delivers the domain events recorded in the outbox to the
+// configured sinks.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rovilay/auth-service/models"
+)
+
+// Sink receives dispatched events. Deliver must be safe to call again for an
+// event it has already received, delivery is at least once.
+type Sink interface {
+	Deliver(ctx context.Context, event models.Event) error
+}
+
+type writerSink struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	closer  io.Closer
+}
+
+// NewWriterSink writes each event to w as a line of JSON.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{encoder: json.NewEncoder(w)}
+}
+
+// NewFileSink appends events to the file at path as JSON lines.
+func NewFileSink(path string) (Sink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event file: %w", err)
+	}
+
+	return &writerSink{encoder: json.NewEncoder(f), closer: f}, nil
+}
+
+func (s *writerSink) Deliver(ctx context.Context, event models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.encoder.Encode(event)
+}
+
+func (s *writerSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// NewSinks builds the sinks listed in EVENT_SINKS. "stdout" writes to the
+// standard output and "file:<path>" appends to a file.
+func NewSinks(specs []string) ([]Sink, error) {
+	var sinks []Sink
+	for _, spec := range specs {
+		switch {
+		case spec == "stdout":
+			sinks = append(sinks, NewWriterSink(os.Stdout))
+		case strings.HasPrefix(spec, "file:"):
+			path := strings.TrimPrefix(strings.TrimPrefix(spec, "file:"), "//")
+			if path == "" {
+				return nil, fmt.Errorf("invalid event sink %q: missing path", spec)
+			}
+
+			sink, err := NewFileSink(path)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		default:
+			return nil, fmt.Errorf("unsupported event sink %q", spec)
+		}
+	}
+
+	return sinks, nil
+}
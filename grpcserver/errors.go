@@ -0,0 +1,76 @@
+package grpcserver
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rovilay/auth-service/logging"
+	"github.com/rovilay/auth-service/problem"
+	"github.com/rs/zerolog"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// ErrorDomain is the domain of the google.rpc.ErrorInfo details.
+const ErrorDomain = "auth-service"
+
+// statusCodes maps the statuses of the HTTP problems to gRPC codes.
+var statusCodes = map[int]codes.Code{
+	http.StatusBadRequest:           codes.InvalidArgument,
+	http.StatusUnauthorized:         codes.Unauthenticated,
+	http.StatusForbidden:            codes.PermissionDenied,
+	http.StatusNotFound:             codes.NotFound,
+	http.StatusMethodNotAllowed:     codes.Unimplemented,
+	http.StatusConflict:             codes.Aborted,
+	http.StatusPreconditionFailed:   codes.FailedPrecondition,
+	http.StatusUnsupportedMediaType: codes.InvalidArgument,
+	http.StatusServiceUnavailable:   codes.Unavailable,
+}
+
+// statusError is the gRPC counterpart of the HTTP handlers' sendError. The
+// status carries the problem code as ErrorInfo reason, the request ID and the
+// invalid fields. The message of err is only logged.
+func statusError(ctx context.Context, err error, log *zerolog.Logger) error {
+	p := problem.New(err, 0, "", "en")
+
+	event := log.Warn()
+	if p.Status >= http.StatusInternalServerError {
+		event = log.Error()
+	}
+	event.Err(err).Int("status", p.Status).Str("code", string(p.Code)).Msg(p.Title)
+
+	code, ok := statusCodes[p.Status]
+	if !ok {
+		code = codes.Internal
+	}
+
+	message := p.Title
+	if p.Detail != "" {
+		message += " " + p.Detail
+	}
+
+	details := []protoadapt.MessageV1{
+		&errdetails.ErrorInfo{Reason: string(p.Code), Domain: ErrorDomain},
+	}
+	if id := logging.RequestIDFromContext(ctx); id != "" {
+		details = append(details, &errdetails.RequestInfo{RequestId: id})
+	}
+	if len(p.Errors) > 0 {
+		violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(p.Errors))
+		for _, fe := range p.Errors {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       fe.Field,
+				Description: fe.Message,
+			})
+		}
+		details = append(details, &errdetails.BadRequest{FieldViolations: violations})
+	}
+
+	st := status.New(code, message)
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
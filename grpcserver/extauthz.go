@@ -0,0 +1,136 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/rovilay/auth-service/handlers"
+	"github.com/rovilay/auth-service/logging"
+	"github.com/rovilay/auth-service/problem"
+	"github.com/rs/zerolog"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+)
+
+// identityHeaders are removed from requests that aren't authenticated, so
+// that clients can't pass them upstream themselves.
+var identityHeaders = []string{
+	strings.ToLower(handlers.HeaderAuthUserID),
+	strings.ToLower(handlers.HeaderAuthEmail),
+	strings.ToLower(handlers.HeaderAuthRoles),
+}
+
+// ExtAuthz implements the Envoy external authorization API
+// (envoy.service.auth.v3.Authorization). It makes the same decisions as the
+// forward auth endpoint, see handlers.UserHandler.AuthorizeForward.
+//
+// Allowed requests are sent upstream with the identity headers, which replace
+// the ones sent by the client. Denied requests get the problem the HTTP API
+// would send. Errors other than denials are returned as gRPC errors, Envoy's
+// failure_mode_allow decides what happens to the request.
+type ExtAuthz struct {
+	authv3.UnimplementedAuthorizationServer
+
+	users *handlers.UserHandler
+	log   *zerolog.Logger
+}
+
+func NewExtAuthz(users *handlers.UserHandler, log *zerolog.Logger) *ExtAuthz {
+	logger := log.With().Str("package:grpcserver", "ExtAuthz").Logger()
+
+	return &ExtAuthz{users: users, log: &logger}
+}
+
+func (a *ExtAuthz) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	log := a.log.With().Str("rpc", "Check").Ctx(ctx).Logger()
+
+	httpReq := req.GetAttributes().GetRequest().GetHttp()
+	headers := httpReq.GetHeaders()
+
+	id, err := a.users.AuthorizeForward(ctx, handlers.ForwardAuthRequest{
+		Method:        httpReq.GetMethod(),
+		URI:           httpReq.GetPath(),
+		Authorization: headers["authorization"],
+		Cookie:        headers["cookie"],
+		CSRFToken:     headers[strings.ToLower(handlers.HeaderCSRFToken)],
+	})
+	if err != nil {
+		return a.denied(ctx, httpReq, err, &log)
+	}
+
+	ok := &authv3.OkHttpResponse{}
+	if id == nil {
+		ok.HeadersToRemove = identityHeaders
+	} else {
+		logging.SetUserID(ctx, id.Principal.ID.String())
+		for name, values := range id.Headers() {
+			ok.Headers = append(ok.Headers, &corev3.HeaderValueOption{
+				Header:       &corev3.HeaderValue{Key: strings.ToLower(name), Value: values[0]},
+				AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+			})
+		}
+		// the email header is only replaced when the principal has one
+		if id.Email == "" {
+			ok.HeadersToRemove = []string{strings.ToLower(handlers.HeaderAuthEmail)}
+		}
+	}
+
+	return &authv3.CheckResponse{
+		Status:       &rpcstatus.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{OkResponse: ok},
+	}, nil
+}
+
+// denied builds the response of a request that isn't allowed. Only 401 and
+// 403 are denials, other errors are returned as gRPC errors.
+func (a *ExtAuthz) denied(ctx context.Context, httpReq *authv3.AttributeContext_HttpRequest, err error, log *zerolog.Logger) (*authv3.CheckResponse, error) {
+	headers := httpReq.GetHeaders()
+	p := problem.New(err, 0, "", problem.AcceptLanguage(headers["accept-language"]))
+
+	var code codes.Code
+	switch p.Status {
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	default:
+		return nil, statusError(ctx, err, log)
+	}
+
+	log.Warn().Err(err).Int("status", p.Status).Str("code", string(p.Code)).Msg(p.Title)
+
+	p.Instance, _, _ = strings.Cut(httpReq.GetPath(), "?")
+	p.RequestID = httpReq.GetId()
+	if p.RequestID == "" {
+		p.RequestID = headers[strings.ToLower(logging.HeaderRequestID)]
+	}
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		return nil, statusError(ctx, err, log)
+	}
+
+	responseHeaders := []*corev3.HeaderValueOption{
+		{Header: &corev3.HeaderValue{Key: "content-type", Value: problem.ContentType}},
+		{Header: &corev3.HeaderValue{Key: "x-content-type-options", Value: "nosniff"}},
+	}
+	if p.Status == http.StatusUnauthorized {
+		responseHeaders = append(responseHeaders, &corev3.HeaderValueOption{
+			Header: &corev3.HeaderValue{Key: "www-authenticate", Value: problem.Challenge(p.Code)},
+		})
+	}
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(code), Message: p.Title},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{DeniedResponse: &authv3.DeniedHttpResponse{
+			Status:  &typev3.HttpStatus{Code: typev3.StatusCode(p.Status)},
+			Headers: responseHeaders,
+			Body:    string(body) + "\n",
+		}},
+	}, nil
+}
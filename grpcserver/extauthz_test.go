@@ -0,0 +1,213 @@
+package grpcserver_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/grpcserver"
+	"github.com/rovilay/auth-service/grpcserver/extauthztest"
+	"github.com/rovilay/auth-service/handlers"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/problem"
+	"github.com/rovilay/auth-service/repository"
+	"github.com/rovilay/auth-service/utils"
+	"github.com/rs/zerolog"
+)
+
+type fixture struct {
+	client   authv3.AuthorizationClient
+	user     *models.User
+	jwt      string
+	readOnly string
+}
+
+func setup(t *testing.T) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	config.Config.JwtSecret = "test-secret"
+	c := &config.AppConfig{
+		JwtSecret: config.Config.JwtSecret,
+		ForwardAuthRules: []config.ForwardAuthRule{
+			{Pattern: "/public/*", Policy: config.ForwardAuthPublic},
+			{Pattern: "/api/*", Policy: config.ForwardAuthAuthenticated},
+			{Pattern: "/admin/*", Policy: config.ForwardAuthAdmin},
+		},
+	}
+
+	repo := repository.NewMemoryRepository(&logger)
+
+	user := &models.User{
+		ID:        uuid.New(),
+		Firstname: "Ada",
+		Lastname:  "Lovelace",
+		Username:  "ada",
+		Email:     "ada@example.com",
+		Password:  "s3cret-password",
+	}
+	if err := repo.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	jwt, err := utils.GenerateJWT(ctx, user)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+
+	readOnly := models.AccessTokenPrefix + "read-only"
+	err = repo.CreateAccessToken(ctx, &models.AccessToken{
+		ID:        uuid.New(),
+		UserID:    &user.ID,
+		Name:      "read-only",
+		TokenHash: utils.HashToken(readOnly),
+		Scopes:    models.Scopes{models.ScopeRead},
+	})
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+
+	users := handlers.NewUserHandler(repo, c, &logger)
+	client, stop, err := extauthztest.Serve(grpcserver.NewExtAuthz(users, &logger))
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	t.Cleanup(stop)
+
+	return &fixture{client: client, user: user, jwt: jwt, readOnly: readOnly}
+}
+
+func (f *fixture) check(t *testing.T, req *authv3.CheckRequest) *authv3.CheckResponse {
+	t.Helper()
+
+	res, err := f.client.Check(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	return res
+}
+
+func TestCheckAllowsValidJWT(t *testing.T) {
+	f := setup(t)
+
+	res := f.check(t, extauthztest.BearerRequest(http.MethodPost, "/api/orders?page=2", f.jwt))
+	if !extauthztest.Allowed(res) {
+		t.Fatalf("expected the request to be allowed, got status %d", extauthztest.DeniedStatus(res))
+	}
+
+	headers := extauthztest.UpstreamHeaders(res)
+	want := map[string]string{
+		strings.ToLower(handlers.HeaderAuthUserID): f.user.ID.String(),
+		strings.ToLower(handlers.HeaderAuthEmail):  f.user.Email,
+		strings.ToLower(handlers.HeaderAuthRoles):  models.PrincipalUser,
+	}
+	for name, value := range want {
+		if headers[name] != value {
+			t.Errorf("header %s = %q, want %q", name, headers[name], value)
+		}
+	}
+	if removed := extauthztest.RemovedHeaders(res); len(removed) != 0 {
+		t.Errorf("expected no removed headers, got %v", removed)
+	}
+}
+
+func TestCheckDeniesMissingToken(t *testing.T) {
+	f := setup(t)
+
+	res := f.check(t, extauthztest.CheckRequest(http.MethodGet, "/api/orders", map[string]string{
+		"Accept-Language": "de",
+		"X-Request-ID":    "req-1",
+	}))
+	if extauthztest.Allowed(res) {
+		t.Fatal("expected the request to be denied")
+	}
+	if status := extauthztest.DeniedStatus(res); status != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	p, err := extauthztest.DeniedProblem(res)
+	if err != nil {
+		t.Fatalf("DeniedProblem: %v", err)
+	}
+	if p.Code != problem.CodeMissingToken || p.Instance != "/api/orders" || p.RequestID != "req-1" {
+		t.Errorf("unexpected problem %+v", p)
+	}
+	if p.Title != problem.Title("de", problem.CodeMissingToken) {
+		t.Errorf("title = %q, want the German title", p.Title)
+	}
+
+	var challenge string
+	for _, option := range res.GetDeniedResponse().GetHeaders() {
+		if option.GetHeader().GetKey() == "www-authenticate" {
+			challenge = option.GetHeader().GetValue()
+		}
+	}
+	if challenge != problem.Challenge(problem.CodeMissingToken) {
+		t.Errorf("www-authenticate = %q", challenge)
+	}
+}
+
+func TestCheckDeniesInsufficientScope(t *testing.T) {
+	f := setup(t)
+
+	res := f.check(t, extauthztest.BearerRequest(http.MethodGet, "/api/orders", f.readOnly))
+	if !extauthztest.Allowed(res) {
+		t.Fatalf("expected a read-only token to be allowed to read, got status %d", extauthztest.DeniedStatus(res))
+	}
+
+	res = f.check(t, extauthztest.BearerRequest(http.MethodDelete, "/api/orders/1", f.readOnly))
+	if status := extauthztest.DeniedStatus(res); status != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", status, http.StatusForbidden)
+	}
+	p, err := extauthztest.DeniedProblem(res)
+	if err != nil {
+		t.Fatalf("DeniedProblem: %v", err)
+	}
+	if p.Code != problem.CodeInsufficientScope {
+		t.Errorf("code = %q, want %q", p.Code, problem.CodeInsufficientScope)
+	}
+}
+
+func TestCheckAdminRule(t *testing.T) {
+	f := setup(t)
+
+	res := f.check(t, extauthztest.BearerRequest(http.MethodGet, "/admin/users", f.jwt))
+	if status := extauthztest.DeniedStatus(res); status != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", status, http.StatusForbidden)
+	}
+}
+
+func TestCheckPublicRule(t *testing.T) {
+	f := setup(t)
+
+	res := f.check(t, extauthztest.CheckRequest(http.MethodGet, "/public/index.html", map[string]string{
+		handlers.HeaderAuthUserID: uuid.NewString(),
+	}))
+	if !extauthztest.Allowed(res) {
+		t.Fatalf("expected the public path to be allowed, got status %d", extauthztest.DeniedStatus(res))
+	}
+	if headers := extauthztest.UpstreamHeaders(res); len(headers) != 0 {
+		t.Errorf("expected no identity headers, got %v", headers)
+	}
+
+	removed := map[string]bool{}
+	for _, name := range extauthztest.RemovedHeaders(res) {
+		removed[name] = true
+	}
+	for _, name := range []string{handlers.HeaderAuthUserID, handlers.HeaderAuthEmail, handlers.HeaderAuthRoles} {
+		if !removed[strings.ToLower(name)] {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+
+	// dot segments can't escape the public rule
+	res = f.check(t, extauthztest.CheckRequest(http.MethodGet, "/public/../api/orders", nil))
+	if status := extauthztest.DeniedStatus(res); status != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,108 @@
+// Package extauthztest checks the ext_authz service without Envoy. It builds
+// the CheckRequest messages Envoy sends and reads the decisions, either by
+// calling grpcserver.ExtAuthz directly or through an in-memory connection.
+package extauthztest
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/rovilay/auth-service/grpcserver"
+	"github.com/rovilay/auth-service/problem"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const bufSize = 1024 * 1024
+
+// CheckRequest builds the request Envoy sends for an HTTP request. Header
+// names are lowercased like Envoy does.
+func CheckRequest(method, path string, headers map[string]string) *authv3.CheckRequest {
+	lowered := make(map[string]string, len(headers))
+	for name, value := range headers {
+		lowered[strings.ToLower(name)] = value
+	}
+
+	return &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{
+					Method:   method,
+					Path:     path,
+					Headers:  lowered,
+					Protocol: "HTTP/1.1",
+					Scheme:   "https",
+				},
+			},
+		},
+	}
+}
+
+// BearerRequest builds the request of a client sending token.
+func BearerRequest(method, path, token string) *authv3.CheckRequest {
+	return CheckRequest(method, path, map[string]string{"authorization": "Bearer " + token})
+}
+
+// Serve serves authz on an in-memory listener and returns a client connected
+// to it. stop stops the server and closes the connection.
+func Serve(authz *grpcserver.ExtAuthz) (client authv3.AuthorizationClient, stop func(), err error) {
+	lis := bufconn.Listen(bufSize)
+	server := grpc.NewServer()
+	authv3.RegisterAuthorizationServer(server, authz)
+	go server.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		server.Stop()
+		return nil, nil, err
+	}
+
+	return authv3.NewAuthorizationClient(conn), func() {
+		conn.Close()
+		server.Stop()
+	}, nil
+}
+
+// Allowed reports whether Envoy would send the request upstream.
+func Allowed(res *authv3.CheckResponse) bool {
+	return codes.Code(res.GetStatus().GetCode()) == codes.OK
+}
+
+// UpstreamHeaders returns the headers set on the upstream request.
+func UpstreamHeaders(res *authv3.CheckResponse) map[string]string {
+	headers := map[string]string{}
+	for _, option := range res.GetOkResponse().GetHeaders() {
+		headers[option.GetHeader().GetKey()] = option.GetHeader().GetValue()
+	}
+	return headers
+}
+
+// RemovedHeaders returns the headers removed from the upstream request.
+func RemovedHeaders(res *authv3.CheckResponse) []string {
+	return res.GetOkResponse().GetHeadersToRemove()
+}
+
+// DeniedStatus returns the HTTP status sent to the client, 0 when the
+// request is allowed.
+func DeniedStatus(res *authv3.CheckResponse) int {
+	return int(res.GetDeniedResponse().GetStatus().GetCode())
+}
+
+// DeniedProblem decodes the problem sent to the client.
+func DeniedProblem(res *authv3.CheckResponse) (*problem.Problem, error) {
+	var p problem.Problem
+	if err := json.Unmarshal([]byte(res.GetDeniedResponse().GetBody()), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
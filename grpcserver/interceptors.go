@@ -0,0 +1,141 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rovilay/auth-service/handlers"
+	"github.com/rovilay/auth-service/logging"
+	"github.com/rovilay/auth-service/models"
+	authv1 "github.com/rovilay/auth-service/proto/auth/v1"
+	"github.com/rovilay/auth-service/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// headerRequestID is the metadata key of the request ID, the gRPC form of
+// the X-Request-ID header.
+var headerRequestID = strings.ToLower(logging.HeaderRequestID)
+
+// publicMethods don't require authentication.
+var publicMethods = map[string]bool{
+	authv1.AuthService_Signup_FullMethodName:        true,
+	authv1.AuthService_Login_FullMethodName:         true,
+	authv1.AuthService_ValidateToken_FullMethodName: true,
+}
+
+// readMethods only need the read scope of personal access tokens, the other
+// methods need the write scope.
+var readMethods = map[string]bool{
+	authv1.AuthService_GetUser_FullMethodName: true,
+}
+
+// requestInterceptor assigns the request ID and writes an access log line
+// per RPC, like logging.Middleware does for HTTP requests.
+func (s *Server) requestInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var id string
+	if ids := md.Get(headerRequestID); len(ids) > 0 {
+		id = ids[0]
+	}
+	ctx, id = logging.WithRequest(ctx, id)
+	grpc.SetHeader(ctx, metadata.Pairs(headerRequestID, id))
+
+	start := time.Now()
+	res, err := handler(ctx, req)
+	code := status.Code(err)
+
+	event := s.log.Info()
+	switch code {
+	case codes.OK:
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		event = s.log.Error()
+	default:
+		event = s.log.Warn()
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		event.Str("remote_addr", p.Addr.String())
+	}
+	if agents := md.Get("user-agent"); len(agents) > 0 {
+		event.Str("user_agent", agents[0])
+	}
+
+	event.Ctx(ctx).
+		Str("rpc", info.FullMethod).
+		Str("code", code.String()).
+		Dur("latency_ms", time.Since(start)).
+		Msg("rpc completed")
+
+	return res, err
+}
+
+// recoveryInterceptor turns panics into internal errors instead of crashing
+// the process.
+func (s *Server) recoveryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log := s.log.With().Str("rpc", info.FullMethod).Ctx(ctx).Logger()
+			err = statusError(ctx, fmt.Errorf("panic: %v", r), &log)
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+// authInterceptor authenticates the users calling the AuthService, like
+// handlers.UserHandler.MiddlewareAuth. The RPCs check that users only access
+// their own account.
+func (s *Server) authInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	service := "/" + authv1.AuthService_ServiceDesc.ServiceName + "/"
+	if !strings.HasPrefix(info.FullMethod, service) || publicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	principal, err := s.authenticateUser(ctx, info.FullMethod)
+	if err != nil {
+		log := s.log.With().Str("rpc", info.FullMethod).Ctx(ctx).Logger()
+		return nil, statusError(ctx, handlers.AuthenticationError(err), &log)
+	}
+
+	ctx = models.ContextWithPrincipal(ctx, principal)
+	logging.SetUserID(ctx, principal.ID.String())
+
+	return handler(ctx, req)
+}
+
+func (s *Server) authenticateUser(ctx context.Context, method string) (*models.Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	authorization := md.Get("authorization")
+	if len(authorization) == 0 || authorization[0] == "" {
+		return nil, utils.ErrMissingAuthToken
+	}
+
+	tokenString, err := utils.ExtractToken(authorization[0])
+	if err != nil {
+		return nil, err
+	}
+
+	scope := models.ScopeWrite
+	if readMethods[method] {
+		scope = models.ScopeRead
+	}
+
+	principal, err := s.users.AuthenticateToken(ctx, tokenString, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// the user RPCs are only meant for humans
+	if !principal.IsUser() {
+		return nil, utils.ErrUserUnAuthorized
+	}
+
+	return principal, nil
+}
@@ -0,0 +1,271 @@
+// Package grpcserver serves the gRPC API of the user accounts. It shares the
+// business logic of handlers.UserHandler, so both APIs behave the same and
+// report the same error codes.
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"time"
+
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/rovilay/auth-service/handlers"
+	"github.com/rovilay/auth-service/health"
+	"github.com/rovilay/auth-service/models"
+	authv1 "github.com/rovilay/auth-service/proto/auth/v1"
+	"github.com/rovilay/auth-service/utils"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// healthSyncInterval is how often the gRPC health status is updated from the
+// readiness checks.
+const healthSyncInterval = time.Second * 5
+
+type Server struct {
+	authv1.UnimplementedAuthServiceServer
+
+	users     *handlers.UserHandler
+	server    *grpc.Server
+	health    *grpchealth.Server
+	readiness *health.Registry
+	log       *zerolog.Logger
+	done      chan struct{}
+}
+
+func New(users *handlers.UserHandler, readiness *health.Registry, log *zerolog.Logger) *Server {
+	logger := log.With().Str("package:grpcserver", "Server").Logger()
+
+	s := &Server{
+		users:     users,
+		health:    grpchealth.NewServer(),
+		readiness: readiness,
+		log:       &logger,
+		done:      make(chan struct{}),
+	}
+
+	s.server = grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			s.requestInterceptor,
+			s.recoveryInterceptor,
+			s.authInterceptor,
+		),
+	)
+
+	authv1.RegisterAuthServiceServer(s.server, s)
+	authv3.RegisterAuthorizationServer(s.server, NewExtAuthz(users, log))
+	healthpb.RegisterHealthServer(s.server, s.health)
+	reflection.Register(s.server)
+
+	return s
+}
+
+// Serve accepts connections on lis until Shutdown is called.
+func (s *Server) Serve(lis net.Listener) error {
+	go s.syncHealth()
+
+	return s.server.Serve(lis)
+}
+
+// Drain reports the server as not serving to health checks, so that clients
+// move to other instances. It keeps serving until Shutdown.
+func (s *Server) Drain() {
+	s.health.Shutdown()
+}
+
+// Shutdown stops accepting connections and waits for pending RPCs. When ctx
+// is done first the remaining RPCs are cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.health.Shutdown()
+	close(s.done)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
+
+// syncHealth sets the status of the server and the AuthService from the
+// readiness checks.
+func (s *Server) syncHealth() {
+	ticker := time.NewTicker(healthSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		status := healthpb.HealthCheckResponse_SERVING
+		if report := s.readiness.Check(context.Background()); report.Status != health.StatusOK {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		s.health.SetServingStatus("", status)
+		s.health.SetServingStatus(authv1.AuthService_ServiceDesc.ServiceName, status)
+
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Server) Signup(ctx context.Context, req *authv1.SignupRequest) (*authv1.SignupResponse, error) {
+	log := s.log.With().Str("rpc", "Signup").Ctx(ctx).Logger()
+
+	input := &models.SignupInput{
+		User: models.User{
+			Firstname: req.GetFirstname(),
+			Lastname:  req.GetLastname(),
+			Username:  req.GetUsername(),
+			Email:     req.GetEmail(),
+			Password:  req.GetPassword(),
+		},
+		InvitationToken: req.GetInvitationToken(),
+	}
+
+	user, token, err := s.users.SignupUser(ctx, input, &log)
+	if err != nil {
+		return nil, statusError(ctx, err, &log)
+	}
+
+	return &authv1.SignupResponse{Token: token, User: toUser(user)}, nil
+}
+
+func (s *Server) Login(ctx context.Context, req *authv1.LoginRequest) (*authv1.LoginResponse, error) {
+	log := s.log.With().Str("rpc", "Login").Ctx(ctx).Logger()
+
+	_, token, err := s.users.LoginUser(ctx, models.LoginInput{
+		Email:    req.GetEmail(),
+		Password: req.GetPassword(),
+	})
+	if err != nil {
+		return nil, statusError(ctx, err, &log)
+	}
+
+	return &authv1.LoginResponse{Token: token}, nil
+}
+
+func (s *Server) GetUser(ctx context.Context, req *authv1.GetUserRequest) (*authv1.GetUserResponse, error) {
+	log := s.log.With().Str("rpc", "GetUser").Ctx(ctx).Logger()
+
+	if err := authorizeUser(ctx, req.GetId()); err != nil {
+		return nil, statusError(ctx, err, &log)
+	}
+
+	user, err := s.users.User(ctx, req.GetId())
+	if err != nil {
+		return nil, statusError(ctx, err, &log)
+	}
+
+	return &authv1.GetUserResponse{User: toUser(user)}, nil
+}
+
+func (s *Server) UpdateUser(ctx context.Context, req *authv1.UpdateUserRequest) (*authv1.UpdateUserResponse, error) {
+	log := s.log.With().Str("rpc", "UpdateUser").Ctx(ctx).Logger()
+
+	if err := authorizeUser(ctx, req.GetId()); err != nil {
+		return nil, statusError(ctx, err, &log)
+	}
+
+	input := models.UpdateUserInput{
+		Firstname: req.GetFirstname(),
+		Lastname:  req.GetLastname(),
+		Username:  req.GetUsername(),
+		Email:     req.GetEmail(),
+	}
+
+	user, err := s.users.UpdateUserProfile(ctx, req.GetId(), input, req.GetEtag())
+	if err != nil {
+		return nil, statusError(ctx, err, &log)
+	}
+
+	return &authv1.UpdateUserResponse{User: toUser(user)}, nil
+}
+
+func (s *Server) UpdatePassword(ctx context.Context, req *authv1.UpdatePasswordRequest) (*authv1.UpdatePasswordResponse, error) {
+	log := s.log.With().Str("rpc", "UpdatePassword").Ctx(ctx).Logger()
+
+	if err := authorizeUser(ctx, req.GetId()); err != nil {
+		return nil, statusError(ctx, err, &log)
+	}
+
+	input := models.UpdatePasswordInput{
+		Password:    req.GetPassword(),
+		NewPassword: req.GetNewPassword(),
+	}
+
+	if err := s.users.ChangePassword(ctx, req.GetId(), input); err != nil {
+		return nil, statusError(ctx, err, &log)
+	}
+
+	return &authv1.UpdatePasswordResponse{}, nil
+}
+
+func (s *Server) ValidateToken(ctx context.Context, req *authv1.ValidateTokenRequest) (*authv1.ValidateTokenResponse, error) {
+	log := s.log.With().Str("rpc", "ValidateToken").Ctx(ctx).Logger()
+
+	if req.GetToken() == "" {
+		return nil, statusError(ctx, utils.ErrMissingAuthToken, &log)
+	}
+
+	principal, err := s.users.AuthenticateToken(ctx, req.GetToken(), "")
+	if err != nil {
+		return nil, statusError(ctx, handlers.AuthenticationError(err), &log)
+	}
+
+	res := &authv1.ValidateTokenResponse{
+		Principal: &authv1.Principal{
+			Id:   principal.ID.String(),
+			Type: authv1.Principal_TYPE_SERVICE_ACCOUNT,
+		},
+	}
+	if principal.IsUser() {
+		res.Principal.Type = authv1.Principal_TYPE_USER
+	}
+
+	return res, nil
+}
+
+// authorizeUser only lets users access their own account, like
+// handlers.UserHandler.MiddlewareAuth.
+func authorizeUser(ctx context.Context, userID string) error {
+	principal, ok := models.PrincipalFromContext(ctx)
+	if !ok || principal.ID.String() != userID {
+		return utils.ErrUserUnAuthorized
+	}
+	return nil
+}
+
+func toUser(user *models.User) *authv1.User {
+	res := &authv1.User{
+		Id:        user.ID.String(),
+		Firstname: user.Firstname,
+		Lastname:  user.Lastname,
+		Username:  user.Username,
+		Email:     user.Email,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+		UpdatedAt: timestamppb.New(user.UpdatedAt),
+		Metadata:  &authv1.UserMetadata{},
+		Etag:      handlers.UserETag(user),
+	}
+
+	// metadata is decoded from JSON, which structpb always accepts
+	res.Metadata.User, _ = structpb.NewStruct(user.Metadata.User)
+	res.Metadata.Admin, _ = structpb.NewStruct(user.Metadata.Admin)
+
+	return res
+}
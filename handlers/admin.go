@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/utils"
+)
+
+// MiddlewareAdmin only lets the users listed in ADMIN_USER_IDS through. It
+// must run after MiddlewareAuthenticate.
+func (h *UserHandler) MiddlewareAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := h.log.With().Str("middleware", "MiddlewareAdmin").Ctx(r.Context()).Logger()
+		userID := r.Context().Value(userIDKey).(string)
+
+		if !h.config.IsAdmin(userID) {
+			sendError(w, r, utils.ErrForbidden, "", 0, &log)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UpdateAdminMetadata applies a JSON merge patch to the admin metadata
+// namespace of the user, which users can't change themselves.
+func (h *UserHandler) UpdateAdminMetadata(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "UpdateAdminMetadata").Ctx(r.Context()).Logger()
+	userID := chi.URLParam(r, "id")
+
+	if !isMergePatch(r.Header.Get("Content-Type")) {
+		sendError(w, r, utils.ErrUnsupportedMediaType, "", 0, &log)
+		return
+	}
+
+	// a null patch clears the namespace
+	var patch map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, &log)
+		return
+	}
+
+	user, err := h.repo.GetUserByIDorEmail(r.Context(), userID)
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && !etagMatches(ifMatch, UserETag(user)) {
+		sendError(w, r, utils.ErrPreconditionFailed, "", 0, &log)
+		return
+	}
+
+	metadata, err := h.mergeMetadata(user, models.MetadataNamespaceAdmin, patch)
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	user, err = h.repo.PatchUser(r.Context(), user.ID.String(), models.UserPatch{Metadata: metadata, Version: user.Version})
+	if errors.Is(err, utils.ErrVersionConflict) && ifMatch != "" {
+		err = utils.ErrPreconditionFailed
+	}
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	w.Header().Set("ETag", UserETag(user))
+
+	res := &models.UserResponse{
+		ID:        user.ID,
+		Firstname: user.Firstname,
+		Lastname:  user.Lastname,
+		Username:  user.Username,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Metadata:  user.Metadata,
+	}
+
+	if err = json.NewEncoder(w).Encode(res); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
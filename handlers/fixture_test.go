@@ -0,0 +1,75 @@
+package handlers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/repository"
+	"github.com/rovilay/auth-service/utils"
+	"github.com/rs/zerolog"
+)
+
+const testJwtSecret = "test-secret"
+
+// fixture is a memory repository with one user and a JWT of that user.
+type fixture struct {
+	repo interface {
+		repository.UserRepository
+		repository.TokenRepository
+		repository.SessionRepository
+	}
+	user *models.User
+	jwt  string
+}
+
+// newFixture creates the user Jane Doe with id and email. The JWT secret of
+// the tests is set globally, handlers must be configured with it.
+func newFixture(t *testing.T, id uuid.UUID, email string) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	config.Config.JwtSecret = testJwtSecret
+
+	repo := repository.NewMemoryRepository(&logger)
+	user := &models.User{
+		ID:        id,
+		Firstname: "Jane",
+		Lastname:  "Doe",
+		Username:  "jane",
+		Email:     email,
+		Password:  "s3cret-password",
+	}
+	if err := repo.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	jwt, err := utils.GenerateJWT(ctx, user)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+
+	return &fixture{repo: repo, user: user, jwt: jwt}
+}
+
+// createAccessToken stores a personal access token of the user with scopes and
+// returns it.
+func (f *fixture) createAccessToken(t *testing.T, scopes ...string) (*models.AccessToken, string) {
+	t.Helper()
+
+	secret := models.AccessTokenPrefix + uuid.NewString()
+	token := &models.AccessToken{
+		ID:        uuid.New(),
+		UserID:    &f.user.ID,
+		Name:      "test",
+		TokenHash: utils.HashToken(secret),
+		Scopes:    scopes,
+	}
+	if err := f.repo.CreateAccessToken(context.Background(), token); err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	return token, secret
+}
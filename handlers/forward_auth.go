@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/logging"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/utils"
+)
+
+// The identity headers set on successful forward auth responses. Proxies
+// copy them to the upstream request and must drop the ones sent by clients.
+const (
+	HeaderAuthUserID = "X-Auth-User-Id"
+	HeaderAuthEmail  = "X-Auth-Email"
+	HeaderAuthRoles  = "X-Auth-Roles"
+)
+
+// RoleAdmin is the forward auth role of the users listed in ADMIN_USER_IDS.
+// Every principal also has the role of its type, user or service_account.
+const RoleAdmin = "admin"
+
+// ForwardAuthRequest describes the original request a proxy asks about.
+type ForwardAuthRequest struct {
+	Method string
+	// URI is the path of the original request, optionally with a query.
+	URI string
+	// Authorization is the Authorization header of the original request.
+	Authorization string
+	// Cookie is the Cookie header of the original request. Without an
+	// Authorization header its session cookie is used when sessions are
+	// enabled.
+	Cookie string
+	// CSRFToken is the HeaderCSRFToken of the original request, which
+	// sessions need for unsafe methods.
+	CSRFToken string
+}
+
+// ForwardAuthIdentity is who made an allowed request.
+type ForwardAuthIdentity struct {
+	Principal *models.Principal
+	// Email is empty for service accounts.
+	Email string
+	// Roles are the principal type and, for the users in ADMIN_USER_IDS,
+	// RoleAdmin.
+	Roles []string
+}
+
+// Headers returns the identity headers to pass upstream.
+func (id *ForwardAuthIdentity) Headers() http.Header {
+	header := http.Header{}
+	header.Set(HeaderAuthUserID, id.Principal.ID.String())
+	header.Set(HeaderAuthRoles, strings.Join(id.Roles, ","))
+	if id.Email != "" {
+		header.Set(HeaderAuthEmail, id.Email)
+	}
+	return header
+}
+
+// AuthorizeForward authenticates the original request like the API does and
+// applies the policy of its path from FORWARD_AUTH_RULES. The identity is nil
+// for unauthenticated requests to public paths. Requests that aren't allowed
+// fail with an authentication error, see AuthenticationError, or
+// utils.ErrForbidden. The business logic of forward auth is shared by the
+// HTTP endpoint and the Envoy ext_authz service.
+func (h *UserHandler) AuthorizeForward(ctx context.Context, req ForwardAuthRequest) (*ForwardAuthIdentity, error) {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	policy := h.forwardAuthPolicy(req.URI)
+
+	principal, err := h.authenticateForward(ctx, req, method)
+	if err != nil {
+		if policy == config.ForwardAuthPublic {
+			return nil, nil
+		}
+		return nil, AuthenticationError(err)
+	}
+
+	id := &ForwardAuthIdentity{Principal: principal, Roles: h.principalRoles(principal)}
+
+	if !forwardAuthAllows(policy, principal, id.Roles) {
+		return nil, utils.ErrForbidden
+	}
+
+	if principal.IsUser() {
+		user, err := h.repo.GetUserByIDorEmail(ctx, principal.ID.String())
+		if errors.Is(err, utils.ErrNotFound) {
+			return nil, utils.ErrInvalidToken
+		}
+		if err != nil {
+			return nil, err
+		}
+		id.Email = user.Email
+	}
+
+	return id, nil
+}
+
+// VerifyForwardAuth answers the authentication subrequests of reverse
+// proxies (nginx auth_request, Traefik and Caddy forward_auth). The original
+// request is described by the X-Forwarded-Method and X-Forwarded-Uri headers,
+// or X-Original-Method and X-Original-URI, see AuthorizeForward.
+//
+// Allowed requests get a 200 with the identity headers. Unauthenticated
+// browser requests are redirected to FORWARD_AUTH_LOGIN_URL when it is set,
+// other rejected requests get a 401 or 403 problem.
+func (h *UserHandler) VerifyForwardAuth(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "VerifyForwardAuth").Ctx(r.Context()).Logger()
+	w.Header().Set("Cache-Control", "no-store")
+
+	req := ForwardAuthRequest{
+		Method:        firstHeader(r, "X-Forwarded-Method", "X-Original-Method"),
+		URI:           firstHeader(r, "X-Forwarded-Uri", "X-Original-URI"),
+		Authorization: r.Header.Get("Authorization"),
+		Cookie:        r.Header.Get("Cookie"),
+		CSRFToken:     r.Header.Get(HeaderCSRFToken),
+	}
+
+	id, err := h.AuthorizeForward(r.Context(), req)
+	switch {
+	case err == nil:
+	case isAuthenticationError(err):
+		if loginURL := h.forwardAuthLoginURL(r, req); loginURL != "" {
+			http.Redirect(w, r, loginURL, http.StatusFound)
+			return
+		}
+		ErrUnauthorized(w, r, err)
+		return
+	default:
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	if id != nil {
+		for name, values := range id.Headers() {
+			w.Header()[name] = values
+		}
+		logging.SetUserID(r.Context(), id.Principal.ID.String())
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticateForward authenticates the original request like authenticate,
+// access tokens need the scope of its method.
+func (h *UserHandler) authenticateForward(ctx context.Context, req ForwardAuthRequest, method string) (*models.Principal, error) {
+	if req.Authorization == "" && h.sessions != nil {
+		if sessionToken, ok := cookieValue(req.Cookie, h.config.SessionCookieName); ok {
+			session, err := h.authenticateSession(ctx, sessionToken, method, req.CSRFToken)
+			if err != nil {
+				return nil, err
+			}
+			return &models.Principal{ID: session.UserID, Type: models.PrincipalUser}, nil
+		}
+	}
+
+	if req.Authorization == "" {
+		return nil, utils.ErrMissingAuthToken
+	}
+
+	tokenString, err := utils.ExtractToken(req.Authorization)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.AuthenticateToken(ctx, tokenString, requiredScope(method))
+}
+
+// principalRoles returns the type of the principal and, for the users in
+// ADMIN_USER_IDS, RoleAdmin.
+func (h *UserHandler) principalRoles(principal *models.Principal) []string {
+	roles := []string{principal.Type}
+	if principal.IsUser() && h.config.IsAdmin(principal.ID.String()) {
+		roles = append(roles, RoleAdmin)
+	}
+	return roles
+}
+
+// isAuthenticationError reports whether err is one of the errors
+// AuthenticationError normalizes to.
+func isAuthenticationError(err error) bool {
+	return errors.Is(err, utils.ErrMissingAuthToken) || errors.Is(err, utils.ErrUserUnAuthorized) ||
+		errors.Is(err, utils.ErrInvalidAccessToken) || errors.Is(err, utils.ErrInsufficientScope) ||
+		errors.Is(err, utils.ErrInvalidToken) || errors.Is(err, utils.ErrInvalidSession) ||
+		errors.Is(err, utils.ErrInvalidCSRFToken)
+}
+
+// forwardAuthPolicy returns the policy of the longest rule matching the path
+// of uri, ForwardAuthUser when none does. The path is cleaned first so that
+// dot segments can't escape a rule.
+func (h *UserHandler) forwardAuthPolicy(uri string) string {
+	policy, longest := config.ForwardAuthUser, -1
+
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return policy
+	}
+	p := path.Clean(u.Path)
+
+	for _, rule := range h.config.ForwardAuthRules {
+		if matchesPattern(rule.Pattern, p) && len(rule.Pattern) > longest {
+			policy, longest = rule.Policy, len(rule.Pattern)
+		}
+	}
+	return policy
+}
+
+// matchesPattern reports whether p is pattern or, for patterns ending with *,
+// starts with its prefix. /admin/* also matches /admin.
+func matchesPattern(pattern, p string) bool {
+	prefix, wildcard := strings.CutSuffix(pattern, "*")
+	if !wildcard {
+		return p == pattern
+	}
+	return strings.HasPrefix(p, prefix) || p == strings.TrimSuffix(prefix, "/")
+}
+
+func forwardAuthAllows(policy string, principal *models.Principal, roles []string) bool {
+	switch policy {
+	case config.ForwardAuthPublic, config.ForwardAuthAuthenticated:
+		return true
+	case config.ForwardAuthAdmin:
+		for _, role := range roles {
+			if role == RoleAdmin {
+				return true
+			}
+		}
+		return false
+	default:
+		return principal.IsUser()
+	}
+}
+
+// forwardAuthLoginURL returns where to send a browser that isn't logged in,
+// with the original URL in the rd query param. It is empty when no login URL
+// is configured or the request doesn't come from a browser navigating to a
+// page.
+func (h *UserHandler) forwardAuthLoginURL(r *http.Request, req ForwardAuthRequest) string {
+	if h.config.ForwardAuthLoginURL == "" || (req.Method != "" && req.Method != http.MethodGet && req.Method != http.MethodHead) {
+		return ""
+	}
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return ""
+	}
+
+	loginURL, err := url.Parse(h.config.ForwardAuthLoginURL)
+	if err != nil {
+		return ""
+	}
+
+	original := req.URI
+	if host := r.Header.Get("X-Forwarded-Host"); host != "" {
+		proto := r.Header.Get("X-Forwarded-Proto")
+		if proto == "" {
+			proto = "https"
+		}
+		original = proto + "://" + host + req.URI
+	}
+
+	if original != "" {
+		query := loginURL.Query()
+		query.Set("rd", original)
+		loginURL.RawQuery = query.Encode()
+	}
+	return loginURL.String()
+}
+
+// cookieValue returns the value of the cookie name in a Cookie header.
+func cookieValue(header, name string) (string, bool) {
+	r := http.Request{Header: http.Header{"Cookie": {header}}}
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+func firstHeader(r *http.Request, names ...string) string {
+	for _, name := range names {
+		if value := r.Header.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
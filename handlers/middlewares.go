@@ -2,10 +2,14 @@ package handlers
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/rovilay/auth-service/logging"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/problem"
 	"github.com/rovilay/auth-service/utils"
 )
 
@@ -13,39 +17,169 @@ type contextKey string
 
 var userIDKey contextKey = "userID"
 
+// PrincipalFromContext returns the authenticated principal of the request, if
+// any. It is the actor to record for anything the request changes.
+func PrincipalFromContext(ctx context.Context) (*models.Principal, bool) {
+	return models.PrincipalFromContext(ctx)
+}
+
+// MiddlewareAuth authenticates the request and only lets users access their
+// own resources, i.e. routes whose {id} param matches the token's user.
 func (h *UserHandler) MiddlewareAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authString := r.Header.Get("Authorization")
-		if authString == "" {
-			ErrUnauthorized(w, utils.ErrMissingAuthToken)
-			return
-		}
-
-		tokenString, err := utils.ExtractToken(authString)
-		if err != nil {
-			ErrUnauthorized(w, err)
-			return
-		}
-
-		userID, err := utils.ValidateJWT(tokenString)
+		principal, err := h.authenticateUser(r)
 		if err != nil {
-			ErrUnauthorized(w, err)
+			ErrUnauthorized(w, r, err)
 			return
 		}
 
+		userID := principal.ID.String()
 		paramID := chi.URLParam(r, "id")
 		if paramID != userID {
-			ErrUnauthorized(w, utils.ErrUserUnAuthorized)
+			ErrUnauthorized(w, r, utils.ErrUserUnAuthorized)
 			return
 		}
 
 		ctx := context.WithValue(r.Context(), userIDKey, userID)
+		ctx = models.ContextWithPrincipal(ctx, principal)
+		logging.SetUserID(ctx, principal.ID.String())
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// ErrUnauthorized is a helper for consistent unauthorized responses
-func ErrUnauthorized(w http.ResponseWriter, err error) {
-	errRes := fmt.Sprintf(`{"error": "%v"}`, err.Error())
-	http.Error(w, errRes, http.StatusUnauthorized)
+// MiddlewareAuthenticate authenticates the request without tying it to a
+// user route param. Authorization is left to the handler.
+func (h *UserHandler) MiddlewareAuthenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := h.authenticateUser(r)
+		if err != nil {
+			ErrUnauthorized(w, r, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userIDKey, principal.ID.String())
+		ctx = models.ContextWithPrincipal(ctx, principal)
+		logging.SetUserID(ctx, principal.ID.String())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticateUser is like authenticate but rejects service accounts. The
+// user routes are only meant for humans.
+func (h *UserHandler) authenticateUser(r *http.Request) (*models.Principal, error) {
+	principal, err := h.authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !principal.IsUser() {
+		return nil, utils.ErrUserUnAuthorized
+	}
+
+	return principal, nil
+}
+
+// authenticate authenticates the bearer token of the request or, without an
+// Authorization header, its session cookie when sessions are enabled.
+func (h *UserHandler) authenticate(r *http.Request) (*models.Principal, error) {
+	if r.Header.Get("Authorization") == "" && h.sessions != nil {
+		if cookie, err := r.Cookie(h.config.SessionCookieName); err == nil {
+			session, err := h.authenticateSession(r.Context(), cookie.Value, r.Method, r.Header.Get(HeaderCSRFToken))
+			if err != nil {
+				return nil, err
+			}
+			return &models.Principal{ID: session.UserID, Type: models.PrincipalUser}, nil
+		}
+	}
+
+	tokenString, err := requestToken(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.AuthenticateToken(r.Context(), tokenString, requiredScope(r.Method))
+}
+
+// requestToken returns the bearer token of the request.
+func requestToken(r *http.Request) (string, error) {
+	authString := r.Header.Get("Authorization")
+	if authString == "" {
+		return "", utils.ErrMissingAuthToken
+	}
+
+	return utils.ExtractToken(authString)
+}
+
+// requiredScope is the access token scope needed for method. Safe methods
+// need the read scope, everything else the write scope.
+func requiredScope(method string) string {
+	if isSafeMethod(method) {
+		return models.ScopeRead
+	}
+	return models.ScopeWrite
+}
+
+// isSafeMethod reports whether method doesn't change anything, see RFC 9110.
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// AuthenticateToken returns the principal of a JWT or personal access token.
+// Access tokens must have scope, unless it is empty.
+func (h *UserHandler) AuthenticateToken(ctx context.Context, tokenString, scope string) (*models.Principal, error) {
+	if strings.HasPrefix(tokenString, models.AccessTokenPrefix) {
+		return h.authenticateAccessToken(ctx, tokenString, scope)
+	}
+
+	return utils.ParseJWT(tokenString)
+}
+
+// authenticateAccessToken looks the personal access token up on every request
+// so that revoking it takes effect immediately.
+func (h *UserHandler) authenticateAccessToken(ctx context.Context, tokenString, scope string) (*models.Principal, error) {
+	if h.tokens == nil {
+		return nil, utils.ErrInvalidAccessToken
+	}
+
+	token, err := h.tokens.GetAccessTokenByHash(ctx, utils.HashToken(tokenString))
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.IsActive() {
+		return nil, utils.ErrInvalidAccessToken
+	}
+
+	if scope != "" && !token.Scopes.Has(scope) {
+		return nil, utils.ErrInsufficientScope
+	}
+
+	if err := h.tokens.TouchAccessToken(ctx, token.ID); err != nil {
+		h.log.Err(err).Str("token_id", token.ID.String()).Msg("failed to update token last used time")
+	}
+
+	owner := token.Owner()
+	return &owner, nil
+}
+
+// ErrUnauthorized is a helper for consistent unauthorized responses, see
+// AuthenticationError.
+func ErrUnauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	writeProblem(w, r, problem.New(AuthenticationError(err), http.StatusUnauthorized, "", problem.Language(r)))
+}
+
+// AuthenticationError normalizes the error of a failed authentication. Errors
+// other than the authentication errors, e.g. from parsing the JWT, are
+// reported as an invalid token.
+func AuthenticationError(err error) error {
+	switch {
+	case errors.Is(err, utils.ErrMissingAuthToken), errors.Is(err, utils.ErrUserUnAuthorized),
+		errors.Is(err, utils.ErrInvalidAccessToken), errors.Is(err, utils.ErrInsufficientScope),
+		errors.Is(err, utils.ErrInvalidSession), errors.Is(err, utils.ErrInvalidCSRFToken):
+		return err
+	case errors.Is(err, utils.ErrAccessTokenNotFound):
+		return utils.ErrInvalidAccessToken
+	default:
+		return utils.ErrInvalidToken
+	}
 }
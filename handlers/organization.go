@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/mailer"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/repository"
+	"github.com/rovilay/auth-service/utils"
+	"github.com/rs/zerolog"
+)
+
+var membershipKey contextKey = "membership"
+
+type OrganizationHandler struct {
+	repo   repository.OrganizationRepository
+	users  repository.UserRepository
+	mailer mailer.Mailer
+	config *config.AppConfig
+	log    *zerolog.Logger
+}
+
+func NewOrganizationHandler(
+	repo repository.OrganizationRepository,
+	users repository.UserRepository,
+	m mailer.Mailer,
+	c *config.AppConfig,
+	l *zerolog.Logger,
+) *OrganizationHandler {
+	logger := l.With().Str("handlers", "OrganizationHandler").Logger()
+
+	return &OrganizationHandler{
+		repo:   repo,
+		users:  users,
+		mailer: m,
+		config: c,
+		log:    &logger,
+	}
+}
+
+// MiddlewareOrgAdmin only lets owners and admins of the {orgID} organization
+// through. It must run after MiddlewareAuthenticate.
+func (h *OrganizationHandler) MiddlewareOrgAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := h.log.With().Str("middleware", "MiddlewareOrgAdmin").Ctx(r.Context()).Logger()
+		userID := r.Context().Value(userIDKey).(string)
+
+		membership, err := h.repo.GetMembership(r.Context(), chi.URLParam(r, "orgID"), userID)
+		if err != nil {
+			sendError(w, r, err, "", 0, &log)
+			return
+		}
+
+		if !membership.IsAdmin() {
+			sendError(w, r, utils.ErrForbidden, "", 0, &log)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), membershipKey, membership)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (h *OrganizationHandler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "CreateOrganization").Ctx(r.Context()).Logger()
+	userID := r.Context().Value(userIDKey).(string)
+
+	var input models.CreateOrganizationInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, &log)
+		return
+	}
+
+	if err := validate.Struct(input); err != nil {
+		sendError(w, r, err, "", http.StatusBadRequest, &log)
+		return
+	}
+
+	org := &models.Organization{
+		ID:   uuid.New(),
+		Name: input.Name,
+	}
+
+	err := h.repo.CreateOrganization(r.Context(), org, uuid.MustParse(userID))
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+
+	if err = json.NewEncoder(w).Encode(org); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+func (h *OrganizationHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "CreateInvitation").Ctx(r.Context()).Logger()
+	membership := r.Context().Value(membershipKey).(*models.Membership)
+
+	var input models.CreateInvitationInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, &log)
+		return
+	}
+
+	if err := validate.Struct(input); err != nil {
+		sendError(w, r, err, "", http.StatusBadRequest, &log)
+		return
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		sendError(w, r, err, utils.ErrTokenGeneration.Error(), 0, &log)
+		return
+	}
+
+	invitation := &models.Invitation{
+		ID:             uuid.New(),
+		OrganizationID: membership.OrganizationID,
+		Email:          strings.ToLower(input.Email),
+		Role:           input.Role,
+		InvitedBy:      membership.UserID,
+		TokenHash:      utils.HashToken(token),
+		ExpiresAt:      time.Now().Add(h.config.InvitationTTL),
+	}
+
+	err = h.repo.CreateInvitation(r.Context(), invitation)
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	h.sendInvitation(r.Context(), invitation, token, &log)
+
+	w.WriteHeader(http.StatusCreated)
+
+	if err = json.NewEncoder(w).Encode(invitation); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+func (h *OrganizationHandler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "ListInvitations").Ctx(r.Context()).Logger()
+	membership := r.Context().Value(membershipKey).(*models.Membership)
+
+	invitations, err := h.repo.ListPendingInvitations(r.Context(), membership.OrganizationID.String())
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(invitations); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+// ResendInvitation issues a new token with a fresh expiry, which invalidates
+// the previously sent link, and emails it again.
+func (h *OrganizationHandler) ResendInvitation(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "ResendInvitation").Ctx(r.Context()).Logger()
+	membership := r.Context().Value(membershipKey).(*models.Membership)
+
+	invitation, err := h.repo.GetInvitation(r.Context(), membership.OrganizationID.String(), chi.URLParam(r, "invitationID"))
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		sendError(w, r, err, utils.ErrTokenGeneration.Error(), 0, &log)
+		return
+	}
+
+	invitation, err = h.repo.RenewInvitation(
+		r.Context(), invitation.ID.String(), utils.HashToken(token), time.Now().Add(h.config.InvitationTTL),
+	)
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	h.sendInvitation(r.Context(), invitation, token, &log)
+
+	if err = json.NewEncoder(w).Encode(invitation); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+func (h *OrganizationHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "RevokeInvitation").Ctx(r.Context()).Logger()
+	membership := r.Context().Value(membershipKey).(*models.Membership)
+
+	err := h.repo.RevokeInvitation(r.Context(), membership.OrganizationID.String(), chi.URLParam(r, "invitationID"))
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AcceptInvitation links an existing account to the organization the
+// invitation was sent for. New users accept invitations through Signup.
+func (h *OrganizationHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "AcceptInvitation").Ctx(r.Context()).Logger()
+	userID := r.Context().Value(userIDKey).(string)
+
+	var input models.AcceptInvitationInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, &log)
+		return
+	}
+
+	if err := validate.Struct(input); err != nil {
+		sendError(w, r, err, "", http.StatusBadRequest, &log)
+		return
+	}
+
+	invitation, err := h.repo.GetInvitationByTokenHash(r.Context(), utils.HashToken(input.Token))
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	user, err := h.users.GetUserByIDorEmail(r.Context(), userID)
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	if !invitation.IsPending() || !strings.EqualFold(invitation.Email, user.Email) {
+		sendError(w, r, utils.ErrInvalidInvitation, "", 0, &log)
+		return
+	}
+
+	err = h.repo.AcceptInvitation(r.Context(), invitation.ID.String(), user.ID)
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	membership, err := h.repo.GetMembership(r.Context(), invitation.OrganizationID.String(), userID)
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(membership); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+func (h *OrganizationHandler) sendInvitation(ctx context.Context, invitation *models.Invitation, token string, log *zerolog.Logger) {
+	org, err := h.repo.GetOrganization(ctx, invitation.OrganizationID.String())
+	if err != nil {
+		log.Err(err).Msg("failed to load organization for invitation email")
+		return
+	}
+
+	accept := "Sign up or accept the invitation with this token: " + token
+	if h.config.InvitationURL != "" {
+		link, err := h.invitationLink(token)
+		if err != nil {
+			log.Err(err).Msg("invalid INVITATION_URL")
+		} else {
+			accept = "Accept the invitation: " + link
+		}
+	}
+
+	msg := mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You have been invited to join %s", org.Name),
+		Body: fmt.Sprintf(
+			"You have been invited to join %s as %s.\n\n%s\n\nThe invitation expires on %s.",
+			org.Name, invitation.Role, accept, invitation.ExpiresAt.Format(time.RFC1123),
+		),
+	}
+
+	if err := h.mailer.Send(ctx, msg); err != nil {
+		log.Err(err).Str("invitation_id", invitation.ID.String()).Msg("failed to send invitation email")
+	}
+}
+
+// invitationLink is INVITATION_URL with the token in the token query
+// parameter. The page there signs up with the token or accepts it for the
+// logged in user, the API has no page to link to.
+func (h *OrganizationHandler) invitationLink(token string) (string, error) {
+	link, err := url.Parse(h.config.InvitationURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
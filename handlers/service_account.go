@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/repository"
+	"github.com/rovilay/auth-service/utils"
+	"github.com/rs/zerolog"
+)
+
+var serviceAccountKey contextKey = "serviceAccount"
+
+type ServiceAccountHandler struct {
+	repo   repository.ServiceAccountRepository
+	tokens repository.TokenRepository
+	config *config.AppConfig
+	log    *zerolog.Logger
+}
+
+func NewServiceAccountHandler(repo repository.ServiceAccountRepository, c *config.AppConfig, l *zerolog.Logger) *ServiceAccountHandler {
+	logger := l.With().Str("handlers", "ServiceAccountHandler").Logger()
+
+	// access tokens are optional, accounts can still use client credentials
+	tokens, _ := repo.(repository.TokenRepository)
+
+	return &ServiceAccountHandler{
+		repo:   repo,
+		tokens: tokens,
+		config: c,
+		log:    &logger,
+	}
+}
+
+// MiddlewareServiceAccountOwner loads the {accountID} service account and
+// checks it belongs to the user or organization of the route. It must run
+// after MiddlewareAuth or MiddlewareOrgAdmin.
+func (h *ServiceAccountHandler) MiddlewareServiceAccountOwner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := h.log.With().Str("middleware", "MiddlewareServiceAccountOwner").Ctx(r.Context()).Logger()
+
+		account, err := h.repo.GetServiceAccount(r.Context(), chi.URLParam(r, "accountID"))
+		if err != nil {
+			sendError(w, r, err, "", 0, &log)
+			return
+		}
+
+		userID, orgID := serviceAccountOwner(r.Context())
+		if (userID != nil && (account.OwnerUserID == nil || *account.OwnerUserID != *userID)) ||
+			(orgID != nil && (account.OwnerOrganizationID == nil || *account.OwnerOrganizationID != *orgID)) {
+			sendError(w, r, utils.ErrServiceAccountNotFound, "", 0, &log)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), serviceAccountKey, account)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (h *ServiceAccountHandler) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "CreateServiceAccount").Ctx(r.Context()).Logger()
+
+	var input models.CreateServiceAccountInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, &log)
+		return
+	}
+
+	if err := validate.Struct(input); err != nil {
+		sendError(w, r, err, "", http.StatusBadRequest, &log)
+		return
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		sendError(w, r, err, utils.ErrTokenGeneration.Error(), 0, &log)
+		return
+	}
+
+	userID, orgID := serviceAccountOwner(r.Context())
+	account := &models.ServiceAccount{
+		ID:                  uuid.New(),
+		Name:                input.Name,
+		Description:         input.Description,
+		OwnerUserID:         userID,
+		OwnerOrganizationID: orgID,
+		ClientSecretHash:    utils.HashToken(secret),
+	}
+
+	err = h.repo.CreateServiceAccount(r.Context(), account)
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	h.logActor(r.Context(), &log).Str("service_account_id", account.ID.String()).Msg("service account created")
+
+	res := &models.ServiceAccountCredentialsResponse{
+		ServiceAccount: *account,
+		ClientID:       account.ID.String(),
+		ClientSecret:   secret,
+	}
+
+	w.WriteHeader(http.StatusCreated)
+
+	if err = json.NewEncoder(w).Encode(res); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+func (h *ServiceAccountHandler) ListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "ListServiceAccounts").Ctx(r.Context()).Logger()
+
+	var accounts []models.ServiceAccount
+	var err error
+
+	userID, orgID := serviceAccountOwner(r.Context())
+	if orgID != nil {
+		accounts, err = h.repo.ListOrganizationServiceAccounts(r.Context(), orgID.String())
+	} else {
+		accounts, err = h.repo.ListUserServiceAccounts(r.Context(), userID.String())
+	}
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(accounts); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+func (h *ServiceAccountHandler) GetServiceAccount(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "GetServiceAccount").Ctx(r.Context()).Logger()
+	account := r.Context().Value(serviceAccountKey).(*models.ServiceAccount)
+
+	if err := json.NewEncoder(w).Encode(account); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+func (h *ServiceAccountHandler) DeleteServiceAccount(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "DeleteServiceAccount").Ctx(r.Context()).Logger()
+	account := r.Context().Value(serviceAccountKey).(*models.ServiceAccount)
+
+	err := h.repo.DeleteServiceAccount(r.Context(), account.ID.String())
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	h.logActor(r.Context(), &log).Str("service_account_id", account.ID.String()).Msg("service account deleted")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RotateServiceAccountSecret replaces the client secret. Tokens already issued
+// with the old secret stay valid until they expire.
+func (h *ServiceAccountHandler) RotateServiceAccountSecret(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "RotateServiceAccountSecret").Ctx(r.Context()).Logger()
+	account := r.Context().Value(serviceAccountKey).(*models.ServiceAccount)
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		sendError(w, r, err, utils.ErrTokenGeneration.Error(), 0, &log)
+		return
+	}
+
+	err = h.repo.UpdateServiceAccountSecret(r.Context(), account.ID.String(), utils.HashToken(secret))
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	h.logActor(r.Context(), &log).Str("service_account_id", account.ID.String()).Msg("service account secret rotated")
+
+	res := &models.ServiceAccountCredentialsResponse{
+		ServiceAccount: *account,
+		ClientID:       account.ID.String(),
+		ClientSecret:   secret,
+	}
+
+	if err = json.NewEncoder(w).Encode(res); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+func (h *ServiceAccountHandler) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "CreateAccessToken").Ctx(r.Context()).Logger()
+	account := r.Context().Value(serviceAccountKey).(*models.ServiceAccount)
+
+	createAccessToken(w, r, h.tokens, account.Principal(), &log)
+}
+
+func (h *ServiceAccountHandler) ListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "ListAccessTokens").Ctx(r.Context()).Logger()
+	account := r.Context().Value(serviceAccountKey).(*models.ServiceAccount)
+
+	listAccessTokens(w, r, h.tokens, account.Principal(), &log)
+}
+
+func (h *ServiceAccountHandler) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "RevokeAccessToken").Ctx(r.Context()).Logger()
+	account := r.Context().Value(serviceAccountKey).(*models.ServiceAccount)
+
+	revokeAccessToken(w, r, h.tokens, account.Principal(), &log)
+}
+
+// Token implements the OAuth 2.0 client credentials grant. Credentials are
+// read from HTTP basic auth or the client_id and client_secret form fields.
+func (h *ServiceAccountHandler) Token(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "Token").Ctx(r.Context()).Logger()
+
+	if err := r.ParseForm(); err != nil {
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, &log)
+		return
+	}
+
+	if grantType := r.PostForm.Get("grant_type"); grantType != "client_credentials" {
+		sendError(w, r, utils.ErrUnsupportedGrantType, "", 0, &log)
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	account, err := h.repo.GetServiceAccount(r.Context(), clientID)
+	if err != nil {
+		sendError(w, r, utils.ErrInvalidClientCredentials, "", 0, &log)
+		return
+	}
+
+	secretHash := utils.HashToken(clientSecret)
+	if subtle.ConstantTimeCompare([]byte(secretHash), []byte(account.ClientSecretHash)) != 1 {
+		sendError(w, r, utils.ErrInvalidClientCredentials, "", 0, &log)
+		return
+	}
+
+	token, err := utils.GenerateServiceAccountJWT(r.Context(), account.ID, h.config.ServiceAccountTokenTTL)
+	if err != nil {
+		sendError(w, r, err, "error generating token", 0, &log)
+		return
+	}
+
+	res := &models.ClientCredentialsResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(h.config.ServiceAccountTokenTTL.Seconds()),
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err = json.NewEncoder(w).Encode(res); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+// logActor starts a log event that records who performed a service account
+// change.
+func (h *ServiceAccountHandler) logActor(ctx context.Context, log *zerolog.Logger) *zerolog.Event {
+	event := log.Info()
+	if principal, ok := PrincipalFromContext(ctx); ok {
+		event = event.Str("actor_type", principal.Type).Str("actor_id", principal.ID.String())
+	}
+	return event
+}
+
+// serviceAccountOwner returns the owner implied by the route: the organization
+// when the request went through MiddlewareOrgAdmin, the user otherwise.
+func serviceAccountOwner(ctx context.Context) (*uuid.UUID, *uuid.UUID) {
+	if membership, ok := ctx.Value(membershipKey).(*models.Membership); ok {
+		orgID := membership.OrganizationID
+		return nil, &orgID
+	}
+
+	userID := uuid.MustParse(ctx.Value(userIDKey).(string))
+	return &userID, nil
+}
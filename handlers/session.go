@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/logging"
+	"github.com/rovilay/auth-service/metrics"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/utils"
+)
+
+// HeaderCSRFToken carries the CSRF token of the session on requests that
+// change something.
+const HeaderCSRFToken = "X-CSRF-Token"
+
+// sessionTouchInterval limits how often the activity of a session is written,
+// the idle expiry slides in steps of this interval.
+const sessionTouchInterval = time.Minute
+
+// StartSession checks the credentials like LoginUser and starts a browser
+// session for the user. It returns the session with its CSRF token and the
+// session ID to set in the cookie. Both are only stored hashed.
+func (h *UserHandler) StartSession(ctx context.Context, input models.LoginInput, userAgent, ipAddress string) (*models.CreateSessionResponse, string, error) {
+	user, err := h.checkCredentials(ctx, input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessionToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	sessionToken = models.SessionTokenPrefix + sessionToken
+
+	csrfToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:            uuid.New(),
+		UserID:        user.ID,
+		TokenHash:     utils.HashToken(sessionToken),
+		CSRFTokenHash: utils.HashToken(csrfToken),
+		UserAgent:     userAgent,
+		IPAddress:     ipAddress,
+		IdleExpiresAt: now.Add(min(h.config.SessionIdleTimeout, h.config.SessionMaxAge)),
+		ExpiresAt:     now.Add(h.config.SessionMaxAge),
+	}
+	if err := h.sessions.CreateSession(ctx, &session); err != nil {
+		metrics.LoginFailures.WithLabelValues(metrics.LoginError).Inc()
+		return nil, "", err
+	}
+	metrics.LoginSuccesses.Inc()
+
+	return &models.CreateSessionResponse{Session: session, CSRFToken: csrfToken}, sessionToken, nil
+}
+
+// authenticateSession returns the active session of the session ID from the
+// cookie. Requests with unsafe methods must send the session's CSRF token in
+// HeaderCSRFToken, csrfToken is its value. Activity extends the idle expiry up
+// to the absolute one.
+func (h *UserHandler) authenticateSession(ctx context.Context, sessionToken, method, csrfToken string) (*models.Session, error) {
+	session, err := h.sessions.GetSessionByTokenHash(ctx, utils.HashToken(sessionToken))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !session.IsActive(now) {
+		return nil, utils.ErrInvalidSession
+	}
+
+	if !isSafeMethod(method) {
+		if csrfToken == "" || subtle.ConstantTimeCompare([]byte(utils.HashToken(csrfToken)), []byte(session.CSRFTokenHash)) != 1 {
+			return nil, utils.ErrInvalidCSRFToken
+		}
+	}
+
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		idleExpiresAt := now.Add(h.config.SessionIdleTimeout)
+		if idleExpiresAt.After(session.ExpiresAt) {
+			idleExpiresAt = session.ExpiresAt
+		}
+
+		if err := h.sessions.TouchSession(ctx, session.ID, idleExpiresAt); err != nil {
+			h.log.Err(err).Str("session_id", session.ID.String()).Msg("failed to update session activity")
+		} else {
+			session.LastSeenAt, session.IdleExpiresAt = now, idleExpiresAt
+		}
+	}
+
+	return session, nil
+}
+
+// requestSession authenticates the session cookie of the request.
+func (h *UserHandler) requestSession(r *http.Request) (*models.Session, error) {
+	cookie, err := r.Cookie(h.config.SessionCookieName)
+	if err != nil {
+		return nil, utils.ErrMissingAuthToken
+	}
+
+	session, err := h.authenticateSession(r.Context(), cookie.Value, r.Method, r.Header.Get(HeaderCSRFToken))
+	if err != nil {
+		return nil, err
+	}
+
+	logging.SetUserID(r.Context(), session.UserID.String())
+	return session, nil
+}
+
+// CreateSession logs in with email and password like Login, but instead of
+// returning a token it sets an HttpOnly session cookie. The CSRF token is
+// returned and set in a cookie readable by scripts, requests that change
+// something must send it in HeaderCSRFToken.
+func (h *UserHandler) CreateSession(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "CreateSession").Ctx(r.Context()).Logger()
+
+	var input models.LoginInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		metrics.LoginFailures.WithLabelValues(metrics.LoginInvalidRequest).Inc()
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, &log)
+		return
+	}
+
+	res, sessionToken, err := h.StartSession(r.Context(), input, r.UserAgent(), clientIP(r))
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+	logging.SetUserID(r.Context(), res.UserID.String())
+
+	h.setSessionCookies(w, sessionToken, res.CSRFToken, res.ExpiresAt)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Err(err).Msg("failed to encode response")
+	}
+}
+
+// GetSession returns the session of the cookie, e.g. for a frontend to learn
+// the user ID and when the session expires.
+func (h *UserHandler) GetSession(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "GetSession").Ctx(r.Context()).Logger()
+
+	session, err := h.requestSession(r)
+	if err != nil {
+		ErrUnauthorized(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(session); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+	}
+}
+
+// DeleteSession logs out, it revokes the session of the cookie and clears the
+// cookies.
+func (h *UserHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "DeleteSession").Ctx(r.Context()).Logger()
+
+	session, err := h.requestSession(r)
+	if err != nil {
+		ErrUnauthorized(w, r, err)
+		return
+	}
+
+	if err := h.sessions.RevokeSession(r.Context(), session.ID); err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	h.clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// csrfCookieName is the name of the cookie holding the CSRF token, which
+// scripts read to send it in HeaderCSRFToken.
+func (h *UserHandler) csrfCookieName() string {
+	return h.config.SessionCookieName + "_csrf"
+}
+
+func (h *UserHandler) setSessionCookies(w http.ResponseWriter, sessionToken, csrfToken string, expires time.Time) {
+	maxAge := int(time.Until(expires).Seconds())
+
+	http.SetCookie(w, h.sessionCookie(h.config.SessionCookieName, sessionToken, maxAge, true))
+	http.SetCookie(w, h.sessionCookie(h.csrfCookieName(), csrfToken, maxAge, false))
+}
+
+func (h *UserHandler) clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, h.sessionCookie(h.config.SessionCookieName, "", -1, true))
+	http.SetCookie(w, h.sessionCookie(h.csrfCookieName(), "", -1, false))
+}
+
+func (h *UserHandler) sessionCookie(name, value string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   h.config.SessionCookieDomain,
+		MaxAge:   maxAge,
+		Secure:   h.config.SessionCookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: h.config.SessionSameSite,
+	}
+}
+
+// clientIP is the address the request came from, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,214 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/handlers"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/utils"
+	"github.com/rs/zerolog"
+)
+
+const testCSRFToken = "csrf-token"
+
+// newSessionRouter serves the session routes and the password change of the
+// fixture user, with sessions configured like the defaults.
+func newSessionRouter(t *testing.T) (*fixture, http.Handler) {
+	t.Helper()
+	logger := zerolog.Nop()
+	f := newFixture(t, uuid.New(), "jane@example.com")
+
+	c := &config.AppConfig{
+		JwtSecret:           testJwtSecret,
+		Sessions:            true,
+		SessionCookieName:   "session",
+		SessionCookieSecure: true,
+		SessionSameSite:     http.SameSiteLaxMode,
+		SessionIdleTimeout:  30 * time.Minute,
+		SessionMaxAge:       12 * time.Hour,
+	}
+	h := handlers.NewUserHandler(f.repo, c, &logger)
+
+	router := chi.NewRouter()
+	router.Post("/sessions", h.CreateSession)
+	router.Get("/sessions/current", h.GetSession)
+	router.Delete("/sessions/current", h.DeleteSession)
+	router.Group(func(r chi.Router) {
+		r.Use(h.MiddlewareAuth)
+		r.Put("/users/{id}/password", h.UpdatePassword)
+	})
+
+	return f, router
+}
+
+// createSession stores a session of the fixture user expiring at the given
+// times and returns its cookie value.
+func (f *fixture) createSession(t *testing.T, idleExpiresAt, expiresAt time.Time) string {
+	t.Helper()
+
+	token := models.SessionTokenPrefix + uuid.NewString()
+	session := &models.Session{
+		ID:            uuid.New(),
+		UserID:        f.user.ID,
+		TokenHash:     utils.HashToken(token),
+		CSRFTokenHash: utils.HashToken(testCSRFToken),
+		IdleExpiresAt: idleExpiresAt,
+		ExpiresAt:     expiresAt,
+	}
+	if err := f.repo.CreateSession(context.Background(), session); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	return token
+}
+
+func sessionRequest(method, path, sessionToken, csrfToken, body string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.AddCookie(&http.Cookie{Name: "session", Value: sessionToken})
+	if csrfToken != "" {
+		req.Header.Set(handlers.HeaderCSRFToken, csrfToken)
+	}
+	return req
+}
+
+func TestCreateSessionCookies(t *testing.T) {
+	_, router := newSessionRouter(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/sessions", strings.NewReader(`{"email":"jane@example.com","password":"s3cret-password"}`))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range rec.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+
+	tests := []struct {
+		name     string
+		httpOnly bool
+	}{
+		{name: "session", httpOnly: true},
+		{name: "session_csrf", httpOnly: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookie, ok := cookies[tt.name]
+			if !ok {
+				t.Fatalf("cookie %s isn't set", tt.name)
+			}
+			if cookie.Value == "" {
+				t.Error("value is empty")
+			}
+			if cookie.HttpOnly != tt.httpOnly {
+				t.Errorf("HttpOnly = %v, want %v", cookie.HttpOnly, tt.httpOnly)
+			}
+			if !cookie.Secure {
+				t.Error("cookie isn't Secure")
+			}
+			if cookie.SameSite != http.SameSiteLaxMode {
+				t.Errorf("SameSite = %v, want Lax", cookie.SameSite)
+			}
+			if cookie.Path != "/" {
+				t.Errorf("Path = %q, want /", cookie.Path)
+			}
+			// the cookie lives as long as the session at most
+			if maxAge := 12 * time.Hour / time.Second; cookie.MaxAge <= 0 || cookie.MaxAge > int(maxAge) {
+				t.Errorf("MaxAge = %d, want up to %d", cookie.MaxAge, maxAge)
+			}
+		})
+	}
+
+	if !strings.HasPrefix(cookies["session"].Value, models.SessionTokenPrefix) {
+		t.Errorf("session cookie = %q, want the %s prefix", cookies["session"].Value, models.SessionTokenPrefix)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	f, router := newSessionRouter(t)
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		idleExpiresAt time.Time
+		expiresAt     time.Time
+		status        int
+	}{
+		{name: "active", idleExpiresAt: now.Add(time.Minute), expiresAt: now.Add(time.Hour), status: http.StatusOK},
+		{name: "idle", idleExpiresAt: now.Add(-time.Minute), expiresAt: now.Add(time.Hour), status: http.StatusUnauthorized},
+		{name: "absolute", idleExpiresAt: now.Add(time.Minute), expiresAt: now.Add(-time.Minute), status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := f.createSession(t, tt.idleExpiresAt, tt.expiresAt)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, sessionRequest(http.MethodGet, "/sessions/current", token, "", ""))
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestSessionCSRFToken(t *testing.T) {
+	f, router := newSessionRouter(t)
+	password := "/users/" + f.user.ID.String() + "/password"
+	body := `{"password":"s3cret-password","new_password":"s3cret-password"}`
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		csrfToken string
+		status    int
+	}{
+		{name: "safe method without token", method: http.MethodGet, path: "/sessions/current", status: http.StatusOK},
+		{name: "logout without token", method: http.MethodDelete, path: "/sessions/current", status: http.StatusForbidden},
+		{name: "logout with wrong token", method: http.MethodDelete, path: "/sessions/current", csrfToken: "guess", status: http.StatusForbidden},
+		{name: "API without token", method: http.MethodPut, path: password, status: http.StatusForbidden},
+		{name: "API with wrong token", method: http.MethodPut, path: password, csrfToken: "guess", status: http.StatusForbidden},
+		{name: "logout with token", method: http.MethodDelete, path: "/sessions/current", csrfToken: testCSRFToken, status: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := f.createSession(t, time.Now().Add(time.Minute), time.Now().Add(time.Hour))
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, sessionRequest(tt.method, tt.path, token, tt.csrfToken, body))
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestChangePasswordRevokesSessions(t *testing.T) {
+	f, router := newSessionRouter(t)
+	current := f.createSession(t, time.Now().Add(time.Minute), time.Now().Add(time.Hour))
+	other := f.createSession(t, time.Now().Add(time.Minute), time.Now().Add(time.Hour))
+
+	rec := httptest.NewRecorder()
+	body := `{"password":"s3cret-password","new_password":"n3w-password"}`
+	router.ServeHTTP(rec, sessionRequest(http.MethodPut, "/users/"+f.user.ID.String()+"/password", current, testCSRFToken, body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	for _, token := range []string{current, other} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, sessionRequest(http.MethodGet, "/sessions/current", token, "", ""))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/repository"
+	"github.com/rovilay/auth-service/utils"
+	"github.com/rs/zerolog"
+)
+
+func (h *UserHandler) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "CreateAccessToken").Ctx(r.Context()).Logger()
+	userID := r.Context().Value(userIDKey).(string)
+
+	owner := models.Principal{ID: uuid.MustParse(userID), Type: models.PrincipalUser}
+	createAccessToken(w, r, h.tokens, owner, &log)
+}
+
+func (h *UserHandler) ListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "ListAccessTokens").Ctx(r.Context()).Logger()
+	userID := r.Context().Value(userIDKey).(string)
+
+	owner := models.Principal{ID: uuid.MustParse(userID), Type: models.PrincipalUser}
+	listAccessTokens(w, r, h.tokens, owner, &log)
+}
+
+func (h *UserHandler) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "RevokeAccessToken").Ctx(r.Context()).Logger()
+	userID := r.Context().Value(userIDKey).(string)
+
+	owner := models.Principal{ID: uuid.MustParse(userID), Type: models.PrincipalUser}
+	revokeAccessToken(w, r, h.tokens, owner, &log)
+}
+
+// errAccessTokenCredential is the detail of the 403 for requests that manage
+// access tokens with an access token.
+const errAccessTokenCredential = "access tokens can't be managed with an access token"
+
+// authenticatedWithAccessToken reports whether the request was authenticated
+// with a personal access token. Tokens are only managed with a JWT or a
+// session, otherwise a leaked token could mint tokens that outlive it or have
+// more scopes.
+func authenticatedWithAccessToken(r *http.Request) bool {
+	token, err := requestToken(r)
+	return err == nil && strings.HasPrefix(token, models.AccessTokenPrefix)
+}
+
+func createAccessToken(w http.ResponseWriter, r *http.Request, repo repository.TokenRepository, owner models.Principal, log *zerolog.Logger) {
+	if authenticatedWithAccessToken(r) {
+		sendError(w, r, utils.ErrForbidden, errAccessTokenCredential, 0, log)
+		return
+	}
+
+	var input models.CreateAccessTokenInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, log)
+		return
+	}
+
+	if err := validate.Struct(input); err != nil {
+		sendError(w, r, err, "", http.StatusBadRequest, log)
+		return
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		sendError(w, r, err, utils.ErrTokenGeneration.Error(), 0, log)
+		return
+	}
+	secret = models.AccessTokenPrefix + secret
+
+	token := models.AccessToken{
+		ID:        uuid.New(),
+		Name:      input.Name,
+		Prefix:    secret[:len(models.AccessTokenPrefix)+8],
+		TokenHash: utils.HashToken(secret),
+		Scopes:    input.Scopes,
+		ExpiresAt: input.ExpiresAt,
+	}
+	if owner.Type == models.PrincipalServiceAccount {
+		token.ServiceAccountID = &owner.ID
+	} else {
+		token.UserID = &owner.ID
+	}
+
+	err = repo.CreateAccessToken(r.Context(), &token)
+	if err != nil {
+		sendError(w, r, err, "", 0, log)
+		return
+	}
+
+	res := &models.CreateAccessTokenResponse{
+		AccessToken: token,
+		Token:       secret,
+	}
+
+	w.WriteHeader(http.StatusCreated)
+
+	if err = json.NewEncoder(w).Encode(res); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, log)
+		return
+	}
+}
+
+func listAccessTokens(w http.ResponseWriter, r *http.Request, repo repository.TokenRepository, owner models.Principal, log *zerolog.Logger) {
+	tokens, err := repo.ListAccessTokens(r.Context(), owner)
+	if err != nil {
+		sendError(w, r, err, "", 0, log)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(tokens); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, log)
+		return
+	}
+}
+
+func revokeAccessToken(w http.ResponseWriter, r *http.Request, repo repository.TokenRepository, owner models.Principal, log *zerolog.Logger) {
+	if authenticatedWithAccessToken(r) {
+		sendError(w, r, utils.ErrForbidden, errAccessTokenCredential, 0, log)
+		return
+	}
+
+	err := repo.RevokeAccessToken(r.Context(), owner, chi.URLParam(r, "tokenID"))
+	if err != nil {
+		sendError(w, r, err, "", 0, log)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
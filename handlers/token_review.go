@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/utils"
+)
+
+// K8sServiceAccountPrefix prefixes the Kubernetes usernames of service
+// accounts, users are named by their ID.
+const K8sServiceAccountPrefix = "service-account:"
+
+// ReviewToken authenticates a token for Kubernetes and maps its principal to
+// a Kubernetes user. The username is K8S_USERNAME_PREFIX followed by the ID
+// of users or K8sServiceAccountPrefix and the ID of service accounts, since
+// emails can change and RBAC bindings must not follow them. The email of
+// users is passed in the email extra, the groups come from K8S_GROUP_MAPPINGS.
+//
+// Tokens that aren't valid give an unauthenticated status, errors are only
+// returned when the token can't be reviewed. Personal access tokens are
+// accepted with any scope, Kubernetes RBAC decides what the user may do.
+func (h *UserHandler) ReviewToken(ctx context.Context, spec models.TokenReviewSpec) (models.TokenReviewStatus, error) {
+	var audiences []string
+	if len(spec.Audiences) > 0 && len(h.config.K8sAudiences) > 0 {
+		for _, audience := range spec.Audiences {
+			if slices.Contains(h.config.K8sAudiences, audience) {
+				audiences = append(audiences, audience)
+			}
+		}
+		if len(audiences) == 0 {
+			return models.TokenReviewStatus{Error: "token audiences don't match"}, nil
+		}
+	}
+
+	if spec.Token == "" {
+		return models.TokenReviewStatus{Error: utils.ErrMissingAuthToken.Error()}, nil
+	}
+
+	principal, err := h.AuthenticateToken(ctx, spec.Token, "")
+	if err != nil {
+		return models.TokenReviewStatus{Error: AuthenticationError(err).Error()}, nil
+	}
+
+	user := &models.TokenReviewUser{
+		Username: h.config.K8sUsernamePrefix + K8sServiceAccountPrefix + principal.ID.String(),
+		UID:      principal.ID.String(),
+	}
+
+	var memberships []models.Membership
+	if principal.IsUser() {
+		account, err := h.repo.GetUserByIDorEmail(ctx, principal.ID.String())
+		if errors.Is(err, utils.ErrNotFound) {
+			return models.TokenReviewStatus{Error: utils.ErrInvalidToken.Error()}, nil
+		}
+		if err != nil {
+			return models.TokenReviewStatus{}, err
+		}
+		user.Username = h.config.K8sUsernamePrefix + principal.ID.String()
+		user.Extra = map[string][]string{"email": {account.Email}}
+
+		if h.orgs != nil {
+			if memberships, err = h.orgs.ListMemberships(ctx, principal.ID.String()); err != nil {
+				return models.TokenReviewStatus{}, err
+			}
+		}
+	}
+
+	user.Groups = h.k8sGroups(h.principalRoles(principal), memberships)
+
+	return models.TokenReviewStatus{Authenticated: true, User: user, Audiences: audiences}, nil
+}
+
+// k8sGroups returns the groups of the mappings matching one of the roles or
+// memberships, in the order of K8S_GROUP_MAPPINGS.
+func (h *UserHandler) k8sGroups(roles []string, memberships []models.Membership) []string {
+	sources := map[string]bool{}
+	for _, role := range roles {
+		sources["role:"+role] = true
+	}
+	for _, membership := range memberships {
+		sources["org:"+membership.OrganizationID.String()] = true
+		sources["org:"+membership.OrganizationID.String()+":"+membership.Role] = true
+	}
+
+	var groups []string
+	for _, mapping := range h.config.K8sGroupMappings {
+		if sources[mapping.Source] && !slices.Contains(groups, mapping.Group) {
+			groups = append(groups, mapping.Group)
+		}
+	}
+	return groups
+}
+
+// TokenReview implements the Kubernetes webhook token authentication
+// contract, so that kubectl can use the tokens of this service. The API
+// server POSTs a TokenReview and gets it back with its status, see
+// ReviewToken. The API server must send K8S_WEBHOOK_TOKEN as a bearer token,
+// the route is only registered when it is set.
+func (h *UserHandler) TokenReview(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "TokenReview").Ctx(r.Context()).Logger()
+
+	token, err := requestToken(r)
+	if err != nil {
+		ErrUnauthorized(w, r, err)
+		return
+	}
+	if h.config.K8sWebhookToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.config.K8sWebhookToken)) != 1 {
+		ErrUnauthorized(w, r, utils.ErrInvalidToken)
+		return
+	}
+
+	var review models.TokenReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, &log)
+		return
+	}
+	if review.APIVersion != models.TokenReviewAPIVersion || review.Kind != models.TokenReviewKind {
+		err := fmt.Errorf("expected apiVersion %s and kind %s, got %q and %q", models.TokenReviewAPIVersion, models.TokenReviewKind, review.APIVersion, review.Kind)
+		sendError(w, r, malformedBody(err), err.Error(), http.StatusBadRequest, &log)
+		return
+	}
+
+	status, err := h.ReviewToken(r.Context(), review.Spec)
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	if status.Authenticated {
+		log.Info().Str("uid", status.User.UID).Strs("groups", status.User.Groups).Msg("token review authenticated")
+	} else {
+		log.Warn().Str("reason", status.Error).Msg("token review rejected")
+	}
+
+	review.Spec = models.TokenReviewSpec{}
+	review.Status = status
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		log.Err(err).Msg("failed to encode response")
+	}
+}
@@ -0,0 +1,195 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/handlers"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rs/zerolog"
+)
+
+// The user of k8s/fixtures/authenticated.json.
+const (
+	fixtureUserID = "c55c6cde-bcef-4abd-8fae-c5818bd14e30"
+	fixtureEmail  = "jane@example.com"
+)
+
+const testWebhookToken = "webhook-secret"
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("..", "k8s", "fixtures", name))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	return data
+}
+
+func decodeReview(t *testing.T, data []byte) models.TokenReview {
+	t.Helper()
+
+	var review models.TokenReview
+	if err := json.Unmarshal(data, &review); err != nil {
+		t.Fatalf("decode review: %v", err)
+	}
+	return review
+}
+
+// newTokenReviewHandler returns a handler configured like the fixtures expect
+// and a token of the fixture user.
+func newTokenReviewHandler(t *testing.T, c *config.AppConfig) (*handlers.UserHandler, string) {
+	t.Helper()
+	logger := zerolog.Nop()
+	f := newFixture(t, uuid.MustParse(fixtureUserID), fixtureEmail)
+
+	c.JwtSecret = testJwtSecret
+	c.K8sWebhookToken = testWebhookToken
+	c.AdminUserIDs = []string{fixtureUserID}
+	c.K8sUsernamePrefix = "auth:"
+	c.K8sGroupMappings = []config.K8sGroupMapping{
+		{Source: "role:admin", Group: "system:masters"},
+		{Source: "role:user", Group: "developers"},
+		{Source: "role:service_account", Group: "robots"},
+	}
+
+	return handlers.NewUserHandler(f.repo, c, &logger), f.jwt
+}
+
+// postReview POSTs the request fixture with token to the handler.
+func postReview(t *testing.T, h *handlers.UserHandler, token, webhookToken string, audiences ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	review := decodeReview(t, readFixture(t, "request.json"))
+	review.Spec.Token = token
+	review.Spec.Audiences = audiences
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatalf("encode review: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/k8s/tokenreview", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if webhookToken != "" {
+		req.Header.Set("Authorization", "Bearer "+webhookToken)
+	}
+
+	rec := httptest.NewRecorder()
+	h.TokenReview(rec, req)
+	return rec
+}
+
+func TestTokenReviewFixtures(t *testing.T) {
+	h, token := newTokenReviewHandler(t, &config.AppConfig{})
+
+	tests := []struct {
+		name    string
+		token   string
+		fixture string
+	}{
+		{name: "valid token", token: token, fixture: "authenticated.json"},
+		{name: "invalid token", token: "not-a-token", fixture: "unauthenticated.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postReview(t, h, tt.token, testWebhookToken)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+
+			got, want := decodeReview(t, rec.Body.Bytes()), decodeReview(t, readFixture(t, tt.fixture))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("review = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestTokenReviewUsernameAndGroups(t *testing.T) {
+	h, token := newTokenReviewHandler(t, &config.AppConfig{})
+
+	status, err := h.ReviewToken(context.Background(), models.TokenReviewSpec{Token: token})
+	if err != nil {
+		t.Fatalf("ReviewToken: %v", err)
+	}
+	if !status.Authenticated {
+		t.Fatalf("expected the token to be authenticated: %s", status.Error)
+	}
+	if status.User.Username != "auth:"+fixtureUserID {
+		t.Errorf("username = %q, want the prefixed ID", status.User.Username)
+	}
+	if want := map[string][]string{"email": {fixtureEmail}}; !reflect.DeepEqual(status.User.Extra, want) {
+		t.Errorf("extra = %v, want %v", status.User.Extra, want)
+	}
+	if want := []string{"system:masters", "developers"}; !reflect.DeepEqual(status.User.Groups, want) {
+		t.Errorf("groups = %v, want %v", status.User.Groups, want)
+	}
+}
+
+func TestTokenReviewAudiences(t *testing.T) {
+	h, token := newTokenReviewHandler(t, &config.AppConfig{K8sAudiences: []string{"https://kubernetes.default.svc"}})
+
+	tests := []struct {
+		name          string
+		audiences     []string
+		authenticated bool
+		want          []string
+	}{
+		{name: "no audiences", authenticated: true},
+		{
+			name:          "matching audience",
+			audiences:     []string{"https://kubernetes.default.svc", "other"},
+			authenticated: true,
+			want:          []string{"https://kubernetes.default.svc"},
+		},
+		{name: "other audience", audiences: []string{"other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postReview(t, h, token, testWebhookToken, tt.audiences...)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+
+			review := decodeReview(t, rec.Body.Bytes())
+			if review.Status.Authenticated != tt.authenticated {
+				t.Fatalf("authenticated = %v, want %v: %s", review.Status.Authenticated, tt.authenticated, review.Status.Error)
+			}
+			if !reflect.DeepEqual(review.Status.Audiences, tt.want) {
+				t.Errorf("audiences = %v, want %v", review.Status.Audiences, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenReviewWebhookToken(t *testing.T) {
+	h, token := newTokenReviewHandler(t, &config.AppConfig{})
+
+	tests := []struct {
+		name         string
+		webhookToken string
+		status       int
+	}{
+		{name: "missing", status: http.StatusUnauthorized},
+		{name: "wrong", webhookToken: "guess", status: http.StatusUnauthorized},
+		{name: "valid", webhookToken: testWebhookToken, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postReview(t, h, token, tt.webhookToken)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
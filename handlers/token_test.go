@@ -0,0 +1,57 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/handlers"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rs/zerolog"
+)
+
+func TestAccessTokensCantManageTokens(t *testing.T) {
+	logger := zerolog.Nop()
+	f := newFixture(t, uuid.New(), "jane@example.com")
+	existing, pat := f.createAccessToken(t, models.ScopeRead, models.ScopeWrite)
+
+	h := handlers.NewUserHandler(f.repo, &config.AppConfig{JwtSecret: testJwtSecret}, &logger)
+	router := chi.NewRouter()
+	router.Group(func(r chi.Router) {
+		r.Use(h.MiddlewareAuth)
+		r.Get("/users/{id}/tokens", h.ListAccessTokens)
+		r.Post("/users/{id}/tokens", h.CreateAccessToken)
+		r.Delete("/users/{id}/tokens/{tokenID}", h.RevokeAccessToken)
+	})
+
+	tokens := "/users/" + f.user.ID.String() + "/tokens"
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{name: "list with access token", method: http.MethodGet, path: tokens, token: pat, status: http.StatusOK},
+		{name: "create with access token", method: http.MethodPost, path: tokens, token: pat, status: http.StatusForbidden},
+		{name: "revoke with access token", method: http.MethodDelete, path: tokens + "/" + existing.ID.String(), token: pat, status: http.StatusForbidden},
+		{name: "create with JWT", method: http.MethodPost, path: tokens, token: f.jwt, status: http.StatusCreated},
+		{name: "revoke with JWT", method: http.MethodDelete, path: tokens + "/" + existing.ID.String(), token: f.jwt, status: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"name":"ci","scopes":["write"]}`))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
@@ -5,64 +5,75 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"strings"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/logging"
+	"github.com/rovilay/auth-service/metadata"
+	"github.com/rovilay/auth-service/metrics"
 	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/problem"
 	"github.com/rovilay/auth-service/repository"
 	"github.com/rovilay/auth-service/utils"
 	"github.com/rs/zerolog"
 )
 
 type UserHandler struct {
-	repo repository.UserRepository
-	log  *zerolog.Logger
+	repo     repository.UserRepository
+	orgs     repository.OrganizationRepository
+	tokens   repository.TokenRepository
+	sessions repository.SessionRepository
+	metadata *metadata.Validator
+	config   *config.AppConfig
+	log      *zerolog.Logger
 }
 
-func NewUserHandler(repo repository.UserRepository, l *zerolog.Logger) *UserHandler {
+func NewUserHandler(repo repository.UserRepository, c *config.AppConfig, l *zerolog.Logger) *UserHandler {
 	logger := l.With().Str("handlers", "UserHandler").Logger()
 
-	return &UserHandler{
-		repo: repo,
-		log:  &logger,
-	}
-}
-
-var validate = validator.New()
+	// invitations are only available on backends that support organizations
+	orgs, _ := repo.(repository.OrganizationRepository)
+	tokens, _ := repo.(repository.TokenRepository)
 
-func (h *UserHandler) Signup(w http.ResponseWriter, r *http.Request) {
-	log := h.log.With().Str("handler", "Signup").Logger()
-
-	user := &models.User{}
+	var sessions repository.SessionRepository
+	if c.Sessions {
+		sessions, _ = repo.(repository.SessionRepository)
+	}
 
-	err := user.FromJSON(r.Body)
+	validator, err := metadata.NewValidator(c.UserMetadataSchema, c.AdminMetadataSchema)
 	if err != nil {
-		h.sendError(w, err, "failed to read payload", http.StatusBadRequest, &log)
-		return
+		logger.Fatal().Err(err).Msg("[ERROR] failed to load metadata schemas")
 	}
 
-	if user.Username == "" {
-		user.Username = h.generateUniqueUsername(r.Context(), user.Firstname, user.Lastname, &log)
+	return &UserHandler{
+		repo:     repo,
+		orgs:     orgs,
+		tokens:   tokens,
+		sessions: sessions,
+		metadata: validator,
+		config:   c,
+		log:      &logger,
 	}
+}
 
-	// validate user input
-	err = user.Validate()
-	if err != nil {
-		h.sendError(w, err, fmt.Sprintf("Error validating payload: %s", err), http.StatusBadRequest, &log)
-		return
-	}
+var validate = models.NewValidator()
 
-	user.ID = uuid.New()
-	err = h.repo.CreateUser(r.Context(), user)
+func (h *UserHandler) Signup(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "Signup").Ctx(r.Context()).Logger()
+
+	var input models.SignupInput
+	err := json.NewDecoder(r.Body).Decode(&input)
 	if err != nil {
-		h.sendError(w, err, "", 0, &log)
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, &log)
 		return
 	}
 
-	token, err := utils.GenerateJWT(user.ID)
+	_, token, err := h.SignupUser(r.Context(), &input, &log)
 	if err != nil {
-		h.sendError(w, err, "error generating token", 0, &log)
+		sendError(w, r, err, "", 0, &log)
 		return
 	}
 
@@ -74,38 +85,24 @@ func (h *UserHandler) Signup(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 
 	if err = json.NewEncoder(w).Encode(res); err != nil {
-		h.sendError(w, err, "failed to marshal response", 0, &log)
+		sendError(w, r, err, "failed to marshal response", 0, &log)
 		return
 	}
 }
 
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
-	log := h.log.With().Str("handler", "Login").Logger()
+	log := h.log.With().Str("handler", "Login").Ctx(r.Context()).Logger()
 
 	var input models.LoginInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		h.sendError(w, err, "failed to read payload", http.StatusBadRequest, &log)
+		metrics.LoginFailures.WithLabelValues(metrics.LoginInvalidRequest).Inc()
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, &log)
 		return
 	}
 
-	if err := validate.Struct(input); err != nil {
-		h.sendError(w, err, "", http.StatusBadRequest, &log)
-		return
-	}
-
-	user, err := h.repo.GetUserByIDorEmail(r.Context(), input.Email)
+	_, token, err := h.LoginUser(r.Context(), input)
 	if err != nil {
-		h.sendError(w, err, "", http.StatusUnauthorized, &log)
-		return
-	}
-	if !utils.CheckPasswordHash(input.Password, user.Password) {
-		h.sendError(w, errors.New("invalid email or password"), "", http.StatusUnauthorized, &log)
-		return
-	}
-
-	token, err := utils.GenerateJWT(user.ID)
-	if err != nil {
-		h.sendError(w, err, "error generating token", 0, &log)
+		sendError(w, r, err, "", 0, &log)
 		return
 	}
 
@@ -116,21 +113,23 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	res.Token = token
 
 	if err = json.NewEncoder(w).Encode(res); err != nil {
-		h.sendError(w, err, "failed to marshal response", 0, &log)
+		sendError(w, r, err, "failed to marshal response", 0, &log)
 		return
 	}
 }
 
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
-	log := h.log.With().Str("handler", "GetUser").Logger()
+	log := h.log.With().Str("handler", "GetUser").Ctx(r.Context()).Logger()
 	userID := r.Context().Value(userIDKey).(string)
 
-	user, err := h.repo.GetUserByIDorEmail(r.Context(), userID)
+	user, err := h.User(r.Context(), userID)
 	if err != nil {
-		h.sendError(w, err, "", 0, &log)
+		sendError(w, r, err, "", 0, &log)
 		return
 	}
 
+	w.Header().Set("ETag", UserETag(user))
+
 	res := &models.UserResponse{
 		ID:        user.ID,
 		Firstname: user.Firstname,
@@ -139,53 +138,117 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		Email:     user.Email,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
+		Metadata:  user.Metadata,
 	}
 
 	if err = json.NewEncoder(w).Encode(res); err != nil {
-		h.sendError(w, err, "failed to marshal response", 0, &log)
+		sendError(w, r, err, "failed to marshal response", 0, &log)
 		return
 	}
 }
 
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	log := h.log.With().Str("handler", "UpdateUser").Logger()
+	log := h.log.With().Str("handler", "UpdateUser").Ctx(r.Context()).Logger()
 	userID := r.Context().Value(userIDKey).(string)
 
 	var input models.UpdateUserInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		h.sendError(w, err, "failed to read payload", http.StatusBadRequest, &log)
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, &log)
 		return
 	}
 
-	if err := validate.Struct(input); err != nil {
-		h.sendError(w, err, "", http.StatusBadRequest, &log)
+	user, err := h.UpdateUserProfile(r.Context(), userID, input, r.Header.Get("If-Match"))
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
 		return
 	}
 
-	user, err := h.repo.GetUserByIDorEmail(r.Context(), userID)
-	if err != nil {
-		h.sendError(w, err, "", 0, &log)
+	w.Header().Set("ETag", UserETag(user))
+
+	res := &models.UserResponse{
+		ID:        user.ID,
+		Firstname: user.Firstname,
+		Lastname:  user.Lastname,
+		Username:  user.Username,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Metadata:  user.Metadata,
+	}
+
+	if err = json.NewEncoder(w).Encode(res); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
 		return
 	}
-	if input.Firstname != "" {
-		user.Firstname = input.Firstname
+}
+
+// PatchUser applies a JSON merge patch (RFC 7396) to the user's profile. Only
+// the fields present in the patch are written.
+func (h *UserHandler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "PatchUser").Ctx(r.Context()).Logger()
+	userID := r.Context().Value(userIDKey).(string)
+
+	if !isMergePatch(r.Header.Get("Content-Type")) {
+		sendError(w, r, utils.ErrUnsupportedMediaType, "", 0, &log)
+		return
 	}
-	if input.Lastname != "" {
-		user.Lastname = input.Lastname
+
+	var input models.UserMergePatch
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&input); err != nil {
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, &log)
+		return
 	}
-	if input.Username != "" {
-		user.Username = input.Username
+
+	patch, err := input.ToUserPatch()
+	if err != nil {
+		sendError(w, r, err, err.Error(), http.StatusBadRequest, &log)
+		return
 	}
-	if input.Email != "" {
-		user.Email = input.Email
+
+	if err := validate.Struct(patch); err != nil {
+		sendError(w, r, err, "", http.StatusBadRequest, &log)
+		return
 	}
 
-	err = h.repo.UpdateUser(r.Context(), user)
+	// Without If-Match the patch applies to whatever version is stored, the
+	// fields it doesn't touch can't be lost. Metadata is merged with the
+	// stored value, so it is always written conditionally.
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" || input.Metadata.Set {
+		user, err := h.repo.GetUserByIDorEmail(r.Context(), userID)
+		if err != nil {
+			sendError(w, r, err, "", 0, &log)
+			return
+		}
+
+		if ifMatch != "" && !etagMatches(ifMatch, UserETag(user)) {
+			sendError(w, r, utils.ErrPreconditionFailed, "", 0, &log)
+			return
+		}
+
+		if input.Metadata.Set {
+			patch.Metadata, err = h.mergeMetadata(user, models.MetadataNamespaceUser, input.Metadata.Value)
+			if err != nil {
+				sendError(w, r, err, "", 0, &log)
+				return
+			}
+		}
+		patch.Version = user.Version
+	}
+
+	user, err := h.repo.PatchUser(r.Context(), userID, patch)
+	if errors.Is(err, utils.ErrVersionConflict) && ifMatch != "" {
+		err = utils.ErrPreconditionFailed
+	}
 	if err != nil {
-		h.sendError(w, err, "", 0, &log)
+		sendError(w, r, err, "", 0, &log)
 		return
 	}
 
+	w.Header().Set("ETag", UserETag(user))
+
 	res := &models.UserResponse{
 		ID:        user.ID,
 		Firstname: user.Firstname,
@@ -194,79 +257,319 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		Email:     user.Email,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
+		Metadata:  user.Metadata,
 	}
 
 	if err = json.NewEncoder(w).Encode(res); err != nil {
-		h.sendError(w, err, "failed to marshal response", 0, &log)
+		sendError(w, r, err, "failed to marshal response", 0, &log)
 		return
 	}
 }
 
 func (h *UserHandler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
-	log := h.log.With().Str("handler", "UpdateUser").Logger()
+	log := h.log.With().Str("handler", "UpdateUser").Ctx(r.Context()).Logger()
 	userID := r.Context().Value(userIDKey).(string)
 
 	var input models.UpdatePasswordInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		h.sendError(w, err, "failed to read payload", http.StatusBadRequest, &log)
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, &log)
 		return
 	}
 
-	if err := validate.Struct(input); err != nil {
-		h.sendError(w, err, "", http.StatusBadRequest, &log)
+	err := h.ChangePassword(r.Context(), userID, input)
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
 		return
 	}
 
-	user, err := h.repo.GetUserByIDorEmail(r.Context(), userID)
-	if err != nil {
-		h.sendError(w, err, "", 0, &log)
-		return
+	var res struct {
+		Success string `json:"success"`
 	}
 
-	if !utils.CheckPasswordHash(input.Password, user.Password) {
-		h.sendError(w, errors.New("invalid password"), "", http.StatusBadRequest, &log)
+	res.Success = "operation successful!"
+
+	if err = json.NewEncoder(w).Encode(res); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
 		return
 	}
+}
 
-	_, err = h.repo.UpdatePassword(r.Context(), userID, input.NewPassword)
+// SignupUser creates the account described by input and returns it with a
+// token for it. The business logic of the users is shared by the HTTP and
+// gRPC APIs, errors are the ones sendError understands.
+func (h *UserHandler) SignupUser(ctx context.Context, input *models.SignupInput, log *zerolog.Logger) (*models.User, string, error) {
+	user := &input.User
+
+	invitation, err := h.signupInvitation(ctx, input.InvitationToken, user.Email)
 	if err != nil {
-		h.sendError(w, err, "", 0, &log)
-		return
+		return nil, "", err
 	}
 
-	var res struct {
-		Success string `json:"success"`
+	if user.Username == "" {
+		user.Username = h.generateUniqueUsername(ctx, user.Firstname, user.Lastname, log)
 	}
 
-	res.Success = "operation successful!"
+	// validate user input
+	if err = user.Validate(); err != nil {
+		return nil, "", err
+	}
 
-	if err = json.NewEncoder(w).Encode(res); err != nil {
-		h.sendError(w, err, "failed to marshal response", 0, &log)
-		return
+	user.ID = uuid.New()
+	if err = h.repo.CreateUser(ctx, user); err != nil {
+		return nil, "", err
+	}
+	metrics.Signups.Inc()
+
+	if invitation != nil {
+		err = h.orgs.AcceptInvitation(ctx, invitation.ID.String(), user.ID)
+		if err != nil {
+			// the account exists at this point, the invitation can still be
+			// accepted later through /invitations/accept
+			log.Err(err).Str("invitation_id", invitation.ID.String()).Msg("failed to accept invitation")
+		}
+	}
+
+	token, err := utils.GenerateJWT(ctx, user)
+	if err != nil {
+		return nil, "", err
 	}
+
+	return user, token, nil
 }
 
-func (h *UserHandler) sendError(w http.ResponseWriter, err error, errMsg string, statusCode int, log *zerolog.Logger) {
-	log.Err(err)
-	if errMsg == "" {
-		errMsg = err.Error()
+// LoginUser checks the credentials and returns the user with a new token.
+func (h *UserHandler) LoginUser(ctx context.Context, input models.LoginInput) (*models.User, string, error) {
+	user, err := h.checkCredentials(ctx, input)
+	if err != nil {
+		return nil, "", err
 	}
 
-	if statusCode == 0 {
-		statusCode = http.StatusInternalServerError
+	token, err := utils.GenerateJWT(ctx, user)
+	if err != nil {
+		metrics.LoginFailures.WithLabelValues(metrics.LoginError).Inc()
+		return nil, "", err
 	}
-	errRes := fmt.Sprintf(`{"error": "%v"}`, errMsg)
+	metrics.LoginSuccesses.Inc()
 
-	if errors.Is(err, utils.ErrDuplicateEntry) || errors.Is(err, utils.ErrForeignKeyViolation) {
-		http.Error(w, errRes, http.StatusBadRequest)
-		return
-	} else if errors.Is(err, utils.ErrNotFound) {
-		http.Error(w, errRes, http.StatusNotFound)
-		return
-	} else if err != nil {
-		http.Error(w, errRes, statusCode)
+	return user, token, nil
+}
+
+// checkCredentials returns the user with the email and password of input. The
+// failures are counted in the login metrics, successes are left to the
+// caller.
+func (h *UserHandler) checkCredentials(ctx context.Context, input models.LoginInput) (*models.User, error) {
+	if err := validate.Struct(input); err != nil {
+		metrics.LoginFailures.WithLabelValues(metrics.LoginInvalidRequest).Inc()
+		return nil, err
+	}
+
+	user, err := h.repo.GetUserByIDorEmail(ctx, input.Email)
+	if err != nil {
+		reason := metrics.LoginError
+		if errors.Is(err, utils.ErrNotFound) {
+			reason = metrics.LoginUnknownUser
+		}
+		metrics.LoginFailures.WithLabelValues(reason).Inc()
+		return nil, err
+	}
+	if !utils.CheckPasswordHash(ctx, input.Password, user.Password) {
+		metrics.LoginFailures.WithLabelValues(metrics.LoginInvalidPassword).Inc()
+		return nil, utils.ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// User returns the user with the ID.
+func (h *UserHandler) User(ctx context.Context, userID string) (*models.User, error) {
+	return h.repo.GetUserByIDorEmail(ctx, userID)
+}
+
+// UpdateUserProfile sets the non-empty fields of input. ifMatch is optional,
+// the update fails with ErrPreconditionFailed if it doesn't match the user's
+// ETag.
+func (h *UserHandler) UpdateUserProfile(ctx context.Context, userID string, input models.UpdateUserInput, ifMatch string) (*models.User, error) {
+	if err := validate.Struct(input); err != nil {
+		return nil, err
+	}
+
+	user, err := h.repo.GetUserByIDorEmail(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// If-Match is optional, without it the update still fails with a
+	// conflict if the user changes between the read above and the write
+	if ifMatch != "" && !etagMatches(ifMatch, UserETag(user)) {
+		return nil, utils.ErrPreconditionFailed
+	}
+
+	if input.Firstname != "" {
+		user.Firstname = input.Firstname
+	}
+	if input.Lastname != "" {
+		user.Lastname = input.Lastname
+	}
+	if input.Username != "" {
+		user.Username = input.Username
+	}
+	if input.Email != "" {
+		user.Email = input.Email
+	}
+
+	err = h.repo.UpdateUser(ctx, user)
+	if errors.Is(err, utils.ErrVersionConflict) && ifMatch != "" {
+		err = utils.ErrPreconditionFailed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ChangePassword replaces the password after checking the current one. The
+// repository revokes the sessions of the user in the same transaction, see
+// repository.SessionRepository.
+func (h *UserHandler) ChangePassword(ctx context.Context, userID string, input models.UpdatePasswordInput) error {
+	if err := validate.Struct(input); err != nil {
+		return err
+	}
+
+	user, err := h.repo.GetUserByIDorEmail(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !utils.CheckPasswordHash(ctx, input.Password, user.Password) {
+		return utils.ErrInvalidPassword
+	}
+
+	if _, err = h.repo.UpdatePassword(ctx, userID, input.NewPassword); err != nil {
+		return err
+	}
+	metrics.PasswordChanges.Inc()
+
+	return nil
+}
+
+// signupInvitation resolves the invitation used to sign up, if any. In
+// invite-only mode a valid invitation addressed to email is required.
+func (h *UserHandler) signupInvitation(ctx context.Context, token, email string) (*models.Invitation, error) {
+	if token == "" || h.orgs == nil {
+		if h.config.InviteOnlySignup {
+			return nil, utils.ErrInvitationRequired
+		}
+		return nil, nil
+	}
+
+	invitation, err := h.orgs.GetInvitationByTokenHash(ctx, utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if !invitation.IsPending() || !strings.EqualFold(invitation.Email, email) {
+		return nil, utils.ErrInvalidInvitation
+	}
+
+	return invitation, nil
+}
+
+// sendError responds with the problem+json document for err. errMsg is the
+// detail shown to the client, the message of err is only logged.
+func sendError(w http.ResponseWriter, r *http.Request, err error, errMsg string, statusCode int, log *zerolog.Logger) {
+	p := problem.New(err, statusCode, errMsg, problem.Language(r))
+
+	event := log.Warn()
+	if p.Status >= http.StatusInternalServerError {
+		event = log.Error()
+	}
+	event.Err(err).Int("status", p.Status).Str("code", string(p.Code)).Msg(p.Title)
+
+	writeProblem(w, r, p)
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, p *problem.Problem) {
+	p.RequestID = logging.RequestIDFromContext(r.Context())
+	problem.Write(w, r, p)
+}
+
+// malformedBody marks err as a failure to decode the request body.
+func malformedBody(err error) error {
+	return fmt.Errorf("%w: %w", utils.ErrMalformedBody, err)
+}
+
+// NotFound responds to requests that match no route.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, problem.New(utils.ErrRouteNotFound, 0, "", problem.Language(r)))
+}
+
+// MethodNotAllowed responds to requests whose route doesn't support the
+// method.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, problem.New(utils.ErrMethodNotAllowed, 0, "", problem.Language(r)))
+}
+
+// DeleteUser soft deletes the user's own account.
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "DeleteUser").Ctx(r.Context()).Logger()
+	userID := r.Context().Value(userIDKey).(string)
+
+	if err := h.repo.DeleteUser(r.Context(), userID); err != nil {
+		sendError(w, r, err, "", 0, &log)
 		return
 	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mergeMetadata applies a merge patch to one metadata namespace of the user
+// and validates the result. A nil patch clears the namespace.
+func (h *UserHandler) mergeMetadata(user *models.User, namespace string, patch map[string]any) (*models.UserMetadata, error) {
+	merged := map[string]any{}
+	if patch != nil {
+		merged = models.MergeObject(user.Metadata.Namespace(namespace), patch)
+	}
+
+	if err := h.metadata.Validate(namespace, merged); err != nil {
+		return nil, err
+	}
+
+	metadata := user.Metadata
+	if namespace == models.MetadataNamespaceAdmin {
+		metadata.Admin = merged
+	} else {
+		metadata.User = merged
+	}
+
+	return &metadata, nil
+}
+
+// isMergePatch accepts application/merge-patch+json as well as plain JSON,
+// which clients without merge patch support send.
+func isMergePatch(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/merge-patch+json" || mediaType == "application/json"
+}
+
+// UserETag is a strong entity tag derived from the user's version.
+func UserETag(user *models.User) string {
+	return fmt.Sprintf(`"%d"`, user.Version)
+}
+
+// etagMatches implements the strong comparison of an If-Match header, which
+// can be "*" or a comma separated list of entity tags.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *UserHandler) generateUniqueUsername(ctx context.Context, firstName, lastName string, log *zerolog.Logger) string {
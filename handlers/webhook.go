@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/repository"
+	"github.com/rovilay/auth-service/utils"
+	"github.com/rovilay/auth-service/webhooks"
+	"github.com/rs/zerolog"
+)
+
+// deliveryLogLimit is the number of deliveries returned by the delivery log.
+const deliveryLogLimit = 100
+
+// WebhookHandler serves the webhook admin API. Routes must be protected with
+// MiddlewareAdmin.
+type WebhookHandler struct {
+	repo   repository.WebhookRepository
+	config *config.AppConfig
+	log    *zerolog.Logger
+}
+
+func NewWebhookHandler(repo repository.WebhookRepository, c *config.AppConfig, l *zerolog.Logger) *WebhookHandler {
+	logger := l.With().Str("handlers", "WebhookHandler").Logger()
+
+	return &WebhookHandler{
+		repo:   repo,
+		config: c,
+		log:    &logger,
+	}
+}
+
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "CreateWebhook").Ctx(r.Context()).Logger()
+
+	var input models.CreateWebhookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		sendError(w, r, malformedBody(err), "failed to read payload", http.StatusBadRequest, &log)
+		return
+	}
+
+	if err := validate.Struct(input); err != nil {
+		sendError(w, r, err, "", http.StatusBadRequest, &log)
+		return
+	}
+
+	for _, pattern := range input.Events {
+		if !validEventPattern(pattern) {
+			sendError(w, r, utils.ErrInvalidEventFilter, "", 0, &log)
+			return
+		}
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		sendError(w, r, err, utils.ErrTokenGeneration.Error(), 0, &log)
+		return
+	}
+
+	webhook := &models.Webhook{
+		ID:     uuid.New(),
+		URL:    input.URL,
+		Secret: secret,
+		Events: input.Events,
+	}
+
+	err = h.repo.CreateWebhook(r.Context(), webhook)
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	log.Info().Str("webhook_id", webhook.ID.String()).Str("url", webhook.URL).Msg("webhook created")
+
+	res := &models.CreateWebhookResponse{
+		Webhook: *webhook,
+		Secret:  secret,
+	}
+
+	w.WriteHeader(http.StatusCreated)
+
+	if err = json.NewEncoder(w).Encode(res); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "ListWebhooks").Ctx(r.Context()).Logger()
+
+	webhooks, err := h.repo.ListWebhooks(r.Context())
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(webhooks); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "GetWebhook").Ctx(r.Context()).Logger()
+
+	webhook, err := h.repo.GetWebhook(r.Context(), chi.URLParam(r, "webhookID"))
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(webhook); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "DeleteWebhook").Ctx(r.Context()).Logger()
+
+	webhookID := chi.URLParam(r, "webhookID")
+	if err := h.repo.DeleteWebhook(r.Context(), webhookID); err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	log.Info().Str("webhook_id", webhookID).Msg("webhook deleted")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries is the delivery log of the webhook, newest first.
+func (h *WebhookHandler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "ListWebhookDeliveries").Ctx(r.Context()).Logger()
+
+	webhook, err := h.repo.GetWebhook(r.Context(), chi.URLParam(r, "webhookID"))
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	deliveries, err := h.repo.ListWebhookDeliveries(r.Context(), webhook.ID.String(), deliveryLogLimit)
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(deliveries); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+// RedeliverWebhookDelivery queues a delivery again, e.g. a dead one after the
+// receiver was fixed.
+func (h *WebhookHandler) RedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	log := h.log.With().Str("handler", "RedeliverWebhookDelivery").Ctx(r.Context()).Logger()
+
+	delivery, err := h.repo.RedeliverWebhookDelivery(r.Context(), chi.URLParam(r, "webhookID"), chi.URLParam(r, "deliveryID"))
+	if err != nil {
+		sendError(w, r, err, "", 0, &log)
+		return
+	}
+
+	log.Info().Str("delivery_id", delivery.ID.String()).Msg("webhook delivery queued for redelivery")
+
+	w.WriteHeader(http.StatusAccepted)
+
+	if err = json.NewEncoder(w).Encode(delivery); err != nil {
+		sendError(w, r, err, "failed to marshal response", 0, &log)
+		return
+	}
+}
+
+// validEventPattern accepts "*", known event types and prefixes of known
+// event types like "user.*".
+func validEventPattern(pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	prefix, wildcard := strings.CutSuffix(pattern, "*")
+	for _, eventType := range models.EventTypes {
+		if eventType == pattern || (wildcard && strings.HasSuffix(prefix, ".") && strings.HasPrefix(eventType, prefix)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,139 @@
+// Package health serves the liveness and readiness probes. Subsystems register
+// their own readiness checks on a Registry, the service is ready when all of
+// them pass and it isn't shutting down.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+var ErrShuttingDown = errors.New("shutting down")
+
+// Check reports whether a dependency is ready. It must return before ctx is
+// done.
+type Check func(ctx context.Context) error
+
+// Report is the readiness of the service. Checks maps each check to StatusOK
+// or StatusUnavailable, why a check failed is only logged since probes can be
+// reachable from outside.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+type Registry struct {
+	mu           sync.RWMutex
+	checks       map[string]Check
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+	log          *zerolog.Logger
+}
+
+// NewRegistry returns a Registry that gives each check at most timeout to
+// complete.
+func NewRegistry(timeout time.Duration, log *zerolog.Logger) *Registry {
+	logger := log.With().Str("health", "Registry").Logger()
+
+	return &Registry{
+		checks:  map[string]Check{},
+		timeout: timeout,
+		log:     &logger,
+	}
+}
+
+// Register adds a readiness check, replacing any check with the same name.
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks[name] = check
+}
+
+// SetShuttingDown marks the service as not ready so load balancers stop
+// routing new requests to it before the server shuts down.
+func (r *Registry) SetShuttingDown() {
+	r.shuttingDown.Store(true)
+}
+
+// Check runs all readiness checks concurrently.
+func (r *Registry) Check(ctx context.Context) *Report {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.checks))
+	for name := range r.checks {
+		names = append(names, name)
+	}
+	checks := make([]Check, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		checks[i] = r.checks[name]
+	}
+	r.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			errs[i] = check(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := &Report{Status: StatusOK, Checks: make(map[string]string, len(checks))}
+	if r.shuttingDown.Load() {
+		report.Status = StatusUnavailable
+		report.Checks["shutdown"] = ErrShuttingDown.Error()
+	}
+
+	for i, name := range names {
+		if errs[i] != nil {
+			r.log.Warn().Err(errs[i]).Str("check", name).Msg("readiness check failed")
+			report.Status = StatusUnavailable
+			report.Checks[name] = StatusUnavailable
+			continue
+		}
+		report.Checks[name] = StatusOK
+	}
+
+	return report
+}
+
+// Liveness reports that the process is up and serving requests. It doesn't
+// run any checks, a failing dependency shouldn't get the pod restarted.
+func (r *Registry) Liveness(w http.ResponseWriter, _ *http.Request) {
+	writeReport(w, &Report{Status: StatusOK})
+}
+
+// Readiness reports whether the service can take traffic.
+func (r *Registry) Readiness(w http.ResponseWriter, req *http.Request) {
+	writeReport(w, r.Check(req.Context()))
+}
+
+func writeReport(w http.ResponseWriter, report *Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
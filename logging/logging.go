@@ -0,0 +1,127 @@
+// Package logging provides the access log, request IDs and log redaction.
+// Every request gets an ID that is echoed in the X-Request-ID header and
+// added, together with the authenticated user, to all log lines written with
+// the request's context.
+package logging
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const HeaderRequestID = "X-Request-ID"
+
+// validRequestID limits the request IDs accepted from callers, so that they
+// can't inject arbitrary content into logs and response headers.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type contextKey string
+
+var requestKey contextKey = "request"
+
+// request is shared by pointer so that middlewares running after the access
+// log, e.g. authentication, can attach the user to it.
+type request struct {
+	id     string
+	userID string
+}
+
+func fromContext(ctx context.Context) *request {
+	if ctx == nil {
+		return nil
+	}
+	req, _ := ctx.Value(requestKey).(*request)
+	return req
+}
+
+// RequestIDFromContext returns the ID of the request ctx belongs to.
+func RequestIDFromContext(ctx context.Context) string {
+	if req := fromContext(ctx); req != nil {
+		return req.id
+	}
+	return ""
+}
+
+// WithRequest starts a request with the ID sent by the caller, or a new one
+// when it is missing or invalid. It returns the request's context and ID.
+func WithRequest(ctx context.Context, id string) (context.Context, string) {
+	if !validRequestID.MatchString(id) {
+		id = uuid.NewString()
+	}
+	return context.WithValue(ctx, requestKey, &request{id: id}), id
+}
+
+// SetUserID records the authenticated user of the request ctx belongs to.
+func SetUserID(ctx context.Context, userID string) {
+	if req := fromContext(ctx); req != nil {
+		req.userID = userID
+	}
+}
+
+// Hook adds the request and user ID to log lines of loggers and events that
+// carry a request context, see zerolog.Context.Ctx.
+type Hook struct{}
+
+func (Hook) Run(e *zerolog.Event, _ zerolog.Level, _ string) {
+	req := fromContext(e.GetCtx())
+	if req == nil {
+		return
+	}
+
+	e.Str("request_id", req.id)
+	if req.userID != "" {
+		e.Str("user_id", req.userID)
+	}
+}
+
+// Middleware assigns the request ID and writes an access log line per
+// request once it completes.
+func Middleware(log *zerolog.Logger) func(http.Handler) http.Handler {
+	logger := log.With().Str("middleware", "AccessLog").Logger()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, id := WithRequest(r.Context(), r.Header.Get(HeaderRequestID))
+			w.Header().Set(HeaderRequestID, id)
+			r = r.WithContext(ctx)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			event := logger.Info()
+			if status >= http.StatusInternalServerError {
+				event = logger.Error()
+			} else if status >= http.StatusBadRequest {
+				event = logger.Warn()
+			}
+
+			if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+				event.Str("route", rctx.RoutePattern())
+			}
+
+			event.Ctx(ctx).
+				Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Int("status", status).
+				Int("bytes", ww.BytesWritten()).
+				Dur("latency_ms", time.Since(start)).
+				Str("remote_addr", r.RemoteAddr).
+				Str("user_agent", r.UserAgent()).
+				Msg("request completed")
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type logMailer struct {
+	log *zerolog.Logger
+}
+
+// NewLogMailer returns a Mailer that writes messages to the logger instead of
+// delivering them. It is used until a real email provider is configured.
+func NewLogMailer(log *zerolog.Logger) Mailer {
+	logger := log.With().Str("mailer", "logMailer").Logger()
+
+	return &logMailer{
+		log: &logger,
+	}
+}
+
+func (m *logMailer) Send(ctx context.Context, msg Message) error {
+	m.log.Info().
+		Str("to", msg.To).
+		Str("subject", msg.Subject).
+		Str("body", msg.Body).
+		Msg("sending email")
+
+	return nil
+}
@@ -2,25 +2,34 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
 	"github.com/rovilay/auth-service/app"
 	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/logging"
+	"github.com/rovilay/auth-service/metrics"
 	"github.com/rovilay/auth-service/repository"
+	"github.com/rovilay/auth-service/tracing"
 	"github.com/rs/zerolog"
+	_ "modernc.org/sqlite"
 )
 
 func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	logger := zerolog.New(os.Stdout).With().Str("application", "auth-service:main").Timestamp().Logger()
+	logger := zerolog.New(logging.NewRedactingWriter(os.Stdout)).
+		Hook(tracing.LogHook{}).Hook(logging.Hook{}).
+		With().Str("application", "auth-service:main").Timestamp().Logger()
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
 	// add logger to context
@@ -39,19 +48,86 @@ func main() {
 
 	// load config
 	c := config.LoadConfig(&logger)
+	if !c.LogRedaction {
+		logger = logger.Output(os.Stdout)
+	}
+
+	// the spec doesn't depend on the database, don't require one
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		err = runOpenAPI(&c, &logger, os.Args[2:])
+		if errors.Is(err, errOpenAPIUsage) {
+			fmt.Fprintln(os.Stderr, openapiUsage)
+			os.Exit(2)
+		} else if err != nil {
+			logger.Fatal().Err(err).Msg("openapi failed")
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, c.TracingExporter)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to set up tracing")
+	}
+	defer func() {
+		// ctx is done by now, give the exporter a moment to flush
+		timeout, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		if err := shutdownTracing(timeout); err != nil {
+			logger.Err(err).Msg("failed to flush traces")
+		}
+	}()
 
-	db, err := sqlx.ConnectContext(ctx, "pgx", c.DATABASE_URL)
+	sqlDB, err := tracing.OpenDB(c.DatabaseDriver, c.DatabaseDSN)
 	if err != nil {
-		logger.Fatal().Err(err).Msg(fmt.Sprintf("failed to connect to DB %s", c.DATABASE_URL))
+		logger.Fatal().Err(err).Msg(fmt.Sprintf("failed to connect to DB %s", c.RedactedDatabaseURL()))
+	}
+	db := sqlx.NewDb(sqlDB, c.DatabaseDriver)
+	// the database may come up after the service, /readyz reports it until then
+	if err = db.PingContext(ctx); err != nil {
+		logger.Err(err).Msg(fmt.Sprintf("failed to connect to DB %s", c.RedactedDatabaseURL()))
 	}
 	defer func() {
 		if err := db.Close(); err != nil {
-			logger.Err(err).Msg("failed to close postgres")
+			logger.Err(err).Msg("failed to close database")
 		}
 	}()
 
-	repo := repository.NewPostgresRepository(ctx, db, &logger)
+	metrics.RegisterDBStats(db.DB, c.DatabaseDriver)
+
+	m, err := newMigrator(db, &c, &logger)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to load migrations")
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = runMigrate(ctx, m, os.Args[2:])
+		if errors.Is(err, errMigrateUsage) {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			os.Exit(2)
+		} else if err != nil {
+			logger.Fatal().Err(err).Msg("migrate failed")
+		}
+		return
+	}
+
+	if c.AutoMigrate {
+		// readiness fails on pending migrations, apply them with migrate up
+		if err = m.Up(ctx); err != nil {
+			logger.Err(err).Msg("failed to apply migrations")
+		}
+	}
+
+	var repo repository.UserRepository
+	switch c.DatabaseDriver {
+	case config.DriverSQLite:
+		repo = repository.NewSQLiteRepository(ctx, db, &logger)
+	default:
+		repo = repository.NewPostgresRepository(ctx, db, &logger)
+	}
+
 	app := app.NewApp(repo, &c, &logger)
+	app.Health().Register("migrations", m.Ready)
 
 	if err = app.Start(ctx); err != nil {
 		logger.Fatal().Err(err).Msg("failed to start app")
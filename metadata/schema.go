@@ -0,0 +1,78 @@
+// Package metadata validates custom user attributes against the JSON Schemas
+// configured for each metadata namespace.
+package metadata
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/utils"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+type Validator struct {
+	schemas map[string]*jsonschema.Schema
+}
+
+// NewValidator compiles the schema files for the user and admin namespaces.
+// A namespace without a schema accepts any JSON object.
+func NewValidator(userSchema, adminSchema string) (*Validator, error) {
+	v := &Validator{schemas: map[string]*jsonschema.Schema{}}
+
+	files := map[string]string{
+		models.MetadataNamespaceUser:  userSchema,
+		models.MetadataNamespaceAdmin: adminSchema,
+	}
+	for namespace, file := range files {
+		if file == "" {
+			continue
+		}
+
+		schema, err := jsonschema.Compile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile %s metadata schema: %w", namespace, err)
+		}
+		v.schemas[namespace] = schema
+	}
+
+	return v, nil
+}
+
+// Validate checks the values of a namespace against its schema. Failures
+// wrap utils.ErrInvalidMetadata.
+func (v *Validator) Validate(namespace string, values map[string]any) error {
+	schema, ok := v.schemas[namespace]
+	if !ok {
+		return nil
+	}
+
+	if values == nil {
+		values = map[string]any{}
+	}
+
+	err := schema.Validate(values)
+	if err == nil {
+		return nil
+	}
+
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return fmt.Errorf("%w: %v", utils.ErrInvalidMetadata, err)
+	}
+
+	// report the leaf errors, the schema locations are meaningless to clients
+	var causes []string
+	for _, unit := range verr.BasicOutput().Errors {
+		if unit.Error == "" || strings.HasPrefix(unit.Error, "doesn't validate with") {
+			continue
+		}
+		location := unit.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		causes = append(causes, fmt.Sprintf("%s: %s", location, unit.Error))
+	}
+
+	return fmt.Errorf("%w: %s metadata %s", utils.ErrInvalidMetadata, namespace, strings.Join(causes, "; "))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/migrations"
+	"github.com/rovilay/auth-service/migrator"
+	"github.com/rs/zerolog"
+)
+
+const migrateUsage = `usage: auth-service migrate <command>
+
+commands:
+  up            apply all pending migrations
+  down [N]      roll back the last N migrations (default 1)
+  status        list migrations and the current version
+  goto V        migrate up or down to version V`
+
+var errMigrateUsage = errors.New("invalid migrate command")
+
+func newMigrator(db *sqlx.DB, c *config.AppConfig, log *zerolog.Logger) (*migrator.Migrator, error) {
+	source, err := migrations.ForDriver(c.DatabaseDriver)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrator.New(db, c.DatabaseDriver, source, log)
+}
+
+// runMigrate implements the migrate subcommand.
+func runMigrate(ctx context.Context, m *migrator.Migrator, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	switch args[0] {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+		return m.Down(ctx, steps)
+	case "goto":
+		if len(args) < 2 {
+			return errMigrateUsage
+		}
+		version, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		return m.Goto(ctx, uint(version))
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(status)
+		return nil
+	default:
+		return errMigrateUsage
+	}
+}
+
+func printStatus(status *migrator.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "current version: %d (dirty: %t, pending: %d)\n\n", status.Version, status.Dirty, status.Pending)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE")
+	for _, migration := range status.Migrations {
+		state := "pending"
+		if migration.Applied {
+			state = "applied"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", migration.Version, migration.Name, state)
+	}
+}
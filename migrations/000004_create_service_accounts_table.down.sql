@@ -0,0 +1,8 @@
+DELETE FROM access_tokens WHERE service_account_id IS NOT NULL;
+
+ALTER TABLE access_tokens
+    DROP CONSTRAINT IF EXISTS access_tokens_single_owner,
+    DROP COLUMN IF EXISTS service_account_id,
+    ALTER COLUMN user_id SET NOT NULL;
+
+DROP TABLE IF EXISTS service_accounts;
\ No newline at end of file
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS service_accounts (
+    id UUID PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    owner_user_id UUID REFERENCES users (id) ON DELETE CASCADE,
+    owner_organization_id UUID REFERENCES organizations (id) ON DELETE CASCADE,
+    client_secret_hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT service_accounts_single_owner CHECK (num_nonnulls(owner_user_id, owner_organization_id) = 1)
+);
+
+CREATE INDEX IF NOT EXISTS service_accounts_owner_user_id_idx ON service_accounts (owner_user_id);
+CREATE INDEX IF NOT EXISTS service_accounts_owner_organization_id_idx ON service_accounts (owner_organization_id);
+
+ALTER TABLE access_tokens
+    ALTER COLUMN user_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS service_account_id UUID REFERENCES service_accounts (id) ON DELETE CASCADE,
+    ADD CONSTRAINT access_tokens_single_owner CHECK (num_nonnulls(user_id, service_account_id) = 1);
+
+CREATE INDEX IF NOT EXISTS access_tokens_service_account_id_idx ON access_tokens (service_account_id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS users_name_trgm_idx;
+DROP INDEX IF EXISTS users_email_trgm_idx;
+DROP INDEX IF EXISTS users_username_trgm_idx;
+DROP INDEX IF EXISTS users_created_at_id_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS locked_at;
\ No newline at end of file
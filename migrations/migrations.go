@@ -0,0 +1,27 @@
+// Package migrations embeds the SQL migrations so the binary can apply them
+// itself. The postgres migrations live at the root of the directory, the
+// SQLite ones under sqlite/.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+
+	"github.com/rovilay/auth-service/config"
+)
+
+//go:embed *.sql sqlite/*.sql
+var files embed.FS
+
+// ForDriver returns the migrations for the given database/sql driver name.
+func ForDriver(driver string) (fs.FS, error) {
+	switch driver {
+	case config.DriverPostgres:
+		return files, nil
+	case config.DriverSQLite:
+		return fs.Sub(files, "sqlite")
+	default:
+		return nil, fmt.Errorf("no migrations for driver %q", driver)
+	}
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_created_at_id_idx;
+
+ALTER TABLE users DROP COLUMN locked_at;
\ No newline at end of file
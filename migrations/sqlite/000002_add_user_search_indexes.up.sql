@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN locked_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS users_created_at_id_idx ON users (created_at, id);
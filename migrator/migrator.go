@@ -0,0 +1,372 @@
+// Package migrator applies the embedded SQL migrations. It keeps its state in
+// the same schema_migrations table as the golang-migrate CLI, so databases
+// migrated by hand can switch over without changes.
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rovilay/auth-service/config"
+	"github.com/rs/zerolog"
+)
+
+// advisoryLockKey identifies the migration lock. Replicas starting at the same
+// time wait on it instead of racing to apply the same migration.
+const advisoryLockKey int64 = 0x61757468_6d696772 // "authmigr"
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+var ErrDirty = errors.New("database is in a dirty migration state")
+var ErrUnknownVersion = errors.New("unknown migration version")
+var ErrPending = errors.New("database has pending migrations")
+
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version uint   `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+}
+
+type Status struct {
+	Version    uint              `json:"version"`
+	Dirty      bool              `json:"dirty"`
+	Pending    int               `json:"pending"`
+	Migrations []MigrationStatus `json:"migrations"`
+}
+
+type Migrator struct {
+	db         *sqlx.DB
+	driver     string
+	migrations []Migration
+	log        *zerolog.Logger
+}
+
+func New(db *sqlx.DB, driver string, source fs.FS, log *zerolog.Logger) (*Migrator, error) {
+	logger := log.With().Str("migrator", "Migrator").Logger()
+
+	migrations, err := load(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		driver:     driver,
+		migrations: migrations,
+		log:        &logger,
+	}, nil
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+
+	return m.Goto(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down rolls back the last steps migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		current, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		idx := m.index(current)
+		target := uint(0)
+		if idx-steps >= 0 {
+			target = m.migrations[idx-steps].Version
+		}
+
+		return m.migrate(ctx, conn, current, target)
+	})
+}
+
+// Goto migrates up or down to version. Version 0 rolls back everything.
+func (m *Migrator) Goto(ctx context.Context, version uint) error {
+	if version != 0 && m.index(version) < 0 {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		current, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		return m.migrate(ctx, conn, current, version)
+	})
+}
+
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err = m.ensureVersionTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	version, dirty, err := m.readVersion(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{Version: version, Dirty: dirty}
+	for _, migration := range m.migrations {
+		applied := migration.Version <= version
+		if !applied {
+			status.Pending++
+		}
+
+		status.Migrations = append(status.Migrations, MigrationStatus{
+			Version: migration.Version,
+			Name:    migration.Name,
+			Applied: applied,
+		})
+	}
+
+	return status, nil
+}
+
+// Ready fails while the database is dirty or has pending migrations. It is
+// meant to be registered as a readiness check.
+func (m *Migrator) Ready(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	if status.Dirty {
+		return ErrDirty
+	}
+	if status.Pending > 0 {
+		return fmt.Errorf("%w: %d", ErrPending, status.Pending)
+	}
+
+	return nil
+}
+
+// migrate applies the migrations between from and to one at a time, each in
+// its own transaction together with the version bump.
+func (m *Migrator) migrate(ctx context.Context, conn *sqlx.Conn, from, to uint) error {
+	if from < to {
+		for _, migration := range m.migrations {
+			if migration.Version <= from || migration.Version > to {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration.Up, migration.Version, migration); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version > from || migration.Version <= to {
+			continue
+		}
+
+		previous := uint(0)
+		if i > 0 {
+			previous = m.migrations[i-1].Version
+		}
+		if err := m.apply(ctx, conn, migration.Down, previous, migration); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sqlx.Conn, query string, version uint, migration Migration) error {
+	log := m.log.With().Uint("migration", migration.Version).Str("name", migration.Name).Logger()
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+
+	if version > 0 {
+		if _, err = tx.ExecContext(ctx, m.rebind(`INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)`), version, false); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Info().Uint("version", version).Msg("migration applied")
+
+	return nil
+}
+
+// withLock runs fn on a single connection. On postgres the connection holds
+// an advisory lock for the duration of fn. SQLite deployments are single
+// node and serialize writers on their own.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.driver == config.DriverPostgres {
+		if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockKey); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer func() {
+			// the context may be cancelled by now, still release the lock
+			if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockKey); err != nil {
+				m.log.Err(err).Msg("failed to release migration lock")
+			}
+		}()
+	}
+
+	if err = m.ensureVersionTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) ensureVersionTable(ctx context.Context, conn *sqlx.Conn) error {
+	query := `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`
+
+	_, err := conn.ExecContext(ctx, query)
+	return err
+}
+
+// currentVersion returns the applied version and refuses to continue from a
+// dirty state left behind by a failed external migration.
+func (m *Migrator) currentVersion(ctx context.Context, conn *sqlx.Conn) (uint, error) {
+	version, dirty, err := m.readVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	if dirty {
+		return 0, fmt.Errorf("%w at version %d, fix the schema by hand and update schema_migrations", ErrDirty, version)
+	}
+
+	if version != 0 && m.index(version) < 0 {
+		return 0, fmt.Errorf("%w: database is at version %d", ErrUnknownVersion, version)
+	}
+
+	return version, nil
+}
+
+func (m *Migrator) readVersion(ctx context.Context, conn *sqlx.Conn) (uint, bool, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+
+	var version int64
+	var dirty bool
+	if rows.Next() {
+		if err = rows.Scan(&version, &dirty); err != nil {
+			return 0, false, err
+		}
+	}
+
+	return uint(version), dirty, rows.Err()
+}
+
+// index returns the position of version in the sorted migrations, or -1.
+func (m *Migrator) index(version uint) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Migrator) rebind(query string) string {
+	if m.driver == config.DriverSQLite {
+		return sqlx.Rebind(sqlx.QUESTION, query)
+	}
+	return query
+}
+
+// load reads {version}_{name}.{up|down}.sql files from the root of source.
+func load(source fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+
+		content, err := fs.ReadFile(source, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[uint(version)]
+		if !ok {
+			migration = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = migration
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s is missing its up or down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
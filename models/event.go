@@ -0,0 +1,86 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventUserCreated         = "user.created"
+	EventUserUpdated         = "user.updated"
+	EventUserPasswordChanged = "user.password_changed"
+	EventUserDeleted         = "user.deleted"
+
+	EventServiceAccountCreated       = "service_account.created"
+	EventServiceAccountSecretRotated = "service_account.secret_rotated"
+	EventServiceAccountDeleted       = "service_account.deleted"
+)
+
+// EventTypes lists every event type the service emits.
+var EventTypes = []string{
+	EventUserCreated, EventUserUpdated, EventUserPasswordChanged, EventUserDeleted,
+	EventServiceAccountCreated, EventServiceAccountSecretRotated, EventServiceAccountDeleted,
+}
+
+// Event is a domain event stored in the outbox. Events are delivered at least
+// once, consumers should deduplicate them by ID.
+type Event struct {
+	ID           uuid.UUID  `json:"id"`
+	Type         string     `json:"type"`
+	AggregateID  uuid.UUID  `json:"aggregate_id" db:"aggregate_id"`
+	Payload      RawJSON    `json:"payload"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	Attempts     int        `json:"-"`
+	LastError    *string    `json:"-" db:"last_error"`
+	LockedUntil  *time.Time `json:"-" db:"locked_until"`
+	DispatchedAt *time.Time `json:"-" db:"dispatched_at"`
+}
+
+// UserEventPayload is the payload of the user.* events.
+type UserEventPayload struct {
+	User UserResponse `json:"user"`
+	// Changes lists the fields changed by a user.updated event.
+	Changes []string `json:"changes,omitempty"`
+	// Actor is the principal that made the change, if it was made through an
+	// authenticated request.
+	Actor *Principal `json:"actor,omitempty"`
+}
+
+// ServiceAccountEventPayload is the payload of the service_account.* events.
+type ServiceAccountEventPayload struct {
+	ServiceAccount ServiceAccount `json:"service_account"`
+	// Actor is the principal that made the change.
+	Actor *Principal `json:"actor,omitempty"`
+}
+
+// RawJSON is an encoded JSON value stored as text.
+type RawJSON []byte
+
+func (j RawJSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+func (j RawJSON) Value() (driver.Value, error) {
+	return string(j), nil
+}
+
+func (j *RawJSON) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		*j = RawJSON(v)
+	case []byte:
+		// the driver may reuse the buffer, keep a copy
+		*j = append(RawJSON(nil), v...)
+	case nil:
+		*j = nil
+	default:
+		return fmt.Errorf("cannot scan %T into RawJSON", src)
+	}
+	return nil
+}
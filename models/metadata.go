@@ -0,0 +1,93 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	MetadataNamespaceUser  = "user"
+	MetadataNamespaceAdmin = "admin"
+)
+
+// UserMetadata holds custom user attributes. Users can edit the user
+// namespace themselves, the admin namespace is only writable by admins.
+// It is stored as a single JSON object.
+type UserMetadata struct {
+	User  map[string]any `json:"user"`
+	Admin map[string]any `json:"admin"`
+}
+
+// MarshalJSON renders missing namespaces as empty objects instead of null.
+func (m UserMetadata) MarshalJSON() ([]byte, error) {
+	type metadata UserMetadata
+
+	out := metadata(m)
+	if out.User == nil {
+		out.User = map[string]any{}
+	}
+	if out.Admin == nil {
+		out.Admin = map[string]any{}
+	}
+	return json.Marshal(out)
+}
+
+func (m UserMetadata) Value() (driver.Value, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (m *UserMetadata) Scan(src any) error {
+	*m = UserMetadata{}
+
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	case []byte:
+		return json.Unmarshal(v, m)
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into UserMetadata", src)
+	}
+}
+
+// Namespace returns the values of the named namespace.
+func (m UserMetadata) Namespace(namespace string) map[string]any {
+	if namespace == MetadataNamespaceAdmin {
+		return m.Admin
+	}
+	return m.User
+}
+
+// Claims projects the selected keys into token claims. Keys are given as
+// namespace.key, e.g. user.locale, and keep their namespace in the result.
+// Keys without a value are skipped.
+func (m UserMetadata) Claims(keys []string) map[string]any {
+	claims := map[string]any{}
+	for _, key := range keys {
+		namespace, name, found := strings.Cut(key, ".")
+		if !found {
+			continue
+		}
+
+		value, ok := m.Namespace(namespace)[name]
+		if !ok || (namespace != MetadataNamespaceUser && namespace != MetadataNamespaceAdmin) {
+			continue
+		}
+
+		projected, _ := claims[namespace].(map[string]any)
+		if projected == nil {
+			projected = map[string]any{}
+			claims[namespace] = projected
+		}
+		projected[name] = value
+	}
+
+	return claims
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+type Organization struct {
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name" validate:"required,min=2,max=100"`
+	CreatedAt time.Time  `json:"created_at,omitempty" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at,omitempty" db:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+type Membership struct {
+	OrganizationID uuid.UUID `json:"organization_id" db:"organization_id"`
+	UserID         uuid.UUID `json:"user_id" db:"user_id"`
+	Role           string    `json:"role"`
+	CreatedAt      time.Time `json:"created_at,omitempty" db:"created_at"`
+}
+
+// IsAdmin reports whether the member can manage the organization.
+func (m *Membership) IsAdmin() bool {
+	return m.Role == RoleOwner || m.Role == RoleAdmin
+}
+
+type Invitation struct {
+	ID             uuid.UUID  `json:"id"`
+	OrganizationID uuid.UUID  `json:"organization_id" db:"organization_id"`
+	Email          string     `json:"email"`
+	Role           string     `json:"role"`
+	InvitedBy      uuid.UUID  `json:"invited_by" db:"invited_by"`
+	TokenHash      string     `json:"-" db:"token_hash"`
+	ExpiresAt      time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty" db:"accepted_at"`
+	AcceptedBy     *uuid.UUID `json:"accepted_by,omitempty" db:"accepted_by"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt      time.Time  `json:"created_at,omitempty" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// IsPending reports whether the invitation can still be accepted.
+func (i *Invitation) IsPending() bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && time.Now().Before(i.ExpiresAt)
+}
+
+type CreateOrganizationInput struct {
+	Name string `json:"name" validate:"required,min=2,max=100"`
+}
+
+type CreateInvitationInput struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=admin member"`
+}
+
+type AcceptInvitationInput struct {
+	Token string `json:"token" validate:"required"`
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PatchField is a field of a JSON merge patch (RFC 7396). It tells a field
+// that is absent apart from one explicitly set to null.
+type PatchField[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+func (f *PatchField[T]) UnmarshalJSON(b []byte) error {
+	f.Set = true
+	if string(b) == "null" {
+		f.Null = true
+		return nil
+	}
+	return json.Unmarshal(b, &f.Value)
+}
+
+// ptr returns nil for absent fields and a pointer to the value otherwise.
+func (f PatchField[T]) ptr() *T {
+	if !f.Set || f.Null {
+		return nil
+	}
+	return &f.Value
+}
+
+// UserMergePatch is the body of PATCH /users/{id}.
+type UserMergePatch struct {
+	Firstname PatchField[string] `json:"firstname"`
+	Lastname  PatchField[string] `json:"lastname"`
+	Username  PatchField[string] `json:"username"`
+	Email     PatchField[string] `json:"email"`
+	// Metadata is merged into the user metadata namespace, null clears it.
+	Metadata PatchField[map[string]any] `json:"metadata"`
+}
+
+// ToUserPatch converts the merge patch into a repository patch. None of the
+// profile columns are nullable, so an explicit null is rejected instead of
+// clearing the field.
+func (p *UserMergePatch) ToUserPatch() (UserPatch, error) {
+	fields := []struct {
+		name string
+		null bool
+	}{
+		{"firstname", p.Firstname.Null},
+		{"lastname", p.Lastname.Null},
+		{"username", p.Username.Null},
+		{"email", p.Email.Null},
+	}
+	for _, field := range fields {
+		if field.null {
+			return UserPatch{}, fmt.Errorf("%s cannot be null", field.name)
+		}
+	}
+
+	return UserPatch{
+		Firstname: p.Firstname.ptr(),
+		Lastname:  p.Lastname.ptr(),
+		Username:  p.Username.ptr(),
+		Email:     p.Email.ptr(),
+	}, nil
+}
+
+// UserPatch is a partial profile update. Nil fields are left unchanged.
+type UserPatch struct {
+	Firstname *string `validate:"omitempty,min=3,max=30"`
+	Lastname  *string `validate:"omitempty,min=3,max=30"`
+	Username  *string `validate:"omitempty,min=3,max=30"`
+	Email     *string `validate:"omitempty,email"`
+	// Metadata replaces the stored metadata. Callers merge it with the stored
+	// value and set Version so that concurrent changes aren't lost.
+	Metadata *UserMetadata `validate:"-"`
+	// Version makes the update conditional on the stored version when it is
+	// not zero.
+	Version int `validate:"-"`
+}
+
+func (p *UserPatch) IsEmpty() bool {
+	return p.Firstname == nil && p.Lastname == nil && p.Username == nil && p.Email == nil && p.Metadata == nil
+}
+
+// MergeObject applies a JSON merge patch to target and returns the result.
+// target is left unchanged.
+func MergeObject(target, patch map[string]any) map[string]any {
+	result := make(map[string]any, len(target))
+	for key, value := range target {
+		result[key] = value
+	}
+
+	for key, value := range patch {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+
+		if nested, ok := value.(map[string]any); ok {
+			current, _ := result[key].(map[string]any)
+			result[key] = MergeObject(current, nested)
+			continue
+		}
+
+		result[key] = value
+	}
+
+	return result
+}
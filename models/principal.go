@@ -0,0 +1,36 @@
+package models
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PrincipalUser           = "user"
+	PrincipalServiceAccount = "service_account"
+)
+
+// Principal is the authenticated actor behind a request, either a human user
+// or a service account.
+type Principal struct {
+	ID   uuid.UUID `json:"id"`
+	Type string    `json:"type"`
+}
+
+func (p *Principal) IsUser() bool {
+	return p.Type == PrincipalUser
+}
+
+type principalContextKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying the principal. The
+// repositories read it back to record the actor of the changes they make.
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok
+}
@@ -0,0 +1,36 @@
+package models
+
+const (
+	UserStatusActive  = "active"
+	UserStatusLocked  = "locked"
+	UserStatusDeleted = "deleted"
+	UserStatusAll     = "all"
+)
+
+const (
+	SortCreatedAtAsc  = "created_at"
+	SortCreatedAtDesc = "-created_at"
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// UserSearchParams filters and pages through users. Results are ordered by
+// (created_at, id) so that pages stay stable while users are added.
+type UserSearchParams struct {
+	// Query matches names, username and email by prefix, and by trigram
+	// similarity where the backend supports it.
+	Query  string `json:"query" validate:"max=100"`
+	Status string `json:"status" validate:"omitempty,oneof=active locked deleted all"`
+	Sort   string `json:"sort" validate:"omitempty,oneof=created_at -created_at"`
+	Limit  int    `json:"limit" validate:"omitempty,min=1,max=100"`
+	// Cursor is the NextCursor of the previous page.
+	Cursor string `json:"cursor"`
+}
+
+type UserPage struct {
+	Users      []User `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ServiceAccount is a non-human principal owned by either a user or an
+// organization. It has no password and authenticates with client
+// credentials or access tokens.
+type ServiceAccount struct {
+	ID                  uuid.UUID  `json:"id"`
+	Name                string     `json:"name"`
+	Description         string     `json:"description"`
+	OwnerUserID         *uuid.UUID `json:"owner_user_id,omitempty" db:"owner_user_id"`
+	OwnerOrganizationID *uuid.UUID `json:"owner_organization_id,omitempty" db:"owner_organization_id"`
+	ClientSecretHash    string     `json:"-" db:"client_secret_hash"`
+	CreatedAt           time.Time  `json:"created_at,omitempty" db:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at,omitempty" db:"updated_at"`
+	DeletedAt           *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+func (s *ServiceAccount) Principal() Principal {
+	return Principal{ID: s.ID, Type: PrincipalServiceAccount}
+}
+
+type CreateServiceAccountInput struct {
+	Name        string `json:"name" validate:"required,min=3,max=100"`
+	Description string `json:"description" validate:"max=255"`
+}
+
+// ServiceAccountCredentialsResponse is the only time the client secret is
+// returned.
+type ServiceAccountCredentialsResponse struct {
+	ServiceAccount
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+type ClientCredentialsResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
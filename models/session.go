@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SessionTokenPrefix marks the opaque session IDs stored in the session
+// cookie, like AccessTokenPrefix does for personal access tokens.
+const SessionTokenPrefix = "ses_"
+
+// Session is a browser session of a user. The session ID in the cookie and
+// the CSRF token are only stored hashed.
+type Session struct {
+	ID            uuid.UUID  `json:"id"`
+	UserID        uuid.UUID  `json:"user_id" db:"user_id"`
+	TokenHash     string     `json:"-" db:"token_hash"`
+	CSRFTokenHash string     `json:"-" db:"csrf_token_hash"`
+	UserAgent     string     `json:"user_agent" db:"user_agent"`
+	IPAddress     string     `json:"ip_address" db:"ip_address"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	LastSeenAt    time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	IdleExpiresAt time.Time  `json:"idle_expires_at" db:"idle_expires_at"`
+	ExpiresAt     time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt     *time.Time `json:"-" db:"revoked_at"`
+}
+
+// IsActive reports whether the session is neither revoked nor expired, idle
+// or absolute.
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.IdleExpiresAt) && now.Before(s.ExpiresAt)
+}
+
+// CreateSessionResponse is returned once when a session starts. The CSRF
+// token is also set in a cookie readable by scripts.
+type CreateSessionResponse struct {
+	Session
+	CSRFToken string `json:"csrf_token"`
+}
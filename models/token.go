@@ -0,0 +1,88 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// AccessTokenPrefix marks personal access tokens so they can be told apart
+// from JWTs and recognised by secret scanners.
+const AccessTokenPrefix = "ast_"
+
+// Scopes is stored as a space separated list, like OAuth scopes.
+type Scopes []string
+
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, " "), nil
+}
+
+func (s *Scopes) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		*s = strings.Fields(v)
+	case []byte:
+		*s = strings.Fields(string(v))
+	case nil:
+		*s = nil
+	default:
+		return fmt.Errorf("cannot scan %T into Scopes", src)
+	}
+	return nil
+}
+
+func (s Scopes) Has(scope string) bool {
+	for _, v := range s {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type AccessToken struct {
+	ID               uuid.UUID  `json:"id"`
+	UserID           *uuid.UUID `json:"user_id,omitempty" db:"user_id"`
+	ServiceAccountID *uuid.UUID `json:"service_account_id,omitempty" db:"service_account_id"`
+	Name             string     `json:"name"`
+	Prefix           string     `json:"prefix"`
+	TokenHash        string     `json:"-" db:"token_hash"`
+	Scopes           Scopes     `json:"scopes"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt        time.Time  `json:"created_at,omitempty" db:"created_at"`
+}
+
+// Owner returns the principal the token authenticates as.
+func (t *AccessToken) Owner() Principal {
+	if t.ServiceAccountID != nil {
+		return Principal{ID: *t.ServiceAccountID, Type: PrincipalServiceAccount}
+	}
+	return Principal{ID: *t.UserID, Type: PrincipalUser}
+}
+
+// IsActive reports whether the token can still be used to authenticate.
+func (t *AccessToken) IsActive() bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt))
+}
+
+type CreateAccessTokenInput struct {
+	Name      string     `json:"name" validate:"required,min=1,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=read write"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" validate:"omitempty,gt"`
+}
+
+// CreateAccessTokenResponse is the only time the token secret is returned.
+type CreateAccessTokenResponse struct {
+	AccessToken
+	Token string `json:"token"`
+}
@@ -0,0 +1,34 @@
+package models
+
+// The TokenReview of the Kubernetes authentication.k8s.io/v1 API, as sent by
+// the API server to webhook token authenticators.
+const (
+	TokenReviewAPIVersion = "authentication.k8s.io/v1"
+	TokenReviewKind       = "TokenReview"
+)
+
+type TokenReview struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Spec       TokenReviewSpec   `json:"spec"`
+	Status     TokenReviewStatus `json:"status"`
+}
+
+type TokenReviewSpec struct {
+	Token     string   `json:"token,omitempty"`
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+type TokenReviewStatus struct {
+	Authenticated bool             `json:"authenticated"`
+	User          *TokenReviewUser `json:"user,omitempty"`
+	Audiences     []string         `json:"audiences,omitempty"`
+	Error         string           `json:"error,omitempty"`
+}
+
+type TokenReviewUser struct {
+	Username string              `json:"username"`
+	UID      string              `json:"uid"`
+	Groups   []string            `json:"groups,omitempty"`
+	Extra    map[string][]string `json:"extra,omitempty"`
+}
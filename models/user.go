@@ -5,7 +5,6 @@ import (
 	"io"
 	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 )
 
@@ -19,6 +18,20 @@ type User struct {
 	CreatedAt time.Time  `json:"created_at,omitempty" db:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at,omitempty" db:"updated_at"`
 	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	LockedAt  *time.Time `json:"locked_at,omitempty" db:"locked_at"`
+	// Version is incremented on every write and used for optimistic
+	// concurrency control.
+	Version int `json:"-" db:"version"`
+	// Metadata is never decoded from request bodies, it's only written
+	// through the metadata endpoints.
+	Metadata UserMetadata `json:"-" db:"metadata"`
+}
+
+// SignupInput is the signup payload. InvitationToken is optional unless the
+// service runs in invite-only mode.
+type SignupInput struct {
+	User
+	InvitationToken string `json:"invitation_token,omitempty"`
 }
 
 type LoginInput struct {
@@ -39,13 +52,14 @@ type UpdatePasswordInput struct {
 }
 
 type UserResponse struct {
-	ID        uuid.UUID `json:"id"`
-	Firstname string    `json:"firstname" validate:"required,min=3,max=30"`
-	Lastname  string    `json:"lastname" validate:"required,min=3,max=30"`
-	Username  string    `json:"username" validate:"omitempty,min=3,max=30"`
-	Email     string    `json:"email" validate:"required,email"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
-	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	ID        uuid.UUID    `json:"id"`
+	Firstname string       `json:"firstname" validate:"required,min=3,max=30"`
+	Lastname  string       `json:"lastname" validate:"required,min=3,max=30"`
+	Username  string       `json:"username" validate:"omitempty,min=3,max=30"`
+	Email     string       `json:"email" validate:"required,email"`
+	CreatedAt time.Time    `json:"created_at,omitempty"`
+	UpdatedAt time.Time    `json:"updated_at,omitempty"`
+	Metadata  UserMetadata `json:"metadata"`
 }
 
 func (u *User) ToJSON(w io.Writer) error {
@@ -56,7 +70,8 @@ func (u *User) FromJSON(r io.Reader) error {
 	return json.NewDecoder(r).Decode(u)
 }
 
+var validate = NewValidator()
+
 func (u *User) Validate() error {
-	v := validator.New()
-	return v.Struct(u)
+	return validate.Struct(u)
 }
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	// WebhookDeliveryFailed deliveries are retried until they run out of
+	// attempts and become dead.
+	WebhookDeliveryFailed = "failed"
+	WebhookDeliveryDead   = "dead"
+)
+
+// WebhookSecretPrefix marks webhook signing secrets.
+const WebhookSecretPrefix = "whsec_"
+
+// EventFilter selects the event types a webhook receives. It holds event
+// types, type prefixes like "user.*", or "*" for all events, and is stored as
+// a space separated list.
+type EventFilter []string
+
+func (f EventFilter) Value() (driver.Value, error) {
+	return strings.Join(f, " "), nil
+}
+
+func (f *EventFilter) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		*f = strings.Fields(v)
+	case []byte:
+		*f = strings.Fields(string(v))
+	case nil:
+		*f = nil
+	default:
+		return fmt.Errorf("cannot scan %T into EventFilter", src)
+	}
+	return nil
+}
+
+func (f EventFilter) Matches(eventType string) bool {
+	for _, pattern := range f {
+		if pattern == "*" || pattern == eventType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type Webhook struct {
+	ID        uuid.UUID   `json:"id"`
+	URL       string      `json:"url"`
+	Secret    string      `json:"-"`
+	Events    EventFilter `json:"events"`
+	CreatedAt time.Time   `json:"created_at,omitempty" db:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+type CreateWebhookInput struct {
+	URL    string   `json:"url" validate:"required,url,startswith=http"`
+	Events []string `json:"events" validate:"required,min=1,dive,required,max=64"`
+}
+
+// CreateWebhookResponse is the only time the signing secret is returned.
+type CreateWebhookResponse struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookDelivery is one event sent to one webhook, together with the
+// outcome of its last attempt.
+type WebhookDelivery struct {
+	ID             uuid.UUID  `json:"id"`
+	WebhookID      uuid.UUID  `json:"webhook_id" db:"webhook_id"`
+	EventID        uuid.UUID  `json:"event_id" db:"event_id"`
+	EventType      string     `json:"event_type" db:"event_type"`
+	Payload        RawJSON    `json:"-"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty" db:"next_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code,omitempty" db:"last_status_code"`
+	LastError      *string    `json:"last_error,omitempty" db:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty" db:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
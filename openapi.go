@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rovilay/auth-service/app"
+	"github.com/rovilay/auth-service/app/apptest"
+	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/openapi"
+	"github.com/rs/zerolog"
+)
+
+const openapiUsage = `usage: auth-service openapi <command>
+
+commands:
+  check         fail if the registered routes and the spec differ
+  print         write the spec to stdout`
+
+var (
+	errOpenAPIUsage = errors.New("invalid openapi command")
+	errOpenAPIDrift = errors.New("routes and OpenAPI spec differ")
+)
+
+// runOpenAPI implements the openapi subcommand.
+func runOpenAPI(c *config.AppConfig, log *zerolog.Logger, args []string) error {
+	if len(args) == 0 {
+		return errOpenAPIUsage
+	}
+
+	switch args[0] {
+	case "check":
+		// the deprecated unversioned aliases aren't documented
+		cfg := *c
+		cfg.LegacyRoutes = false
+		// optional features register their routes
+		cfg.Sessions = true
+		cfg.K8sWebhookToken = "check"
+
+		a := app.NewApp(apptest.FeatureRepository{}, &cfg, log)
+		drift, err := openapi.Drift(a.Routes(), app.DocsPath)
+		if err != nil {
+			return err
+		}
+		for _, route := range drift {
+			fmt.Fprintln(os.Stderr, route)
+		}
+		if len(drift) > 0 {
+			return errOpenAPIDrift
+		}
+		fmt.Println("routes match the OpenAPI spec")
+		return nil
+	case "print":
+		_, err := os.Stdout.Write(openapi.Spec())
+		return err
+	default:
+		return errOpenAPIUsage
+	}
+}
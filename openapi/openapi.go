@@ -0,0 +1,136 @@
+// Package openapi embeds the OpenAPI 3.1 document of the service. It serves
+// the document, validates requests against it and checks that it documents
+// exactly the registered routes.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// Spec returns the OpenAPI document.
+func Spec() []byte {
+	return spec
+}
+
+// Handler serves the OpenAPI document.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec)
+}
+
+// methods are the HTTP methods that can be documented as path operations.
+var methods = []string{
+	http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete,
+	http.MethodOptions, http.MethodHead, http.MethodPatch, http.MethodTrace,
+}
+
+type document struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Parameters map[string]parameter `json:"parameters"`
+	} `json:"components"`
+}
+
+type operation struct {
+	Parameters  []parameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool                       `json:"required"`
+		Content  map[string]json.RawMessage `json:"content"`
+	} `json:"requestBody"`
+}
+
+type parameter struct {
+	Ref  string `json:"$ref"`
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+func loadDocument() (*document, error) {
+	var doc document
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+	return &doc, nil
+}
+
+// operations returns the operations of a path item by upper case method. The
+// other fields of the path item, e.g. parameters, are skipped.
+func operations(item map[string]json.RawMessage) map[string]json.RawMessage {
+	ops := map[string]json.RawMessage{}
+	for _, method := range methods {
+		if op, ok := item[strings.ToLower(method)]; ok {
+			ops[method] = op
+		}
+	}
+	return ops
+}
+
+// Drift compares the routes registered on the router with the operations of
+// the document. It returns a description of every route that isn't
+// documented and every operation that isn't registered, nil when they match.
+// Paths with one of the ignore prefixes are skipped.
+func Drift(routes chi.Routes, ignore ...string) ([]string, error) {
+	doc, err := loadDocument()
+	if err != nil {
+		return nil, err
+	}
+
+	skip := func(path string) bool {
+		for _, prefix := range ignore {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	registered := map[string]bool{}
+	err = chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		// subrouters mounted with Route register their index as "/prefix/"
+		if route != "/" {
+			route = strings.TrimSuffix(route, "/")
+		}
+		if !skip(route) {
+			registered[method+" "+route] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk routes: %w", err)
+	}
+
+	documented := map[string]bool{}
+	for path, item := range doc.Paths {
+		if skip(path) {
+			continue
+		}
+		for method := range operations(item) {
+			documented[method+" "+path] = true
+		}
+	}
+
+	var drift []string
+	for route := range registered {
+		if !documented[route] {
+			drift = append(drift, fmt.Sprintf("%s is registered but not documented", route))
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			drift = append(drift, fmt.Sprintf("%s is documented but not registered", route))
+		}
+	}
+	sort.Strings(drift)
+
+	return drift, nil
+}
@@ -0,0 +1,430 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rovilay/auth-service/logging"
+	"github.com/rovilay/auth-service/problem"
+	"github.com/rovilay/auth-service/utils"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const (
+	specURL = "openapi.json"
+
+	contentTypeJSON = "application/json"
+	contentTypeForm = "application/x-www-form-urlencoded"
+)
+
+// Validator checks requests against the operations of the document, i.e.
+// their path parameters and request bodies.
+type Validator struct {
+	routes []*route
+	// raw is the decoded document, keyword values of failed validations are
+	// looked up in it.
+	raw any
+}
+
+type route struct {
+	method   string
+	segments []string
+	// literals is the number of segments without parameters, the route with
+	// the most literals wins when several match.
+	literals     int
+	params       map[string]*jsonschema.Schema
+	bodyRequired bool
+	content      map[string]*jsonschema.Schema
+}
+
+// NewValidator compiles the schemas of all operations.
+func NewValidator() (*Validator, error) {
+	doc, err := loadDocument()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Validator{}
+	if err := json.Unmarshal(spec, &v.raw); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+
+	c := jsonschema.NewCompiler()
+	c.Draft = jsonschema.Draft2020
+	c.AssertFormat = true
+	if err := c.AddResource(specURL, bytes.NewReader(spec)); err != nil {
+		return nil, fmt.Errorf("failed to load OpenAPI document: %w", err)
+	}
+
+	compile := func(pointer ...string) (*jsonschema.Schema, error) {
+		for i, token := range pointer {
+			pointer[i] = escape(token)
+		}
+		location := specURL + "#/" + strings.Join(pointer, "/")
+
+		schema, err := c.Compile(location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile %s: %w", location, err)
+		}
+		return schema, nil
+	}
+
+	for path, item := range doc.Paths {
+		for method, raw := range operations(item) {
+			var op operation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("failed to parse %s %s: %w", method, path, err)
+			}
+
+			rt := &route{
+				method:   method,
+				segments: strings.Split(path, "/"),
+				params:   map[string]*jsonschema.Schema{},
+				content:  map[string]*jsonschema.Schema{},
+			}
+			for _, segment := range rt.segments {
+				if !strings.HasPrefix(segment, "{") {
+					rt.literals++
+				}
+			}
+
+			for i, param := range op.Parameters {
+				pointer := []string{"paths", path, strings.ToLower(method), "parameters", strconv.Itoa(i), "schema"}
+				if name, found := strings.CutPrefix(param.Ref, "#/components/parameters/"); found {
+					param = doc.Components.Parameters[name]
+					pointer = []string{"components", "parameters", name, "schema"}
+				}
+				if param.In != "path" {
+					continue
+				}
+
+				if rt.params[param.Name], err = compile(pointer...); err != nil {
+					return nil, err
+				}
+			}
+
+			if op.RequestBody != nil {
+				rt.bodyRequired = op.RequestBody.Required
+				for contentType := range op.RequestBody.Content {
+					pointer := []string{"paths", path, strings.ToLower(method), "requestBody", "content", contentType, "schema"}
+					if rt.content[contentType], err = compile(pointer...); err != nil {
+						return nil, err
+					}
+				}
+			}
+
+			v.routes = append(v.routes, rt)
+		}
+	}
+
+	return v, nil
+}
+
+// Middleware rejects requests that don't match their operation with a
+// validation_failed problem. Requests for undocumented routes are passed on.
+// prefix is prepended to the request path to find the operation, e.g. /v1
+// for routes that alias the documented ones.
+func (v *Validator) Middleware(prefix string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			v.serve(w, r, prefix+r.URL.Path, next)
+		})
+	}
+}
+
+// serve validates the request against the operation at path.
+func (v *Validator) serve(w http.ResponseWriter, r *http.Request, path string, next http.Handler) {
+	rt, params := v.match(r.Method, path)
+	if rt == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	lang := problem.Language(r)
+	var errs []problem.FieldError
+
+	names := make([]string, 0, len(rt.params))
+	for name := range rt.params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := rt.params[name].Validate(params[name]); err != nil {
+			errs = append(errs, v.fieldErrors(lang, name, err)...)
+		}
+	}
+
+	if len(rt.content) > 0 {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeProblem(w, r, problem.New(fmt.Errorf("%w: %w", utils.ErrMalformedBody, err), 0, "", lang))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if len(body) > 0 || rt.bodyRequired {
+			fieldErrs, p := v.validateBody(r, rt, body, lang)
+			if p != nil {
+				writeProblem(w, r, p)
+				return
+			}
+			errs = append(errs, fieldErrs...)
+		}
+	}
+
+	if len(errs) > 0 {
+		writeProblem(w, r, problem.Validation(lang, errs))
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// validateBody checks the body against the schema of its content type. It
+// returns a problem when the body can't be validated at all.
+func (v *Validator) validateBody(r *http.Request, rt *route, body []byte, lang string) ([]problem.FieldError, *problem.Problem) {
+	// the handlers decode JSON when the content type is missing
+	contentType := contentTypeJSON
+	if header := r.Header.Get("Content-Type"); header != "" {
+		mediaType, _, err := mime.ParseMediaType(header)
+		if err != nil {
+			return nil, problem.New(utils.ErrUnsupportedMediaType, 0, "", lang)
+		}
+		contentType = mediaType
+	}
+
+	schema, ok := rt.content[contentType]
+	if !ok {
+		return nil, problem.New(utils.ErrUnsupportedMediaType, 0, "", lang)
+	}
+
+	if len(body) == 0 {
+		return nil, problem.New(utils.ErrMalformedBody, 0, "the request body is required", lang)
+	}
+
+	var value any
+	if contentType == contentTypeForm {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, problem.New(utils.ErrMalformedBody, 0, "the request body is not a valid form", lang)
+		}
+		fields := map[string]any{}
+		for name := range form {
+			fields[name] = form.Get(name)
+		}
+		value = fields
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return nil, problem.New(utils.ErrMalformedBody, 0, "the request body is not valid JSON", lang)
+		}
+	}
+
+	if err := schema.Validate(value); err != nil {
+		return v.fieldErrors(lang, "", err), nil
+	}
+	return nil, nil
+}
+
+// match finds the operation of the request and extracts its path parameters.
+func (v *Validator) match(method, path string) (*route, map[string]string) {
+	segments := strings.Split(path, "/")
+
+	var best *route
+	for _, rt := range v.routes {
+		if rt.method != method || len(rt.segments) != len(segments) {
+			continue
+		}
+		if best != nil && best.literals >= rt.literals {
+			continue
+		}
+		if matchSegments(rt.segments, segments) {
+			best = rt
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+
+	params := map[string]string{}
+	for i, segment := range best.segments {
+		if name, found := strings.CutPrefix(segment, "{"); found {
+			params[strings.TrimSuffix(name, "}")] = segments[i]
+		}
+	}
+	return best, params
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for i, segment := range pattern {
+		if !strings.HasPrefix(segment, "{") && segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// quotedNames matches the property names listed in the messages of the
+// required and additionalProperties keywords.
+var quotedNames = regexp.MustCompile(`'([^']*)'`)
+
+// fieldErrors converts a schema validation error to field errors using the
+// codes of the validator tags where there is one, e.g. min for minLength.
+// prefix is the name of the validated value, empty for request bodies.
+func (v *Validator) fieldErrors(lang, prefix string, err error) []problem.FieldError {
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return []problem.FieldError{{Field: prefix, Code: "invalid", Message: problem.FieldMessage(lang, "invalid", "", false)}}
+	}
+
+	var errs []problem.FieldError
+	add := func(field, code, param string, items bool) {
+		errs = append(errs, problem.FieldError{
+			Field:   field,
+			Code:    code,
+			Message: problem.FieldMessage(lang, code, param, items),
+		})
+	}
+
+	for _, leaf := range leaves(verr) {
+		field := fieldName(prefix, leaf.InstanceLocation)
+		keyword := leaf.KeywordLocation[strings.LastIndex(leaf.KeywordLocation, "/")+1:]
+		value := v.keywordValue(leaf.AbsoluteKeywordLocation)
+
+		switch keyword {
+		case "required", "additionalProperties":
+			code := "required"
+			if keyword == "additionalProperties" {
+				code = "unknown"
+			}
+			for _, name := range quotedNames.FindAllStringSubmatch(leaf.Message, -1) {
+				add(joinField(field, name[1]), code, "", false)
+			}
+		case "minLength", "minItems":
+			add(field, "min", fmt.Sprint(value), keyword == "minItems")
+		case "maxLength", "maxItems":
+			add(field, "max", fmt.Sprint(value), keyword == "maxItems")
+		case "enum", "const":
+			var options []string
+			if list, ok := value.([]any); ok {
+				for _, option := range list {
+					options = append(options, fmt.Sprint(option))
+				}
+			} else {
+				options = append(options, fmt.Sprint(value))
+			}
+			add(field, "oneof", strings.Join(options, " "), false)
+		case "format":
+			format := fmt.Sprint(value)
+			switch format {
+			case "uri":
+				format = "url"
+			case "date-time":
+				format = "datetime"
+			}
+			add(field, format, "", false)
+		default:
+			add(field, keyword, "", false)
+		}
+	}
+
+	// the schema validates properties in random order
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Field < errs[j].Field
+	})
+
+	return errs
+}
+
+// leaves returns the errors that caused err. Only the last alternative of an
+// anyOf or oneOf is reported, the spec lists the alternative that describes
+// the field last.
+func leaves(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+
+	switch err.KeywordLocation[strings.LastIndex(err.KeywordLocation, "/")+1:] {
+	case "anyOf", "oneOf":
+		return leaves(err.Causes[len(err.Causes)-1])
+	}
+
+	var errs []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		errs = append(errs, leaves(cause)...)
+	}
+	return errs
+}
+
+// keywordValue looks up the value of the keyword at an absolute keyword
+// location in the document.
+func (v *Validator) keywordValue(location string) any {
+	_, pointer, _ := strings.Cut(location, "#")
+
+	value := v.raw
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = unescape(token)
+		switch node := value.(type) {
+		case map[string]any:
+			value = node[token]
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			value = node[i]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// fieldName converts an instance location to the field names used by the
+// validator, e.g. events[0] for /events/0.
+func fieldName(prefix, location string) string {
+	field := prefix
+	for _, token := range strings.Split(strings.TrimPrefix(location, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = unescape(token)
+		if _, err := strconv.Atoi(token); err == nil {
+			field += "[" + token + "]"
+			continue
+		}
+		field = joinField(field, token)
+	}
+	return field
+}
+
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// escape and unescape convert JSON pointer reference tokens, see RFC 6901.
+func escape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func unescape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, p *problem.Problem) {
+	p.RequestID = logging.RequestIDFromContext(r.Context())
+	problem.Write(w, r, p)
+}
@@ -0,0 +1,259 @@
+package problem
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/language"
+)
+
+// languages are the supported response languages, the first is the default.
+var languages = []language.Tag{language.English, language.German, language.French}
+
+var matcher = language.NewMatcher(languages)
+
+// Language picks the response language from the Accept-Language header.
+func Language(r *http.Request) string {
+	return AcceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+// AcceptLanguage picks the response language from the value of an
+// Accept-Language header, for requests that don't come as an http.Request.
+func AcceptLanguage(header string) string {
+	tag, _ := language.MatchStrings(matcher, header)
+	base, _ := tag.Base()
+	return base.String()
+}
+
+var titles = map[string]map[Code]string{
+	"en": {
+		CodeBadRequest:               "The request is invalid.",
+		CodeMalformedBody:            "The request body could not be read.",
+		CodeValidationFailed:         "The request contains invalid fields.",
+		CodeUnauthorized:             "You are not authorized to access this resource.",
+		CodeMissingToken:             "An authorization token is required.",
+		CodeInvalidToken:             "The token is invalid or has expired.",
+		CodeInvalidAccessToken:       "The access token is invalid, expired or revoked.",
+		CodeInsufficientScope:        "The access token lacks the required scope.",
+		CodeInvalidSession:           "The session is invalid or has expired.",
+		CodeInvalidCSRFToken:         "The CSRF token is missing or invalid.",
+		CodeInvalidCredentials:       "The email or password is incorrect.",
+		CodeInvalidPassword:          "The password is incorrect.",
+		CodeInvalidClientCredentials: "The client credentials are invalid.",
+		CodeUnsupportedGrantType:     "The grant type is not supported.",
+		CodeForbidden:                "You don't have permission to do this.",
+		CodeNotFound:                 "The resource was not found.",
+		CodeUserNotFound:             "The user was not found.",
+		CodeOrganizationNotFound:     "The organization was not found.",
+		CodeInvitationNotFound:       "The invitation was not found.",
+		CodeAccessTokenNotFound:      "The access token was not found.",
+		CodeServiceAccountNotFound:   "The service account was not found.",
+		CodeWebhookNotFound:          "The webhook was not found.",
+		CodeWebhookDeliveryNotFound:  "The webhook delivery was not found.",
+		CodeMethodNotAllowed:         "The method is not allowed for this resource.",
+		CodeDuplicateEntry:           "A user with this email or username already exists.",
+		CodeInvalidReference:         "The request references a resource that doesn't exist.",
+		CodeDuplicateInvitation:      "A pending invitation already exists for this email.",
+		CodeInvalidInvitation:        "The invitation is invalid or has expired.",
+		CodeInvitationRequired:       "Signing up requires a valid invitation.",
+		CodeInvalidCursor:            "The pagination cursor is invalid.",
+		CodeInvalidMetadata:          "The metadata doesn't match its schema.",
+		CodeInvalidEventFilter:       "The event filter is invalid.",
+		CodeConflict:                 "The request conflicts with the current state of the resource.",
+		CodeVersionConflict:          "The resource was modified concurrently.",
+		CodePreconditionFailed:       "The resource doesn't match the If-Match precondition.",
+		CodeUnsupportedMediaType:     "The content type is not supported.",
+		CodeInternal:                 "Something went wrong.",
+	},
+	"de": {
+		CodeBadRequest:               "Die Anfrage ist ungültig.",
+		CodeMalformedBody:            "Der Inhalt der Anfrage konnte nicht gelesen werden.",
+		CodeValidationFailed:         "Die Anfrage enthält ungültige Felder.",
+		CodeUnauthorized:             "Sie sind nicht berechtigt, auf diese Ressource zuzugreifen.",
+		CodeMissingToken:             "Ein Autorisierungstoken ist erforderlich.",
+		CodeInvalidToken:             "Das Token ist ungültig oder abgelaufen.",
+		CodeInvalidAccessToken:       "Das Zugriffstoken ist ungültig, abgelaufen oder widerrufen.",
+		CodeInsufficientScope:        "Dem Zugriffstoken fehlt der erforderliche Scope.",
+		CodeInvalidSession:           "Die Sitzung ist ungültig oder abgelaufen.",
+		CodeInvalidCSRFToken:         "Das CSRF-Token fehlt oder ist ungültig.",
+		CodeInvalidCredentials:       "E-Mail-Adresse oder Passwort ist falsch.",
+		CodeInvalidPassword:          "Das Passwort ist falsch.",
+		CodeInvalidClientCredentials: "Die Client-Zugangsdaten sind ungültig.",
+		CodeUnsupportedGrantType:     "Der Grant-Typ wird nicht unterstützt.",
+		CodeForbidden:                "Sie haben keine Berechtigung dafür.",
+		CodeNotFound:                 "Die Ressource wurde nicht gefunden.",
+		CodeUserNotFound:             "Der Benutzer wurde nicht gefunden.",
+		CodeOrganizationNotFound:     "Die Organisation wurde nicht gefunden.",
+		CodeInvitationNotFound:       "Die Einladung wurde nicht gefunden.",
+		CodeAccessTokenNotFound:      "Das Zugriffstoken wurde nicht gefunden.",
+		CodeServiceAccountNotFound:   "Das Dienstkonto wurde nicht gefunden.",
+		CodeWebhookNotFound:          "Der Webhook wurde nicht gefunden.",
+		CodeWebhookDeliveryNotFound:  "Die Webhook-Zustellung wurde nicht gefunden.",
+		CodeMethodNotAllowed:         "Die Methode ist für diese Ressource nicht erlaubt.",
+		CodeDuplicateEntry:           "Ein Benutzer mit dieser E-Mail-Adresse oder diesem Benutzernamen existiert bereits.",
+		CodeInvalidReference:         "Die Anfrage verweist auf eine Ressource, die nicht existiert.",
+		CodeDuplicateInvitation:      "Für diese E-Mail-Adresse gibt es bereits eine offene Einladung.",
+		CodeInvalidInvitation:        "Die Einladung ist ungültig oder abgelaufen.",
+		CodeInvitationRequired:       "Für die Registrierung ist eine gültige Einladung erforderlich.",
+		CodeInvalidCursor:            "Der Paginierungs-Cursor ist ungültig.",
+		CodeInvalidMetadata:          "Die Metadaten entsprechen nicht ihrem Schema.",
+		CodeInvalidEventFilter:       "Der Ereignisfilter ist ungültig.",
+		CodeConflict:                 "Die Anfrage steht im Konflikt mit dem aktuellen Zustand der Ressource.",
+		CodeVersionConflict:          "Die Ressource wurde gleichzeitig geändert.",
+		CodePreconditionFailed:       "Die Ressource entspricht nicht der If-Match-Bedingung.",
+		CodeUnsupportedMediaType:     "Der Inhaltstyp wird nicht unterstützt.",
+		CodeInternal:                 "Etwas ist schiefgelaufen.",
+	},
+	"fr": {
+		CodeBadRequest:               "La requête est invalide.",
+		CodeMalformedBody:            "Le corps de la requête n'a pas pu être lu.",
+		CodeValidationFailed:         "La requête contient des champs invalides.",
+		CodeUnauthorized:             "Vous n'êtes pas autorisé à accéder à cette ressource.",
+		CodeMissingToken:             "Un jeton d'autorisation est requis.",
+		CodeInvalidToken:             "Le jeton est invalide ou a expiré.",
+		CodeInvalidAccessToken:       "Le jeton d'accès est invalide, expiré ou révoqué.",
+		CodeInsufficientScope:        "Le jeton d'accès n'a pas la portée requise.",
+		CodeInvalidSession:           "La session est invalide ou a expiré.",
+		CodeInvalidCSRFToken:         "Le jeton CSRF est manquant ou invalide.",
+		CodeInvalidCredentials:       "L'adresse e-mail ou le mot de passe est incorrect.",
+		CodeInvalidPassword:          "Le mot de passe est incorrect.",
+		CodeInvalidClientCredentials: "Les identifiants du client sont invalides.",
+		CodeUnsupportedGrantType:     "Le type d'autorisation n'est pas pris en charge.",
+		CodeForbidden:                "Vous n'avez pas la permission de faire cela.",
+		CodeNotFound:                 "La ressource est introuvable.",
+		CodeUserNotFound:             "L'utilisateur est introuvable.",
+		CodeOrganizationNotFound:     "L'organisation est introuvable.",
+		CodeInvitationNotFound:       "L'invitation est introuvable.",
+		CodeAccessTokenNotFound:      "Le jeton d'accès est introuvable.",
+		CodeServiceAccountNotFound:   "Le compte de service est introuvable.",
+		CodeWebhookNotFound:          "Le webhook est introuvable.",
+		CodeWebhookDeliveryNotFound:  "La livraison du webhook est introuvable.",
+		CodeMethodNotAllowed:         "La méthode n'est pas autorisée pour cette ressource.",
+		CodeDuplicateEntry:           "Un utilisateur avec cette adresse e-mail ou ce nom d'utilisateur existe déjà.",
+		CodeInvalidReference:         "La requête fait référence à une ressource qui n'existe pas.",
+		CodeDuplicateInvitation:      "Une invitation en attente existe déjà pour cette adresse e-mail.",
+		CodeInvalidInvitation:        "L'invitation est invalide ou a expiré.",
+		CodeInvitationRequired:       "L'inscription nécessite une invitation valide.",
+		CodeInvalidCursor:            "Le curseur de pagination est invalide.",
+		CodeInvalidMetadata:          "Les métadonnées ne correspondent pas à leur schéma.",
+		CodeInvalidEventFilter:       "Le filtre d'événements est invalide.",
+		CodeConflict:                 "La requête est en conflit avec l'état actuel de la ressource.",
+		CodeVersionConflict:          "La ressource a été modifiée simultanément.",
+		CodePreconditionFailed:       "La ressource ne correspond pas à la condition If-Match.",
+		CodeUnsupportedMediaType:     "Le type de contenu n'est pas pris en charge.",
+		CodeInternal:                 "Une erreur s'est produite.",
+	},
+}
+
+// Codes returns every problem code the service responds with.
+func Codes() []Code {
+	codes := make([]Code, 0, len(titles["en"]))
+	for code := range titles["en"] {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+// Title returns the localized title of code, falling back to English.
+func Title(lang string, code Code) string {
+	if title, ok := titles[lang][code]; ok {
+		return title
+	}
+	return titles["en"][code]
+}
+
+// fieldMessages are the localized messages of the validation rules. %s is
+// replaced with the rule's parameter. The _items variants are used for
+// slices and maps.
+var fieldMessages = map[string]map[string]string{
+	"en": {
+		"required":   "is required",
+		"email":      "must be a valid email address",
+		"url":        "must be a valid URL",
+		"uuid":       "must be a valid UUID",
+		"min":        "must be at least %s characters long",
+		"min_items":  "must contain at least %s items",
+		"max":        "must be at most %s characters long",
+		"max_items":  "must contain at most %s items",
+		"len":        "must be exactly %s characters long",
+		"len_items":  "must contain exactly %s items",
+		"oneof":      "must be one of: %s",
+		"startswith": "must start with %s",
+		"unknown":    "is not a known field",
+		"invalid":    "is invalid",
+	},
+	"de": {
+		"required":   "ist erforderlich",
+		"email":      "muss eine gültige E-Mail-Adresse sein",
+		"url":        "muss eine gültige URL sein",
+		"uuid":       "muss eine gültige UUID sein",
+		"min":        "muss mindestens %s Zeichen lang sein",
+		"min_items":  "muss mindestens %s Einträge enthalten",
+		"max":        "darf höchstens %s Zeichen lang sein",
+		"max_items":  "darf höchstens %s Einträge enthalten",
+		"len":        "muss genau %s Zeichen lang sein",
+		"len_items":  "muss genau %s Einträge enthalten",
+		"oneof":      "muss einer der folgenden Werte sein: %s",
+		"startswith": "muss mit %s beginnen",
+		"unknown":    "ist kein bekanntes Feld",
+		"invalid":    "ist ungültig",
+	},
+	"fr": {
+		"required":   "est obligatoire",
+		"email":      "doit être une adresse e-mail valide",
+		"url":        "doit être une URL valide",
+		"uuid":       "doit être un UUID valide",
+		"min":        "doit contenir au moins %s caractères",
+		"min_items":  "doit contenir au moins %s éléments",
+		"max":        "doit contenir au plus %s caractères",
+		"max_items":  "doit contenir au plus %s éléments",
+		"len":        "doit contenir exactement %s caractères",
+		"len_items":  "doit contenir exactement %s éléments",
+		"oneof":      "doit être l'une des valeurs suivantes : %s",
+		"startswith": "doit commencer par %s",
+		"unknown":    "n'est pas un champ connu",
+		"invalid":    "est invalide",
+	},
+}
+
+func fieldMessage(lang string, fe validator.FieldError) string {
+	var items bool
+	switch fe.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		items = true
+	}
+
+	return FieldMessage(lang, fe.Tag(), fe.Param(), items)
+}
+
+// FieldMessage returns the localized message of a validation rule, falling
+// back to English and to a generic message for unknown rules. items selects
+// the variant for slices and maps.
+func FieldMessage(lang, rule, param string, items bool) string {
+	messages, ok := fieldMessages[lang]
+	if !ok {
+		messages = fieldMessages["en"]
+	}
+
+	key := rule
+	if items {
+		if _, ok := messages[key+"_items"]; ok {
+			key += "_items"
+		}
+	}
+
+	message, ok := messages[key]
+	if !ok {
+		return messages["invalid"]
+	}
+
+	if strings.Contains(message, "%s") {
+		return fmt.Sprintf(message, param)
+	}
+	return message
+}
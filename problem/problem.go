@@ -0,0 +1,257 @@
+// Package problem renders errors as RFC 7807 application/problem+json
+// documents. Every problem carries a stable machine readable code that
+// clients should match on instead of the human readable title and detail,
+// which are localized and may change.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rovilay/auth-service/utils"
+)
+
+const ContentType = "application/problem+json"
+
+// TypePrefix prefixes the code to build the problem type URI.
+const TypePrefix = "urn:auth-service:problem:"
+
+type Code string
+
+const (
+	CodeBadRequest               Code = "bad_request"
+	CodeMalformedBody            Code = "malformed_body"
+	CodeValidationFailed         Code = "validation_failed"
+	CodeUnauthorized             Code = "unauthorized"
+	CodeMissingToken             Code = "missing_token"
+	CodeInvalidToken             Code = "invalid_token"
+	CodeInvalidAccessToken       Code = "invalid_access_token"
+	CodeInsufficientScope        Code = "insufficient_scope"
+	CodeInvalidSession           Code = "invalid_session"
+	CodeInvalidCSRFToken         Code = "invalid_csrf_token"
+	CodeInvalidCredentials       Code = "invalid_credentials"
+	CodeInvalidPassword          Code = "invalid_password"
+	CodeInvalidClientCredentials Code = "invalid_client_credentials"
+	CodeUnsupportedGrantType     Code = "unsupported_grant_type"
+	CodeForbidden                Code = "forbidden"
+	CodeNotFound                 Code = "not_found"
+	CodeUserNotFound             Code = "user_not_found"
+	CodeOrganizationNotFound     Code = "organization_not_found"
+	CodeInvitationNotFound       Code = "invitation_not_found"
+	CodeAccessTokenNotFound      Code = "access_token_not_found"
+	CodeServiceAccountNotFound   Code = "service_account_not_found"
+	CodeWebhookNotFound          Code = "webhook_not_found"
+	CodeWebhookDeliveryNotFound  Code = "webhook_delivery_not_found"
+	CodeMethodNotAllowed         Code = "method_not_allowed"
+	CodeDuplicateEntry           Code = "duplicate_entry"
+	CodeInvalidReference         Code = "invalid_reference"
+	CodeDuplicateInvitation      Code = "duplicate_invitation"
+	CodeInvalidInvitation        Code = "invalid_invitation"
+	CodeInvitationRequired       Code = "invitation_required"
+	CodeInvalidCursor            Code = "invalid_cursor"
+	CodeInvalidMetadata          Code = "invalid_metadata"
+	CodeInvalidEventFilter       Code = "invalid_event_filter"
+	CodeConflict                 Code = "conflict"
+	CodeVersionConflict          Code = "version_conflict"
+	CodePreconditionFailed       Code = "precondition_failed"
+	CodeUnsupportedMediaType     Code = "unsupported_media_type"
+	CodeInternal                 Code = "internal_error"
+)
+
+// sentinel maps a utils error to its response. exposeDetail is set for errors
+// that wrap details meant for the client, e.g. metadata schema violations.
+type sentinel struct {
+	err          error
+	status       int
+	code         Code
+	exposeDetail bool
+}
+
+var sentinels = []sentinel{
+	{err: utils.ErrMalformedBody, status: http.StatusBadRequest, code: CodeMalformedBody},
+	{err: utils.ErrDuplicateEntry, status: http.StatusBadRequest, code: CodeDuplicateEntry},
+	{err: utils.ErrForeignKeyViolation, status: http.StatusBadRequest, code: CodeInvalidReference},
+	{err: utils.ErrDuplicateInvitation, status: http.StatusBadRequest, code: CodeDuplicateInvitation},
+	{err: utils.ErrInvalidInvitation, status: http.StatusBadRequest, code: CodeInvalidInvitation},
+	{err: utils.ErrUnsupportedGrantType, status: http.StatusBadRequest, code: CodeUnsupportedGrantType},
+	{err: utils.ErrInvalidMetadata, status: http.StatusBadRequest, code: CodeInvalidMetadata, exposeDetail: true},
+	{err: utils.ErrInvalidEventFilter, status: http.StatusBadRequest, code: CodeInvalidEventFilter},
+	{err: utils.ErrInvalidCursor, status: http.StatusBadRequest, code: CodeInvalidCursor},
+	{err: utils.ErrInvalidPassword, status: http.StatusBadRequest, code: CodeInvalidPassword},
+	{err: utils.ErrNotFound, status: http.StatusNotFound, code: CodeUserNotFound},
+	{err: utils.ErrOrganizationNotFound, status: http.StatusNotFound, code: CodeOrganizationNotFound},
+	{err: utils.ErrInvitationNotFound, status: http.StatusNotFound, code: CodeInvitationNotFound},
+	{err: utils.ErrAccessTokenNotFound, status: http.StatusNotFound, code: CodeAccessTokenNotFound},
+	{err: utils.ErrServiceAccountNotFound, status: http.StatusNotFound, code: CodeServiceAccountNotFound},
+	{err: utils.ErrWebhookNotFound, status: http.StatusNotFound, code: CodeWebhookNotFound},
+	{err: utils.ErrWebhookDeliveryNotFound, status: http.StatusNotFound, code: CodeWebhookDeliveryNotFound},
+	{err: utils.ErrRouteNotFound, status: http.StatusNotFound, code: CodeNotFound},
+	{err: utils.ErrMethodNotAllowed, status: http.StatusMethodNotAllowed, code: CodeMethodNotAllowed},
+	{err: utils.ErrForbidden, status: http.StatusForbidden, code: CodeForbidden},
+	{err: utils.ErrInvitationRequired, status: http.StatusForbidden, code: CodeInvitationRequired},
+	{err: utils.ErrInsufficientScope, status: http.StatusForbidden, code: CodeInsufficientScope},
+	{err: utils.ErrInvalidCSRFToken, status: http.StatusForbidden, code: CodeInvalidCSRFToken},
+	{err: utils.ErrMissingAuthToken, status: http.StatusUnauthorized, code: CodeMissingToken},
+	{err: utils.ErrInvalidAccessToken, status: http.StatusUnauthorized, code: CodeInvalidAccessToken},
+	{err: utils.ErrInvalidToken, status: http.StatusUnauthorized, code: CodeInvalidToken},
+	{err: utils.ErrInvalidSession, status: http.StatusUnauthorized, code: CodeInvalidSession},
+	{err: utils.ErrUserUnAuthorized, status: http.StatusUnauthorized, code: CodeUnauthorized},
+	{err: utils.ErrInvalidCredentials, status: http.StatusUnauthorized, code: CodeInvalidCredentials},
+	{err: utils.ErrInvalidClientCredentials, status: http.StatusUnauthorized, code: CodeInvalidClientCredentials},
+	{err: utils.ErrPreconditionFailed, status: http.StatusPreconditionFailed, code: CodePreconditionFailed},
+	{err: utils.ErrVersionConflict, status: http.StatusConflict, code: CodeVersionConflict},
+	{err: utils.ErrUnsupportedMediaType, status: http.StatusUnsupportedMediaType, code: CodeUnsupportedMediaType},
+}
+
+// statusCodes are the codes of errors that aren't utils errors.
+var statusCodes = map[int]Code{
+	http.StatusBadRequest:           CodeBadRequest,
+	http.StatusUnauthorized:         CodeUnauthorized,
+	http.StatusForbidden:            CodeForbidden,
+	http.StatusNotFound:             CodeNotFound,
+	http.StatusMethodNotAllowed:     CodeMethodNotAllowed,
+	http.StatusConflict:             CodeConflict,
+	http.StatusPreconditionFailed:   CodePreconditionFailed,
+	http.StatusUnsupportedMediaType: CodeUnsupportedMediaType,
+}
+
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      Code         `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes why a single request field failed validation. Code is
+// the failed validation rule, e.g. required or min.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return fmt.Sprintf("%s: %s", p.Code, p.Detail)
+	}
+	return string(p.Code)
+}
+
+// New builds the problem for err in the language lang, see Language.
+//
+// utils errors and validation errors get their own status and code. Other
+// errors get status, or 500 when it is 0, and detail. Their message is never
+// exposed since it may come from the database or a library, detail has to be
+// written for the client.
+func New(err error, status int, detail string, lang string) *Problem {
+	p := &Problem{Status: status, Detail: detail}
+
+	var validationErrs validator.ValidationErrors
+	if s, ok := findSentinel(err); ok {
+		p.Status, p.Code = s.status, s.code
+		if s.exposeDetail {
+			p.Detail = err.Error()
+		}
+	} else if errors.As(err, &validationErrs) {
+		p.Status, p.Code = http.StatusBadRequest, CodeValidationFailed
+		p.Detail = ""
+		for _, fe := range validationErrs {
+			p.Errors = append(p.Errors, FieldError{
+				Field:   fieldName(fe),
+				Code:    fe.Tag(),
+				Message: fieldMessage(lang, fe),
+			})
+		}
+	} else {
+		if p.Status == 0 {
+			p.Status = http.StatusInternalServerError
+		}
+		p.Code = codeForStatus(p.Status)
+	}
+
+	p.Type = TypePrefix + string(p.Code)
+	p.Title = Title(lang, p.Code)
+
+	return p
+}
+
+// Validation builds the problem for field errors found outside of the
+// validator, e.g. by validating the request against the OpenAPI spec.
+func Validation(lang string, errs []FieldError) *Problem {
+	return &Problem{
+		Type:   TypePrefix + string(CodeValidationFailed),
+		Title:  Title(lang, CodeValidationFailed),
+		Status: http.StatusBadRequest,
+		Code:   CodeValidationFailed,
+		Errors: errs,
+	}
+}
+
+// Write sends p in the language of the request. The instance is the request
+// path.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+
+	if p.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", Challenge(p.Code))
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Content-Language", Language(r))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+
+	json.NewEncoder(w).Encode(p)
+}
+
+func findSentinel(err error) (sentinel, bool) {
+	for _, s := range sentinels {
+		if errors.Is(err, s.err) {
+			return s, true
+		}
+	}
+	return sentinel{}, false
+}
+
+func codeForStatus(status int) Code {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status < http.StatusInternalServerError {
+		return CodeBadRequest
+	}
+	return CodeInternal
+}
+
+// Challenge is the WWW-Authenticate header of a 401 problem with code.
+func Challenge(code Code) string {
+	return fmt.Sprintf(`Bearer error=%q`, bearerError(code))
+}
+
+// bearerError is the RFC 6750 error code of a 401 response.
+func bearerError(code Code) string {
+	if code == CodeMissingToken {
+		return "invalid_request"
+	}
+	return "invalid_token"
+}
+
+// fieldName is the path of the field without the name of the validated
+// struct, e.g. events[0] for CreateWebhookInput.events[0].
+func fieldName(fe validator.FieldError) string {
+	_, name, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return name
+}
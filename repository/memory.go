@@ -0,0 +1,430 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/utils"
+	"github.com/rs/zerolog"
+)
+
+// memoryRepository is a thread-safe in-memory UserRepository. It mirrors the
+// postgres semantics: email and username are unique across all users,
+// including deleted ones, and deleted users can't be read or updated.
+type memoryRepository struct {
+	mu       sync.RWMutex
+	users    map[uuid.UUID]models.User
+	tokens   map[uuid.UUID]models.AccessToken
+	sessions map[uuid.UUID]models.Session
+	events   []models.Event
+	log      *zerolog.Logger
+}
+
+func NewMemoryRepository(log *zerolog.Logger) *memoryRepository {
+	logger := log.With().Str("repository", "memoryRepository").Logger()
+
+	return &memoryRepository{
+		users:    make(map[uuid.UUID]models.User),
+		tokens:   make(map[uuid.UUID]models.AccessToken),
+		sessions: make(map[uuid.UUID]models.Session),
+		log:      &logger,
+	}
+}
+
+func (r *memoryRepository) CreateUser(ctx context.Context, user *models.User) error {
+	log := r.log.With().Str("method", "CreateUser").Ctx(ctx).Logger()
+
+	hashedPassword, err := utils.HashPassword(ctx, user.Password)
+	if err != nil {
+		log.Err(err).Msg(utils.ErrPasswordHash.Error())
+		return utils.ErrPasswordHash
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.users[user.ID]; exists {
+		return utils.ErrDuplicateEntry
+	}
+	if r.conflicts(user.ID, user.Username, user.Email) {
+		return utils.ErrDuplicateEntry
+	}
+
+	now := time.Now()
+	user.Password = hashedPassword
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.DeletedAt = nil
+	user.Version = 1
+
+	if err := r.appendUserEvent(ctx, models.EventUserCreated, user, nil); err != nil {
+		return err
+	}
+
+	r.users[user.ID] = *user
+
+	return nil
+}
+
+// UpdateUser writes the profile only if user.Version is still the stored
+// version, and returns utils.ErrVersionConflict otherwise.
+func (r *memoryRepository) UpdateUser(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[user.ID]
+	if !ok || stored.DeletedAt != nil {
+		return utils.ErrNotFound
+	}
+
+	if stored.Version != user.Version {
+		return utils.ErrVersionConflict
+	}
+
+	if r.conflicts(user.ID, user.Username, user.Email) {
+		return utils.ErrDuplicateEntry
+	}
+
+	before := stored
+	stored.Firstname = user.Firstname
+	stored.Lastname = user.Lastname
+	stored.Username = user.Username
+	stored.Email = user.Email
+	stored.UpdatedAt = time.Now()
+	stored.Version++
+
+	if changes := userChanges(&before, &stored); len(changes) > 0 {
+		if err := r.appendUserEvent(ctx, models.EventUserUpdated, &stored, changes); err != nil {
+			return err
+		}
+	}
+
+	r.users[user.ID] = stored
+	*user = stored
+
+	return nil
+}
+
+// PatchUser updates only the fields set in patch. When patch.Version is set
+// the update also requires the stored version to match.
+func (r *memoryRepository) PatchUser(ctx context.Context, userId string, patch models.UserPatch) (*models.User, error) {
+	id, err := uuid.Parse(userId)
+	if err != nil {
+		return nil, utils.ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[id]
+	if !ok || stored.DeletedAt != nil {
+		return nil, utils.ErrNotFound
+	}
+
+	if patch.Version != 0 && stored.Version != patch.Version {
+		return nil, utils.ErrVersionConflict
+	}
+
+	if patch.IsEmpty() {
+		return &stored, nil
+	}
+
+	updated := stored
+	if patch.Firstname != nil {
+		updated.Firstname = *patch.Firstname
+	}
+	if patch.Lastname != nil {
+		updated.Lastname = *patch.Lastname
+	}
+	if patch.Username != nil {
+		updated.Username = *patch.Username
+	}
+	if patch.Email != nil {
+		updated.Email = *patch.Email
+	}
+	if patch.Metadata != nil {
+		updated.Metadata = *patch.Metadata
+	}
+
+	if (patch.Username != nil || patch.Email != nil) && r.conflicts(id, updated.Username, updated.Email) {
+		return nil, utils.ErrDuplicateEntry
+	}
+
+	updated.UpdatedAt = time.Now()
+	updated.Version++
+
+	if changes := userChanges(&stored, &updated); len(changes) > 0 {
+		if err := r.appendUserEvent(ctx, models.EventUserUpdated, &updated, changes); err != nil {
+			return nil, err
+		}
+	}
+
+	r.users[id] = updated
+
+	return &updated, nil
+}
+
+func (r *memoryRepository) UpdatePassword(ctx context.Context, userId string, password string) (*models.User, error) {
+	log := r.log.With().Str("method", "UpdatePassword").Ctx(ctx).Logger()
+
+	hashedPassword, err := utils.HashPassword(ctx, password)
+	if err != nil {
+		log.Err(err).Msg(utils.ErrPasswordHash.Error())
+		return nil, utils.ErrPasswordHash
+	}
+
+	id, err := uuid.Parse(userId)
+	if err != nil {
+		return nil, utils.ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[id]
+	if !ok || stored.DeletedAt != nil {
+		return nil, utils.ErrNotFound
+	}
+
+	stored.Password = hashedPassword
+	stored.UpdatedAt = time.Now()
+	stored.Version++
+
+	if err := r.appendUserEvent(ctx, models.EventUserPasswordChanged, &stored, nil); err != nil {
+		return nil, err
+	}
+
+	r.users[id] = stored
+	r.revokeUserSessions(id)
+
+	return &stored, nil
+}
+
+func (r *memoryRepository) GetUserByIDorEmail(ctx context.Context, idOrEmail string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if id, err := uuid.Parse(idOrEmail); err == nil {
+		user, ok := r.users[id]
+		if !ok || user.DeletedAt != nil {
+			return nil, utils.ErrNotFound
+		}
+		return &user, nil
+	}
+
+	for _, user := range r.users {
+		if user.Email == idOrEmail && user.DeletedAt == nil {
+			return &user, nil
+		}
+	}
+
+	return nil, utils.ErrNotFound
+}
+
+func (r *memoryRepository) CheckUserNameExist(ctx context.Context, username string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Username == username {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// DeleteUser soft deletes the user, like setting deleted_at in postgres.
+func (r *memoryRepository) DeleteUser(ctx context.Context, userId string) error {
+	id, err := uuid.Parse(userId)
+	if err != nil {
+		return utils.ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[id]
+	if !ok || stored.DeletedAt != nil {
+		return utils.ErrNotFound
+	}
+
+	now := time.Now()
+	stored.DeletedAt = &now
+	stored.UpdatedAt = now
+	stored.Version++
+
+	if err := r.appendUserEvent(ctx, models.EventUserDeleted, &stored, nil); err != nil {
+		return err
+	}
+
+	r.users[id] = stored
+
+	return nil
+}
+
+// SearchUsers filters and pages users like the postgres implementation. Prefix
+// matches are complemented by substring matches instead of trigrams.
+func (r *memoryRepository) SearchUsers(ctx context.Context, params models.UserSearchParams) (*models.UserPage, error) {
+	params, cursor, err := prepareSearch(params)
+	if err != nil {
+		return nil, err
+	}
+
+	asc := params.Sort == models.SortCreatedAtAsc
+	before := func(a, b models.User) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt) == asc
+		}
+		if a.ID == b.ID {
+			return false
+		}
+		return (a.ID.String() < b.ID.String()) == asc
+	}
+
+	r.mu.RLock()
+	users := []models.User{}
+	for _, user := range r.users {
+		if !matchesStatus(user, params.Status) || !matchesQuery(user, params.Query) {
+			continue
+		}
+		if cursor != nil && !before(userCursorBound(cursor), user) {
+			continue
+		}
+		users = append(users, user)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		return before(users[i], users[j])
+	})
+
+	if len(users) > params.Limit+1 {
+		users = users[:params.Limit+1]
+	}
+
+	return newUserPage(users, params.Limit), nil
+}
+
+func userCursorBound(cursor *userCursor) models.User {
+	return models.User{ID: cursor.ID, CreatedAt: cursor.CreatedAt}
+}
+
+func matchesStatus(user models.User, status string) bool {
+	switch status {
+	case models.UserStatusActive:
+		return user.DeletedAt == nil && user.LockedAt == nil
+	case models.UserStatusLocked:
+		return user.DeletedAt == nil && user.LockedAt != nil
+	case models.UserStatusDeleted:
+		return user.DeletedAt != nil
+	default:
+		return true
+	}
+}
+
+func matchesQuery(user models.User, query string) bool {
+	if query == "" {
+		return true
+	}
+
+	query = strings.ToLower(query)
+	fields := []string{
+		user.Username, user.Email, user.Firstname, user.Lastname,
+		user.Firstname + " " + user.Lastname,
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *memoryRepository) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]models.Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	lockedUntil := now.Add(lease)
+
+	events := []models.Event{}
+	for i := range r.events {
+		event := &r.events[i]
+		if len(events) == limit {
+			break
+		}
+		if event.DispatchedAt != nil || (event.LockedUntil != nil && !event.LockedUntil.Before(now)) {
+			continue
+		}
+
+		event.LockedUntil = &lockedUntil
+		events = append(events, *event)
+	}
+
+	return events, nil
+}
+
+func (r *memoryRepository) MarkEventDispatched(ctx context.Context, eventID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.events {
+		if r.events[i].ID == eventID {
+			now := time.Now()
+			r.events[i].DispatchedAt = &now
+			r.events[i].LockedUntil = nil
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) MarkEventFailed(ctx context.Context, eventID uuid.UUID, reason string, retryAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.events {
+		if r.events[i].ID == eventID {
+			r.events[i].Attempts++
+			r.events[i].LastError = &reason
+			r.events[i].LockedUntil = &retryAt
+		}
+	}
+
+	return nil
+}
+
+// appendUserEvent records the event of a change. Callers must hold the lock
+// and apply the change only if it succeeds.
+func (r *memoryRepository) appendUserEvent(ctx context.Context, eventType string, user *models.User, changes []string) error {
+	event, err := newUserEvent(ctx, eventType, user, changes)
+	if err != nil {
+		return err
+	}
+
+	r.events = append(r.events, *event)
+
+	return nil
+}
+
+// conflicts reports whether another user already holds username or email.
+// Callers must hold the lock.
+func (r *memoryRepository) conflicts(id uuid.UUID, username, email string) bool {
+	for _, other := range r.users {
+		if other.ID == id {
+			continue
+		}
+		if other.Username == username || other.Email == email {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/utils"
+)
+
+func (r *memoryRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.sessions[session.ID]; exists {
+		return utils.ErrDuplicateEntry
+	}
+	if user, ok := r.users[session.UserID]; !ok || user.DeletedAt != nil {
+		return utils.ErrForeignKeyViolation
+	}
+
+	now := time.Now()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	r.sessions[session.ID] = *session
+
+	return nil
+}
+
+// GetSessionByTokenHash returns the session matching tokenHash as long as its
+// user still exists. Expiry and revocation are checked by the caller.
+func (r *memoryRepository) GetSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, session := range r.sessions {
+		if session.TokenHash != tokenHash {
+			continue
+		}
+		if user, ok := r.users[session.UserID]; !ok || user.DeletedAt != nil {
+			break
+		}
+		return &session, nil
+	}
+
+	return nil, utils.ErrInvalidSession
+}
+
+// TouchSession records activity on the session and extends its idle expiry.
+func (r *memoryRepository) TouchSession(ctx context.Context, sessionID uuid.UUID, idleExpiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[sessionID]; ok {
+		session.LastSeenAt = time.Now()
+		session.IdleExpiresAt = idleExpiresAt
+		r.sessions[sessionID] = session
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[sessionID]
+	if !ok || session.RevokedAt != nil {
+		return utils.ErrInvalidSession
+	}
+
+	now := time.Now()
+	session.RevokedAt = &now
+	r.sessions[sessionID] = session
+
+	return nil
+}
+
+func (r *memoryRepository) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revokeUserSessions(userID)
+
+	return nil
+}
+
+// revokeUserSessions revokes the sessions of the user, r.mu must be held.
+func (r *memoryRepository) revokeUserSessions(userID uuid.UUID) {
+	now := time.Now()
+	for id, session := range r.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			r.sessions[id] = session
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/rovilay/auth-service/repository"
+	"github.com/rovilay/auth-service/repository/repositorytest"
+	"github.com/rs/zerolog"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	logger := zerolog.Nop()
+
+	repositorytest.RunUserRepositoryTests(t, repositorytest.Harness{
+		New: func(t *testing.T) repository.UserRepository {
+			return repository.NewMemoryRepository(&logger)
+		},
+	})
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/utils"
+)
+
+func (r *memoryRepository) CreateAccessToken(ctx context.Context, token *models.AccessToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tokens[token.ID]; exists {
+		return utils.ErrDuplicateEntry
+	}
+	if token.UserID != nil {
+		if user, ok := r.users[*token.UserID]; !ok || user.DeletedAt != nil {
+			return utils.ErrForeignKeyViolation
+		}
+	}
+
+	token.CreatedAt = time.Now()
+	r.tokens[token.ID] = *token
+
+	return nil
+}
+
+func (r *memoryRepository) ListAccessTokens(ctx context.Context, owner models.Principal) ([]models.AccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tokens := []models.AccessToken{}
+	for _, token := range r.tokens {
+		if token.Owner() == owner && token.RevokedAt == nil {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+
+	return tokens, nil
+}
+
+// GetAccessTokenByHash returns the token matching tokenHash as long as its
+// owner still exists. Service accounts aren't kept in memory, so only tokens
+// of users are found. Expiry and revocation are checked by the caller.
+func (r *memoryRepository) GetAccessTokenByHash(ctx context.Context, tokenHash string) (*models.AccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, token := range r.tokens {
+		if token.TokenHash != tokenHash || token.UserID == nil {
+			continue
+		}
+		if user, ok := r.users[*token.UserID]; !ok || user.DeletedAt != nil {
+			break
+		}
+		return &token, nil
+	}
+
+	return nil, utils.ErrInvalidAccessToken
+}
+
+func (r *memoryRepository) TouchAccessToken(ctx context.Context, tokenID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if token, ok := r.tokens[tokenID]; ok {
+		now := time.Now()
+		token.LastUsedAt = &now
+		r.tokens[tokenID] = token
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) RevokeAccessToken(ctx context.Context, owner models.Principal, tokenID string) error {
+	id, err := uuid.Parse(tokenID)
+	if err != nil {
+		return utils.ErrAccessTokenNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok || token.Owner() != owner || token.RevokedAt != nil {
+		return utils.ErrAccessTokenNotFound
+	}
+
+	now := time.Now()
+	token.RevokedAt = &now
+	r.tokens[id] = token
+
+	return nil
+}
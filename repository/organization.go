@@ -0,0 +1,332 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/tracing"
+	"github.com/rovilay/auth-service/utils"
+)
+
+func (r *postgresRepository) CreateOrganization(ctx context.Context, org *models.Organization, ownerID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.CreateOrganization")
+	defer span.End()
+
+	log := r.log.With().Str("method", "CreateOrganization").Ctx(ctx).Logger()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO organizations (id, name, created_at, updated_at)
+		VALUES ($1, $2, NOW(), NOW())
+		RETURNING id, name, created_at, updated_at
+	`
+	err = tx.
+		QueryRowContext(ctx, query, org.ID, org.Name).
+		Scan(&org.ID, &org.Name, &org.CreatedAt, &org.UpdatedAt)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	query = `
+		INSERT INTO memberships (organization_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+	`
+	if _, err = tx.ExecContext(ctx, query, org.ID, ownerID, models.RoleOwner); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) GetOrganization(ctx context.Context, orgID string) (*models.Organization, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.GetOrganization")
+	defer span.End()
+
+	log := r.log.With().Str("method", "GetOrganization").Ctx(ctx).Logger()
+
+	if _, err := uuid.Parse(orgID); err != nil {
+		return nil, utils.ErrOrganizationNotFound
+	}
+
+	query := `SELECT * FROM organizations WHERE id = $1 AND deleted_at IS NULL`
+
+	var org models.Organization
+	err := r.db.GetContext(ctx, &org, query, orgID)
+	if err != nil {
+		return nil, notFoundAs(r.mapDatabaseError(err, &log), utils.ErrOrganizationNotFound)
+	}
+
+	return &org, nil
+}
+
+func (r *postgresRepository) GetMembership(ctx context.Context, orgID string, userID string) (*models.Membership, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.GetMembership")
+	defer span.End()
+
+	log := r.log.With().Str("method", "GetMembership").Ctx(ctx).Logger()
+
+	if _, err := uuid.Parse(orgID); err != nil {
+		return nil, utils.ErrOrganizationNotFound
+	}
+
+	query := `
+		SELECT m.* FROM memberships m
+		JOIN organizations o ON o.id = m.organization_id
+		WHERE m.organization_id = $1 AND m.user_id = $2 AND o.deleted_at IS NULL
+	`
+
+	var membership models.Membership
+	err := r.db.GetContext(ctx, &membership, query, orgID, userID)
+	if err != nil {
+		return nil, notFoundAs(r.mapDatabaseError(err, &log), utils.ErrForbidden)
+	}
+
+	return &membership, nil
+}
+
+// ListMemberships returns the memberships of the user in organizations that
+// aren't deleted.
+func (r *postgresRepository) ListMemberships(ctx context.Context, userID string) ([]models.Membership, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.ListMemberships")
+	defer span.End()
+
+	log := r.log.With().Str("method", "ListMemberships").Ctx(ctx).Logger()
+
+	query := `
+		SELECT m.* FROM memberships m
+		JOIN organizations o ON o.id = m.organization_id
+		WHERE m.user_id = $1 AND o.deleted_at IS NULL
+		ORDER BY m.created_at
+	`
+
+	memberships := []models.Membership{}
+	if err := r.db.SelectContext(ctx, &memberships, query, userID); err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return memberships, nil
+}
+
+// CreateInvitation inserts a pending invitation. An expired invitation still
+// pending for the same email is revoked in the same transaction, so that the
+// email can be invited again.
+func (r *postgresRepository) CreateInvitation(ctx context.Context, invitation *models.Invitation) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.CreateInvitation")
+	defer span.End()
+
+	log := r.log.With().Str("method", "CreateInvitation").Ctx(ctx).Logger()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE invitations
+		SET revoked_at = NOW(), updated_at = NOW()
+		WHERE organization_id = $1 AND LOWER(email) = LOWER($2)
+			AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= NOW()
+	`
+	if _, err = tx.ExecContext(ctx, query, invitation.OrganizationID, invitation.Email); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	query = `
+		INSERT INTO invitations (id, organization_id, email, role, invited_by, token_hash, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		RETURNING created_at, updated_at
+	`
+	err = tx.
+		QueryRowContext(
+			ctx, query, invitation.ID, invitation.OrganizationID, invitation.Email,
+			invitation.Role, invitation.InvitedBy, invitation.TokenHash, invitation.ExpiresAt,
+		).
+		Scan(&invitation.CreatedAt, &invitation.UpdatedAt)
+	if err != nil {
+		err = r.mapDatabaseError(err, &log)
+		if errors.Is(err, utils.ErrDuplicateEntry) {
+			return utils.ErrDuplicateInvitation
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) GetInvitation(ctx context.Context, orgID string, invitationID string) (*models.Invitation, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.GetInvitation")
+	defer span.End()
+
+	log := r.log.With().Str("method", "GetInvitation").Ctx(ctx).Logger()
+
+	if _, err := uuid.Parse(invitationID); err != nil {
+		return nil, utils.ErrInvitationNotFound
+	}
+
+	query := `SELECT * FROM invitations WHERE id = $1 AND organization_id = $2`
+
+	var invitation models.Invitation
+	err := r.db.GetContext(ctx, &invitation, query, invitationID, orgID)
+	if err != nil {
+		return nil, notFoundAs(r.mapDatabaseError(err, &log), utils.ErrInvitationNotFound)
+	}
+
+	return &invitation, nil
+}
+
+func (r *postgresRepository) GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*models.Invitation, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.GetInvitationByTokenHash")
+	defer span.End()
+
+	log := r.log.With().Str("method", "GetInvitationByTokenHash").Ctx(ctx).Logger()
+
+	query := `SELECT * FROM invitations WHERE token_hash = $1`
+
+	var invitation models.Invitation
+	err := r.db.GetContext(ctx, &invitation, query, tokenHash)
+	if err != nil {
+		return nil, notFoundAs(r.mapDatabaseError(err, &log), utils.ErrInvalidInvitation)
+	}
+
+	return &invitation, nil
+}
+
+func (r *postgresRepository) ListPendingInvitations(ctx context.Context, orgID string) ([]models.Invitation, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.ListPendingInvitations")
+	defer span.End()
+
+	log := r.log.With().Str("method", "ListPendingInvitations").Ctx(ctx).Logger()
+
+	query := `
+		SELECT * FROM invitations
+		WHERE organization_id = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC
+	`
+
+	invitations := []models.Invitation{}
+	err := r.db.SelectContext(ctx, &invitations, query, orgID)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return invitations, nil
+}
+
+func (r *postgresRepository) RenewInvitation(ctx context.Context, invitationID string, tokenHash string, expiresAt time.Time) (*models.Invitation, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.RenewInvitation")
+	defer span.End()
+
+	log := r.log.With().Str("method", "RenewInvitation").Ctx(ctx).Logger()
+
+	query := `
+		UPDATE invitations
+		SET token_hash = $1, expires_at = $2, updated_at = NOW()
+		WHERE id = $3 AND accepted_at IS NULL AND revoked_at IS NULL
+		RETURNING *
+	`
+
+	var invitation models.Invitation
+	err := r.db.GetContext(ctx, &invitation, query, tokenHash, expiresAt, invitationID)
+	if err != nil {
+		return nil, notFoundAs(r.mapDatabaseError(err, &log), utils.ErrInvitationNotFound)
+	}
+
+	return &invitation, nil
+}
+
+func (r *postgresRepository) RevokeInvitation(ctx context.Context, orgID string, invitationID string) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.RevokeInvitation")
+	defer span.End()
+
+	log := r.log.With().Str("method", "RevokeInvitation").Ctx(ctx).Logger()
+
+	query := `
+		UPDATE invitations
+		SET revoked_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND organization_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL
+	`
+
+	res, err := r.db.ExecContext(ctx, query, invitationID, orgID)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	} else if n == 0 {
+		return utils.ErrInvitationNotFound
+	}
+
+	return nil
+}
+
+// AcceptInvitation marks the invitation as accepted and adds the user to the
+// organization in a single transaction. Only pending, unexpired invitations
+// can be accepted.
+func (r *postgresRepository) AcceptInvitation(ctx context.Context, invitationID string, userID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.AcceptInvitation")
+	defer span.End()
+
+	log := r.log.With().Str("method", "AcceptInvitation").Ctx(ctx).Logger()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE invitations
+		SET accepted_at = NOW(), accepted_by = $1, updated_at = NOW()
+		WHERE id = $2 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+		RETURNING organization_id, role
+	`
+
+	var orgID uuid.UUID
+	var role string
+	err = tx.QueryRowContext(ctx, query, userID, invitationID).Scan(&orgID, &role)
+	if err != nil {
+		return notFoundAs(r.mapDatabaseError(err, &log), utils.ErrInvalidInvitation)
+	}
+
+	query = `
+		INSERT INTO memberships (organization_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (organization_id, user_id) DO NOTHING
+	`
+	if _, err = tx.ExecContext(ctx, query, orgID, userID, role); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+// notFoundAs replaces the generic utils.ErrNotFound returned by
+// mapDatabaseError with a resource specific error.
+func notFoundAs(err error, target error) error {
+	if errors.Is(err, utils.ErrNotFound) {
+		return target
+	}
+	return err
+}
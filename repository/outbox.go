@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/tracing"
+)
+
+// ClaimEvents leases up to limit pending events, oldest first. Other
+// dispatchers skip leased events until the lease runs out, so an event whose
+// dispatcher died is picked up again.
+func (r *postgresRepository) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]models.Event, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.ClaimEvents")
+	defer span.End()
+
+	log := r.log.With().Str("method", "ClaimEvents").Ctx(ctx).Logger()
+
+	query := `
+		UPDATE outbox_events
+		SET locked_until = NOW() + $1 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE dispatched_at IS NULL AND (locked_until IS NULL OR locked_until < NOW())
+			ORDER BY created_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`
+
+	events := []models.Event{}
+	err := r.db.SelectContext(ctx, &events, query, lease.Milliseconds(), limit)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	sortEvents(events)
+
+	return events, nil
+}
+
+func (r *postgresRepository) MarkEventDispatched(ctx context.Context, eventID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.MarkEventDispatched")
+	defer span.End()
+
+	log := r.log.With().Str("method", "MarkEventDispatched").Ctx(ctx).Logger()
+
+	query := `UPDATE outbox_events SET dispatched_at = NOW(), locked_until = NULL WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, eventID); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+// MarkEventFailed records a failed delivery. The event is retried once
+// retryAt has passed.
+func (r *postgresRepository) MarkEventFailed(ctx context.Context, eventID uuid.UUID, reason string, retryAt time.Time) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.MarkEventFailed")
+	defer span.End()
+
+	log := r.log.With().Str("method", "MarkEventFailed").Ctx(ctx).Logger()
+
+	query := `UPDATE outbox_events SET attempts = attempts + 1, last_error = $1, locked_until = $2 WHERE id = $3`
+
+	if _, err := r.db.ExecContext(ctx, query, reason, retryAt, eventID); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+// insertUserEvent writes the event to the outbox in the transaction of the
+// change it describes.
+func (r *postgresRepository) insertUserEvent(ctx context.Context, tx *sqlx.Tx, eventType string, user *models.User, changes []string) error {
+	event, err := newUserEvent(ctx, eventType, user, changes)
+	if err != nil {
+		return err
+	}
+
+	return r.insertEvent(ctx, tx, event)
+}
+
+// insertServiceAccountEvent writes the event to the outbox in the
+// transaction of the change it describes.
+func (r *postgresRepository) insertServiceAccountEvent(ctx context.Context, tx *sqlx.Tx, eventType string, account *models.ServiceAccount) error {
+	event, err := newServiceAccountEvent(ctx, eventType, account)
+	if err != nil {
+		return err
+	}
+
+	return r.insertEvent(ctx, tx, event)
+}
+
+func (r *postgresRepository) insertEvent(ctx context.Context, tx *sqlx.Tx, event *models.Event) error {
+	query := `
+		INSERT INTO outbox_events (id, type, aggregate_id, payload, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := tx.ExecContext(ctx, query, event.ID, event.Type, event.AggregateID, event.Payload, event.CreatedAt)
+	return err
+}
+
+// lockUser reads the user for update so that the change can be compared
+// with the stored row.
+func (r *postgresRepository) lockUser(ctx context.Context, tx *sqlx.Tx, userId string) (*models.User, error) {
+	var user models.User
+	err := tx.GetContext(ctx, &user, `SELECT * FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func newUserEvent(ctx context.Context, eventType string, user *models.User, changes []string) (*models.Event, error) {
+	payload := models.UserEventPayload{
+		User: models.UserResponse{
+			ID:        user.ID,
+			Firstname: user.Firstname,
+			Lastname:  user.Lastname,
+			Username:  user.Username,
+			Email:     user.Email,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+			Metadata:  user.Metadata,
+		},
+		Changes: changes,
+	}
+	if actor, ok := models.PrincipalFromContext(ctx); ok {
+		payload.Actor = actor
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Event{
+		ID:          uuid.New(),
+		Type:        eventType,
+		AggregateID: user.ID,
+		Payload:     raw,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+func newServiceAccountEvent(ctx context.Context, eventType string, account *models.ServiceAccount) (*models.Event, error) {
+	payload := models.ServiceAccountEventPayload{ServiceAccount: *account}
+	if actor, ok := models.PrincipalFromContext(ctx); ok {
+		payload.Actor = actor
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Event{
+		ID:          uuid.New(),
+		Type:        eventType,
+		AggregateID: account.ID,
+		Payload:     raw,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// userChanges lists the profile fields that differ between two versions of
+// a user.
+func userChanges(before, after *models.User) []string {
+	var changes []string
+
+	if before.Firstname != after.Firstname {
+		changes = append(changes, "firstname")
+	}
+	if before.Lastname != after.Lastname {
+		changes = append(changes, "lastname")
+	}
+	if before.Username != after.Username {
+		changes = append(changes, "username")
+	}
+	if before.Email != after.Email {
+		changes = append(changes, "email")
+	}
+	// compare the encoded metadata, a missing namespace equals an empty one
+	beforeMetadata, _ := json.Marshal(before.Metadata)
+	afterMetadata, _ := json.Marshal(after.Metadata)
+	if !bytes.Equal(beforeMetadata, afterMetadata) {
+		changes = append(changes, "metadata")
+	}
+
+	return changes
+}
+
+// sortEvents orders events by creation time, UPDATE ... RETURNING doesn't
+// keep the order of the subquery.
+func sortEvents(events []models.Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+}
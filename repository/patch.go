@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/tracing"
+	"github.com/rovilay/auth-service/utils"
+)
+
+// PatchUser updates only the fields set in patch. When patch.Version is set
+// the update also requires the stored version to match.
+func (r *postgresRepository) PatchUser(ctx context.Context, userId string, patch models.UserPatch) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.PatchUser")
+	defer span.End()
+
+	log := r.log.With().Str("method", "PatchUser").Ctx(ctx).Logger()
+
+	if _, err := uuid.Parse(userId); err != nil {
+		return nil, utils.ErrNotFound
+	}
+
+	if patch.IsEmpty() {
+		return unchangedUser(ctx, r, userId, patch)
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	before, err := r.lockUser(ctx, tx, userId)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	columns, values := patchAssignments(patch)
+	set := make([]string, 0, len(columns)+2)
+	for i, column := range columns {
+		set = append(set, fmt.Sprintf("%s = %s", column, arg(values[i])))
+	}
+	set = append(set, "updated_at = NOW()", "version = version + 1")
+
+	query := fmt.Sprintf("UPDATE users SET %s WHERE id = %s AND deleted_at IS NULL", strings.Join(set, ", "), arg(userId))
+	if patch.Version != 0 {
+		query += " AND version = " + arg(patch.Version)
+	}
+	query += " RETURNING id, firstname, lastname, username, email, password, created_at, updated_at, version, metadata"
+
+	var user models.User
+	err = tx.
+		QueryRowContext(ctx, query, args...).
+		Scan(
+			&user.ID, &user.Firstname, &user.Lastname,
+			&user.Username, &user.Email, &user.Password,
+			&user.CreatedAt, &user.UpdatedAt, &user.Version, &user.Metadata,
+		)
+	if errors.Is(err, sql.ErrNoRows) && patch.Version != 0 {
+		return nil, r.versionConflictOrNotFound(ctx, tx, userId, &log)
+	}
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	if changes := userChanges(before, &user); len(changes) > 0 {
+		if err = r.insertUserEvent(ctx, tx, models.EventUserUpdated, &user, changes); err != nil {
+			return nil, r.mapDatabaseError(err, &log)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return &user, nil
+}
+
+// patchAssignments returns the columns set in patch with their new values.
+func patchAssignments(patch models.UserPatch) ([]string, []any) {
+	var columns []string
+	var values []any
+
+	if patch.Metadata != nil {
+		columns = append(columns, "metadata")
+		values = append(values, *patch.Metadata)
+	}
+
+	fields := []struct {
+		column string
+		value  *string
+	}{
+		{"firstname", patch.Firstname},
+		{"lastname", patch.Lastname},
+		{"username", patch.Username},
+		{"email", patch.Email},
+	}
+	for _, field := range fields {
+		if field.value != nil {
+			columns = append(columns, field.column)
+			values = append(values, *field.value)
+		}
+	}
+
+	return columns, values
+}
+
+// unchangedUser answers an empty patch, which still has to honour the
+// version precondition.
+func unchangedUser(ctx context.Context, repo UserRepository, userId string, patch models.UserPatch) (*models.User, error) {
+	user, err := repo.GetUserByIDorEmail(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.Version != 0 && user.Version != patch.Version {
+		return nil, utils.ErrVersionConflict
+	}
+
+	return user, nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jmoiron/sqlx"
 	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/tracing"
 	"github.com/rovilay/auth-service/utils"
 	"github.com/rs/zerolog"
 )
@@ -22,11 +23,6 @@ type postgresRepository struct {
 func NewPostgresRepository(ctx context.Context, db *sqlx.DB, log *zerolog.Logger) *postgresRepository {
 	logger := log.With().Str("repository", "postgresRepository").Logger()
 
-	// ping db
-	if err := db.PingContext(ctx); err != nil {
-		logger.Fatal().Err(err).Msg("[ERROR] failed to connect to postgres")
-	}
-
 	return &postgresRepository{
 		log: &logger,
 		db:  db,
@@ -34,61 +30,96 @@ func NewPostgresRepository(ctx context.Context, db *sqlx.DB, log *zerolog.Logger
 }
 
 func (r *postgresRepository) CreateUser(ctx context.Context, user *models.User) error {
-	log := r.log.With().Str("method", "CreateUser").Logger()
+	ctx, span := tracing.Start(ctx, "postgresRepository.CreateUser")
+	defer span.End()
+
+	log := r.log.With().Str("method", "CreateUser").Ctx(ctx).Logger()
 
-	hashedPassword, err := utils.HashPassword(user.Password)
+	hashedPassword, err := utils.HashPassword(ctx, user.Password)
 	if err != nil {
 		log.Err(err).Msg(utils.ErrPasswordHash.Error())
 		return utils.ErrPasswordHash
 	}
 
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
 	query := `
 		INSERT INTO users (id, firstname, lastname, username, email, password, created_at, updated_at) 
 		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
-		RETURNING id, firstname, lastname, username, email, password, created_at, updated_at
+		RETURNING id, firstname, lastname, username, email, password, created_at, updated_at, version, metadata
 	`
 
-	err = r.db.QueryRowContext(
+	err = tx.QueryRowContext(
 		ctx, query, user.ID, user.Firstname, user.Lastname,
 		user.Username, user.Email, hashedPassword,
 	).Scan(
 		&user.ID, &user.Firstname, &user.Lastname,
 		&user.Username, &user.Email, &user.Password,
-		&user.CreatedAt, &user.UpdatedAt,
+		&user.CreatedAt, &user.UpdatedAt, &user.Version, &user.Metadata,
 	)
 	if err != nil {
 		return r.mapDatabaseError(err, &log)
 	}
 
+	if err = r.insertUserEvent(ctx, tx, models.EventUserCreated, user, nil); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
 	return nil
 }
 
 func (r *postgresRepository) UpdateUser(ctx context.Context, user *models.User) error {
-	log := r.log.With().Str("method", "UpdateUser").Logger()
+	ctx, span := tracing.Start(ctx, "postgresRepository.UpdateUser")
+	defer span.End()
+
+	log := r.log.With().Str("method", "UpdateUser").Ctx(ctx).Logger()
 
-	tx, err := r.db.Begin()
+	tx, err := r.db.Beginx()
 	if err != nil {
 		return r.mapDatabaseError(err, &log)
 	}
 	defer tx.Rollback()
 
+	before, err := r.lockUser(ctx, tx, user.ID.String())
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
 	query := `
 		UPDATE users
-		SET firstname = $1, lastname = $2, username = $3, email = $4, updated_at = NOW()
-		WHERE id = $5 AND deleted_at IS NULL
-		RETURNING id, firstname, lastname, username, email, password, created_at, updated_at
+		SET firstname = $1, lastname = $2, username = $3, email = $4, updated_at = NOW(), version = version + 1
+		WHERE id = $5 AND deleted_at IS NULL AND version = $6
+		RETURNING id, firstname, lastname, username, email, password, created_at, updated_at, version, metadata
 	`
 	err = tx.
-		QueryRowContext(ctx, query, user.Firstname, user.Lastname, user.Username, user.Email, user.ID.String()).
+		QueryRowContext(ctx, query, user.Firstname, user.Lastname, user.Username, user.Email, user.ID.String(), user.Version).
 		Scan(
 			&user.ID, &user.Firstname, &user.Lastname,
 			&user.Username, &user.Email, &user.Password,
-			&user.CreatedAt, &user.UpdatedAt,
+			&user.CreatedAt, &user.UpdatedAt, &user.Version, &user.Metadata,
 		)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r.versionConflictOrNotFound(ctx, tx, user.ID.String(), &log)
+	}
 	if err != nil {
 		return r.mapDatabaseError(err, &log)
 	}
 
+	if changes := userChanges(before, user); len(changes) > 0 {
+		if err = r.insertUserEvent(ctx, tx, models.EventUserUpdated, user, changes); err != nil {
+			return r.mapDatabaseError(err, &log)
+		}
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return r.mapDatabaseError(err, &log)
@@ -98,16 +129,19 @@ func (r *postgresRepository) UpdateUser(ctx context.Context, user *models.User)
 }
 
 func (r *postgresRepository) UpdatePassword(ctx context.Context, userId string, password string) (*models.User, error) {
-	log := r.log.With().Str("method", "UpdatePassword").Logger()
+	ctx, span := tracing.Start(ctx, "postgresRepository.UpdatePassword")
+	defer span.End()
+
+	log := r.log.With().Str("method", "UpdatePassword").Ctx(ctx).Logger()
 
-	hashedPassword, err := utils.HashPassword(password)
+	hashedPassword, err := utils.HashPassword(ctx, password)
 	if err != nil {
 		log.Err(err).Msg(utils.ErrPasswordHash.Error())
 		return nil, utils.ErrPasswordHash
 	}
 
 	var user models.User
-	tx, err := r.db.Begin()
+	tx, err := r.db.Beginx()
 	if err != nil {
 		return nil, r.mapDatabaseError(err, &log)
 	}
@@ -115,21 +149,30 @@ func (r *postgresRepository) UpdatePassword(ctx context.Context, userId string,
 
 	query := `
 		UPDATE users
-		SET password = $1, updated_at = NOW()
+		SET password = $1, updated_at = NOW(), version = version + 1
 		WHERE id = $2 AND deleted_at IS NULL
-		RETURNING id, firstname, lastname, username, email, password, created_at, updated_at
+		RETURNING id, firstname, lastname, username, email, password, created_at, updated_at, version, metadata
 	`
 	err = tx.
 		QueryRowContext(ctx, query, hashedPassword, userId).
 		Scan(
 			&user.ID, &user.Firstname, &user.Lastname,
 			&user.Username, &user.Email, &user.Password,
-			&user.CreatedAt, &user.UpdatedAt,
+			&user.CreatedAt, &user.UpdatedAt, &user.Version, &user.Metadata,
 		)
 	if err != nil {
 		return nil, r.mapDatabaseError(err, &log)
 	}
 
+	if err = r.insertUserEvent(ctx, tx, models.EventUserPasswordChanged, &user, nil); err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	// sessions started with the old password must not outlive it
+	if err = r.revokeUserSessions(ctx, tx, user.ID); err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return nil, r.mapDatabaseError(err, &log)
@@ -139,7 +182,10 @@ func (r *postgresRepository) UpdatePassword(ctx context.Context, userId string,
 }
 
 func (r *postgresRepository) GetUserByIDorEmail(ctx context.Context, idOrEmail string) (*models.User, error) {
-	log := r.log.With().Str("method", "GetUserByIDorEmail").Logger()
+	ctx, span := tracing.Start(ctx, "postgresRepository.GetUserByIDorEmail")
+	defer span.End()
+
+	log := r.log.With().Str("method", "GetUserByIDorEmail").Ctx(ctx).Logger()
 
 	query := `SELECT * FROM users WHERE email = $1 AND deleted_at IS NULL`
 	// Check if the provided string looks like a UUID
@@ -158,7 +204,10 @@ func (r *postgresRepository) GetUserByIDorEmail(ctx context.Context, idOrEmail s
 }
 
 func (r *postgresRepository) CheckUserNameExist(ctx context.Context, username string) (bool, error) {
-	log := r.log.With().Str("method", "CheckUserNameExist").Logger()
+	ctx, span := tracing.Start(ctx, "postgresRepository.CheckUserNameExist")
+	defer span.End()
+
+	log := r.log.With().Str("method", "CheckUserNameExist").Ctx(ctx).Logger()
 
 	query := "SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)"
 
@@ -171,6 +220,71 @@ func (r *postgresRepository) CheckUserNameExist(ctx context.Context, username st
 	return exists, nil
 }
 
+// DeleteUser soft deletes the user by setting deleted_at.
+func (r *postgresRepository) DeleteUser(ctx context.Context, userId string) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.DeleteUser")
+	defer span.End()
+
+	log := r.log.With().Str("method", "DeleteUser").Ctx(ctx).Logger()
+
+	if _, err := uuid.Parse(userId); err != nil {
+		return utils.ErrNotFound
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users
+		SET deleted_at = NOW(), updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING *
+	`
+
+	var user models.User
+	err = tx.GetContext(ctx, &user, query, userId)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if err = r.insertUserEvent(ctx, tx, models.EventUserDeleted, &user, nil); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+// versionConflictOrNotFound tells apart the two reasons a versioned update
+// matches no rows.
+func (r *postgresRepository) versionConflictOrNotFound(ctx context.Context, tx *sqlx.Tx, userId string, log *zerolog.Logger) error {
+	query := "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL)"
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, query, userId).Scan(&exists); err != nil {
+		return r.mapDatabaseError(err, log)
+	}
+
+	if exists {
+		return utils.ErrVersionConflict
+	}
+	return utils.ErrNotFound
+}
+
+func (r *postgresRepository) Ping(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.Ping")
+	defer span.End()
+
+	return r.db.PingContext(ctx)
+}
+
 func (r *postgresRepository) mapDatabaseError(err error, log *zerolog.Logger) error {
 	log.Err(err).Msg("database operation failed!")
 
@@ -2,14 +2,95 @@ package repository
 
 import (
 	"context"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/rovilay/auth-service/models"
 )
 
 type UserRepository interface {
 	CreateUser(ctx context.Context, user *models.User) error
 	UpdateUser(ctx context.Context, user *models.User) error
+	PatchUser(ctx context.Context, userId string, patch models.UserPatch) (*models.User, error)
 	UpdatePassword(ctx context.Context, userId string, password string) (*models.User, error)
 	GetUserByIDorEmail(ctx context.Context, idOrEmail string) (*models.User, error)
 	CheckUserNameExist(ctx context.Context, username string) (bool, error)
+	SearchUsers(ctx context.Context, params models.UserSearchParams) (*models.UserPage, error)
+	DeleteUser(ctx context.Context, userId string) error
+}
+
+// WebhookRepository is implemented by backends that support webhooks. The
+// deliveries double as the delivery log.
+type WebhookRepository interface {
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	GetWebhook(ctx context.Context, webhookID string) (*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookID string) error
+	EnqueueWebhookDeliveries(ctx context.Context, event models.Event) error
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	ListWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error)
+	RedeliverWebhookDelivery(ctx context.Context, webhookID string, deliveryID string) (*models.WebhookDelivery, error)
+}
+
+// SessionRepository is implemented by backends that support cookie sessions.
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error)
+	TouchSession(ctx context.Context, sessionID uuid.UUID, idleExpiresAt time.Time) error
+	RevokeSession(ctx context.Context, sessionID uuid.UUID) error
+	// RevokeUserSessions revokes every session of the user. UpdatePassword
+	// does the same in its transaction.
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID) error
+}
+
+// HealthChecker is implemented by backends that depend on a database
+// connection.
+type HealthChecker interface {
+	Ping(ctx context.Context) error
+}
+
+// OutboxRepository is implemented by backends that record domain events in an
+// outbox in the same transaction as the changes they describe.
+type OutboxRepository interface {
+	ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]models.Event, error)
+	MarkEventDispatched(ctx context.Context, eventID uuid.UUID) error
+	MarkEventFailed(ctx context.Context, eventID uuid.UUID, reason string, retryAt time.Time) error
+}
+
+// OrganizationRepository is implemented by backends that support
+// organizations, memberships and invitations.
+type OrganizationRepository interface {
+	CreateOrganization(ctx context.Context, org *models.Organization, ownerID uuid.UUID) error
+	GetOrganization(ctx context.Context, orgID string) (*models.Organization, error)
+	GetMembership(ctx context.Context, orgID string, userID string) (*models.Membership, error)
+	ListMemberships(ctx context.Context, userID string) ([]models.Membership, error)
+	CreateInvitation(ctx context.Context, invitation *models.Invitation) error
+	GetInvitation(ctx context.Context, orgID string, invitationID string) (*models.Invitation, error)
+	GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*models.Invitation, error)
+	ListPendingInvitations(ctx context.Context, orgID string) ([]models.Invitation, error)
+	RenewInvitation(ctx context.Context, invitationID string, tokenHash string, expiresAt time.Time) (*models.Invitation, error)
+	RevokeInvitation(ctx context.Context, orgID string, invitationID string) error
+	AcceptInvitation(ctx context.Context, invitationID string, userID uuid.UUID) error
+}
+
+// TokenRepository is implemented by backends that support personal access
+// tokens.
+type TokenRepository interface {
+	CreateAccessToken(ctx context.Context, token *models.AccessToken) error
+	ListAccessTokens(ctx context.Context, owner models.Principal) ([]models.AccessToken, error)
+	GetAccessTokenByHash(ctx context.Context, tokenHash string) (*models.AccessToken, error)
+	TouchAccessToken(ctx context.Context, tokenID uuid.UUID) error
+	RevokeAccessToken(ctx context.Context, owner models.Principal, tokenID string) error
+}
+
+// ServiceAccountRepository is implemented by backends that support service
+// accounts.
+type ServiceAccountRepository interface {
+	CreateServiceAccount(ctx context.Context, account *models.ServiceAccount) error
+	GetServiceAccount(ctx context.Context, accountID string) (*models.ServiceAccount, error)
+	ListUserServiceAccounts(ctx context.Context, userID string) ([]models.ServiceAccount, error)
+	ListOrganizationServiceAccounts(ctx context.Context, orgID string) ([]models.ServiceAccount, error)
+	UpdateServiceAccountSecret(ctx context.Context, accountID string, secretHash string) error
+	DeleteServiceAccount(ctx context.Context, accountID string) error
 }
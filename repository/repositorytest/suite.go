@@ -0,0 +1,682 @@
+// Package repositorytest provides a conformance suite that every
+// repository.UserRepository implementation is expected to pass.
+//
+// Call RunUserRepositoryTests from a test in the implementation's package:
+//
+//	func TestMemoryRepository(t *testing.T) {
+//		repositorytest.RunUserRepositoryTests(t, repositorytest.Harness{
+//			New: func(t *testing.T) repository.UserRepository {
+//				return repository.NewMemoryRepository(&logger)
+//			},
+//		})
+//	}
+package repositorytest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/repository"
+	"github.com/rovilay/auth-service/utils"
+)
+
+// Harness describes how the suite creates the repository under test. The
+// suite only goes through repository.UserRepository, e.g. users are soft
+// deleted with DeleteUser, so New is all an implementation has to provide.
+type Harness struct {
+	// New returns an empty repository. It is called once per subtest.
+	New func(t *testing.T) repository.UserRepository
+}
+
+// RunUserRepositoryTests runs the conformance suite against h.
+func RunUserRepositoryTests(t *testing.T, h Harness) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, h Harness)
+	}{
+		{"CreateUser hashes the password", testCreateUserHashesPassword},
+		{"CreateUser rejects duplicate email", testCreateUserDuplicateEmail},
+		{"CreateUser rejects duplicate username", testCreateUserDuplicateUsername},
+		{"GetUserByIDorEmail finds by id and email", testGetUserByIDorEmail},
+		{"GetUserByIDorEmail returns ErrNotFound", testGetUserNotFound},
+		{"UpdateUser updates the profile", testUpdateUser},
+		{"UpdateUser rejects duplicate email", testUpdateUserDuplicateEmail},
+		{"UpdateUser returns ErrNotFound", testUpdateUserNotFound},
+		{"UpdateUser rejects stale versions", testUpdateUserVersionConflict},
+		{"PatchUser updates only the patched fields", testPatchUser},
+		{"PatchUser stores metadata", testPatchUserMetadata},
+		{"PatchUser rejects duplicate username", testPatchUserDuplicateUsername},
+		{"PatchUser returns ErrNotFound", testPatchUserNotFound},
+		{"PatchUser rejects stale versions", testPatchUserVersionConflict},
+		{"UpdatePassword replaces the hash", testUpdatePassword},
+		{"UpdatePassword returns ErrNotFound", testUpdatePasswordNotFound},
+		{"CheckUserNameExist", testCheckUserNameExist},
+		{"deleted users are hidden", testDeletedUsersHidden},
+		{"deleted users keep their email and username", testDeletedUsersKeepUniqueness},
+		{"SearchUsers pages through all users", testSearchUsersPagination},
+		{"SearchUsers matches by prefix", testSearchUsersPrefix},
+		{"SearchUsers filters by status", testSearchUsersStatus},
+		{"SearchUsers rejects invalid cursors", testSearchUsersInvalidCursor},
+		{"DeleteUser returns ErrNotFound", testDeleteUserNotFound},
+		{"changes are recorded in the outbox", testOutboxEvents},
+		{"claimed events are leased", testOutboxLease},
+		{"failed events are retried", testOutboxRetry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, h)
+		})
+	}
+}
+
+const password = "s3cret-password"
+
+// newUser returns a valid user with unique email and username.
+func newUser() *models.User {
+	suffix := strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+
+	return &models.User{
+		ID:        uuid.New(),
+		Firstname: "Ada",
+		Lastname:  "Lovelace",
+		Username:  "ada" + suffix,
+		Email:     fmt.Sprintf("ada.%s@example.com", suffix),
+		Password:  password,
+	}
+}
+
+func mustCreate(t *testing.T, repo repository.UserRepository) *models.User {
+	t.Helper()
+
+	user := newUser()
+	if err := repo.CreateUser(context.Background(), user); err != nil {
+		t.Fatalf("CreateUser: unexpected error: %v", err)
+	}
+
+	return user
+}
+
+func mustDelete(t *testing.T, repo repository.UserRepository, id uuid.UUID) {
+	t.Helper()
+
+	if err := repo.DeleteUser(context.Background(), id.String()); err != nil {
+		t.Fatalf("DeleteUser: unexpected error: %v", err)
+	}
+}
+
+func expectErr(t *testing.T, got, want error) {
+	t.Helper()
+
+	if !errors.Is(got, want) {
+		t.Fatalf("expected error %v, got %v", want, got)
+	}
+}
+
+func testCreateUserHashesPassword(t *testing.T, h Harness) {
+	repo := h.New(t)
+	user := mustCreate(t, repo)
+
+	if user.Password == password {
+		t.Fatal("CreateUser stored the plain text password")
+	}
+	if !utils.CheckPasswordHash(context.Background(), password, user.Password) {
+		t.Fatal("CreateUser stored a hash that doesn't match the password")
+	}
+	if user.CreatedAt.IsZero() || user.UpdatedAt.IsZero() {
+		t.Fatal("CreateUser didn't set created_at and updated_at")
+	}
+}
+
+func testCreateUserDuplicateEmail(t *testing.T, h Harness) {
+	repo := h.New(t)
+	existing := mustCreate(t, repo)
+
+	user := newUser()
+	user.Email = existing.Email
+
+	expectErr(t, repo.CreateUser(context.Background(), user), utils.ErrDuplicateEntry)
+}
+
+func testCreateUserDuplicateUsername(t *testing.T, h Harness) {
+	repo := h.New(t)
+	existing := mustCreate(t, repo)
+
+	user := newUser()
+	user.Username = existing.Username
+
+	expectErr(t, repo.CreateUser(context.Background(), user), utils.ErrDuplicateEntry)
+}
+
+func testGetUserByIDorEmail(t *testing.T, h Harness) {
+	repo := h.New(t)
+	user := mustCreate(t, repo)
+
+	for _, key := range []string{user.ID.String(), user.Email} {
+		got, err := repo.GetUserByIDorEmail(context.Background(), key)
+		if err != nil {
+			t.Fatalf("GetUserByIDorEmail(%q): unexpected error: %v", key, err)
+		}
+		if got.ID != user.ID || got.Email != user.Email || got.Username != user.Username {
+			t.Fatalf("GetUserByIDorEmail(%q): got %+v, want %+v", key, got, user)
+		}
+		if got.Password != user.Password {
+			t.Fatalf("GetUserByIDorEmail(%q): password hash not returned", key)
+		}
+	}
+}
+
+func testGetUserNotFound(t *testing.T, h Harness) {
+	repo := h.New(t)
+	mustCreate(t, repo)
+
+	_, err := repo.GetUserByIDorEmail(context.Background(), uuid.NewString())
+	expectErr(t, err, utils.ErrNotFound)
+
+	_, err = repo.GetUserByIDorEmail(context.Background(), "nobody@example.com")
+	expectErr(t, err, utils.ErrNotFound)
+}
+
+func testUpdateUser(t *testing.T, h Harness) {
+	repo := h.New(t)
+	user := mustCreate(t, repo)
+	changes := newUser()
+
+	update := *user
+	update.Firstname = "Grace"
+	update.Lastname = "Hopper"
+	update.Username = changes.Username
+	update.Email = changes.Email
+
+	if err := repo.UpdateUser(context.Background(), &update); err != nil {
+		t.Fatalf("UpdateUser: unexpected error: %v", err)
+	}
+
+	got, err := repo.GetUserByIDorEmail(context.Background(), user.ID.String())
+	if err != nil {
+		t.Fatalf("GetUserByIDorEmail: unexpected error: %v", err)
+	}
+	if got.Firstname != "Grace" || got.Lastname != "Hopper" ||
+		got.Username != changes.Username || got.Email != changes.Email {
+		t.Fatalf("UpdateUser didn't persist the changes, got %+v", got)
+	}
+	if got.Password != user.Password {
+		t.Fatal("UpdateUser changed the password")
+	}
+
+	_, err = repo.GetUserByIDorEmail(context.Background(), user.Email)
+	expectErr(t, err, utils.ErrNotFound)
+}
+
+func testUpdateUserDuplicateEmail(t *testing.T, h Harness) {
+	repo := h.New(t)
+	user := mustCreate(t, repo)
+	other := mustCreate(t, repo)
+
+	update := *user
+	update.Email = other.Email
+
+	expectErr(t, repo.UpdateUser(context.Background(), &update), utils.ErrDuplicateEntry)
+}
+
+func testUpdateUserNotFound(t *testing.T, h Harness) {
+	repo := h.New(t)
+
+	expectErr(t, repo.UpdateUser(context.Background(), newUser()), utils.ErrNotFound)
+}
+
+func testUpdateUserVersionConflict(t *testing.T, h Harness) {
+	repo := h.New(t)
+	user := mustCreate(t, repo)
+	stale := *user
+
+	first := *user
+	first.Firstname = "Grace"
+	if err := repo.UpdateUser(context.Background(), &first); err != nil {
+		t.Fatalf("UpdateUser: unexpected error: %v", err)
+	}
+	if first.Version <= user.Version {
+		t.Fatalf("UpdateUser didn't bump the version, got %d after %d", first.Version, user.Version)
+	}
+
+	stale.Lastname = "Hopper"
+	expectErr(t, repo.UpdateUser(context.Background(), &stale), utils.ErrVersionConflict)
+
+	got, err := repo.GetUserByIDorEmail(context.Background(), user.ID.String())
+	if err != nil {
+		t.Fatalf("GetUserByIDorEmail: unexpected error: %v", err)
+	}
+	if got.Firstname != "Grace" || got.Lastname != user.Lastname {
+		t.Fatalf("stale update overwrote the user, got %+v", got)
+	}
+
+	if _, err = repo.UpdatePassword(context.Background(), user.ID.String(), "new-s3cret-password"); err != nil {
+		t.Fatalf("UpdatePassword: unexpected error: %v", err)
+	}
+	expectErr(t, repo.UpdateUser(context.Background(), &first), utils.ErrVersionConflict)
+}
+
+func testPatchUser(t *testing.T, h Harness) {
+	repo := h.New(t)
+	user := mustCreate(t, repo)
+
+	firstname := "Grace"
+	got, err := repo.PatchUser(context.Background(), user.ID.String(), models.UserPatch{Firstname: &firstname})
+	if err != nil {
+		t.Fatalf("PatchUser: unexpected error: %v", err)
+	}
+	if got.Firstname != "Grace" || got.Lastname != user.Lastname ||
+		got.Username != user.Username || got.Email != user.Email {
+		t.Fatalf("PatchUser changed more than the firstname, got %+v", got)
+	}
+	if got.Version <= user.Version {
+		t.Fatalf("PatchUser didn't bump the version, got %d after %d", got.Version, user.Version)
+	}
+
+	unchanged, err := repo.PatchUser(context.Background(), user.ID.String(), models.UserPatch{})
+	if err != nil {
+		t.Fatalf("PatchUser: unexpected error: %v", err)
+	}
+	if unchanged.Version != got.Version || unchanged.Firstname != "Grace" {
+		t.Fatalf("empty patch changed the user, got %+v", unchanged)
+	}
+}
+
+func testPatchUserMetadata(t *testing.T, h Harness) {
+	repo := h.New(t)
+	user := mustCreate(t, repo)
+
+	metadata := models.UserMetadata{
+		User:  map[string]any{"locale": "en-GB", "consent": map[string]any{"marketing": true}},
+		Admin: map[string]any{"employee_id": "E-1042"},
+	}
+	if _, err := repo.PatchUser(context.Background(), user.ID.String(), models.UserPatch{Metadata: &metadata}); err != nil {
+		t.Fatalf("PatchUser: unexpected error: %v", err)
+	}
+
+	got, err := repo.GetUserByIDorEmail(context.Background(), user.ID.String())
+	if err != nil {
+		t.Fatalf("GetUserByIDorEmail: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got.Metadata, metadata) {
+		t.Fatalf("PatchUser didn't persist the metadata, got %+v", got.Metadata)
+	}
+	if got.Firstname != user.Firstname {
+		t.Fatalf("PatchUser changed the profile, got %+v", got)
+	}
+}
+
+func testPatchUserDuplicateUsername(t *testing.T, h Harness) {
+	repo := h.New(t)
+	user := mustCreate(t, repo)
+	other := mustCreate(t, repo)
+
+	_, err := repo.PatchUser(context.Background(), user.ID.String(), models.UserPatch{Username: &other.Username})
+	expectErr(t, err, utils.ErrDuplicateEntry)
+}
+
+func testPatchUserNotFound(t *testing.T, h Harness) {
+	repo := h.New(t)
+	firstname := "Grace"
+
+	_, err := repo.PatchUser(context.Background(), uuid.NewString(), models.UserPatch{Firstname: &firstname})
+	expectErr(t, err, utils.ErrNotFound)
+
+	_, err = repo.PatchUser(context.Background(), "not-a-uuid", models.UserPatch{})
+	expectErr(t, err, utils.ErrNotFound)
+}
+
+func testPatchUserVersionConflict(t *testing.T, h Harness) {
+	repo := h.New(t)
+	user := mustCreate(t, repo)
+	firstname, lastname := "Grace", "Hopper"
+
+	_, err := repo.PatchUser(context.Background(), user.ID.String(), models.UserPatch{Firstname: &firstname, Version: user.Version})
+	if err != nil {
+		t.Fatalf("PatchUser: unexpected error: %v", err)
+	}
+
+	_, err = repo.PatchUser(context.Background(), user.ID.String(), models.UserPatch{Lastname: &lastname, Version: user.Version})
+	expectErr(t, err, utils.ErrVersionConflict)
+
+	_, err = repo.PatchUser(context.Background(), user.ID.String(), models.UserPatch{Version: user.Version})
+	expectErr(t, err, utils.ErrVersionConflict)
+
+	got, err := repo.GetUserByIDorEmail(context.Background(), user.ID.String())
+	if err != nil {
+		t.Fatalf("GetUserByIDorEmail: unexpected error: %v", err)
+	}
+	if got.Lastname != user.Lastname {
+		t.Fatalf("stale patch overwrote the user, got %+v", got)
+	}
+}
+
+func testUpdatePassword(t *testing.T, h Harness) {
+	repo := h.New(t)
+	user := mustCreate(t, repo)
+
+	updated, err := repo.UpdatePassword(context.Background(), user.ID.String(), "new-s3cret-password")
+	if err != nil {
+		t.Fatalf("UpdatePassword: unexpected error: %v", err)
+	}
+	if !utils.CheckPasswordHash(context.Background(), "new-s3cret-password", updated.Password) {
+		t.Fatal("UpdatePassword returned a hash that doesn't match the new password")
+	}
+
+	got, err := repo.GetUserByIDorEmail(context.Background(), user.ID.String())
+	if err != nil {
+		t.Fatalf("GetUserByIDorEmail: unexpected error: %v", err)
+	}
+	if utils.CheckPasswordHash(context.Background(), password, got.Password) {
+		t.Fatal("the old password still matches after UpdatePassword")
+	}
+}
+
+func testUpdatePasswordNotFound(t *testing.T, h Harness) {
+	repo := h.New(t)
+
+	_, err := repo.UpdatePassword(context.Background(), uuid.NewString(), "new-s3cret-password")
+	expectErr(t, err, utils.ErrNotFound)
+}
+
+func testCheckUserNameExist(t *testing.T, h Harness) {
+	repo := h.New(t)
+	user := mustCreate(t, repo)
+
+	exists, err := repo.CheckUserNameExist(context.Background(), user.Username)
+	if err != nil || !exists {
+		t.Fatalf("CheckUserNameExist(%q) = %v, %v; want true, nil", user.Username, exists, err)
+	}
+
+	exists, err = repo.CheckUserNameExist(context.Background(), "nobody"+user.Username)
+	if err != nil || exists {
+		t.Fatalf("CheckUserNameExist(unknown) = %v, %v; want false, nil", exists, err)
+	}
+}
+
+func testDeletedUsersHidden(t *testing.T, h Harness) {
+	repo := h.New(t)
+	user := mustCreate(t, repo)
+	mustDelete(t, repo, user.ID)
+
+	_, err := repo.GetUserByIDorEmail(context.Background(), user.ID.String())
+	expectErr(t, err, utils.ErrNotFound)
+
+	_, err = repo.GetUserByIDorEmail(context.Background(), user.Email)
+	expectErr(t, err, utils.ErrNotFound)
+
+	expectErr(t, repo.UpdateUser(context.Background(), user), utils.ErrNotFound)
+
+	_, err = repo.UpdatePassword(context.Background(), user.ID.String(), "new-s3cret-password")
+	expectErr(t, err, utils.ErrNotFound)
+}
+
+func testDeletedUsersKeepUniqueness(t *testing.T, h Harness) {
+	repo := h.New(t)
+	deleted := mustCreate(t, repo)
+	mustDelete(t, repo, deleted.ID)
+
+	exists, err := repo.CheckUserNameExist(context.Background(), deleted.Username)
+	if err != nil || !exists {
+		t.Fatalf("CheckUserNameExist(deleted) = %v, %v; want true, nil", exists, err)
+	}
+
+	user := newUser()
+	user.Email = deleted.Email
+
+	expectErr(t, repo.CreateUser(context.Background(), user), utils.ErrDuplicateEntry)
+}
+
+func testSearchUsersPagination(t *testing.T, h Harness) {
+	repo := h.New(t)
+
+	created := map[uuid.UUID]bool{}
+	for i := 0; i < 5; i++ {
+		created[mustCreate(t, repo).ID] = true
+	}
+
+	for _, sort := range []string{models.SortCreatedAtAsc, models.SortCreatedAtDesc} {
+		seen := map[uuid.UUID]bool{}
+		var previous *models.User
+		params := models.UserSearchParams{Sort: sort, Limit: 2}
+
+		for pages := 0; ; pages++ {
+			if pages > len(created) {
+				t.Fatalf("%s: pagination didn't terminate", sort)
+			}
+
+			page, err := repo.SearchUsers(context.Background(), params)
+			if err != nil {
+				t.Fatalf("%s: SearchUsers: unexpected error: %v", sort, err)
+			}
+			if len(page.Users) > params.Limit {
+				t.Fatalf("%s: got %d users, limit is %d", sort, len(page.Users), params.Limit)
+			}
+
+			for i := range page.Users {
+				user := page.Users[i]
+				if seen[user.ID] {
+					t.Fatalf("%s: user %s returned twice", sort, user.ID)
+				}
+				seen[user.ID] = true
+
+				if previous != nil {
+					ascending := previous.CreatedAt.Before(user.CreatedAt) ||
+						(previous.CreatedAt.Equal(user.CreatedAt) && previous.ID.String() < user.ID.String())
+					if ascending != (sort == models.SortCreatedAtAsc) {
+						t.Fatalf("%s: users out of order", sort)
+					}
+				}
+				previous = &user
+			}
+
+			if page.NextCursor == "" {
+				break
+			}
+			params.Cursor = page.NextCursor
+		}
+
+		if len(seen) != len(created) {
+			t.Fatalf("%s: paged through %d users, want %d", sort, len(seen), len(created))
+		}
+	}
+}
+
+func testSearchUsersPrefix(t *testing.T, h Harness) {
+	repo := h.New(t)
+	user := mustCreate(t, repo)
+	mustCreate(t, repo)
+
+	for _, query := range []string{user.Username[:len(user.Username)-2], strings.ToUpper(user.Email[:12])} {
+		page, err := repo.SearchUsers(context.Background(), models.UserSearchParams{Query: query})
+		if err != nil {
+			t.Fatalf("SearchUsers(%q): unexpected error: %v", query, err)
+		}
+		if len(page.Users) != 1 || page.Users[0].ID != user.ID {
+			t.Fatalf("SearchUsers(%q): got %d users, want only %s", query, len(page.Users), user.ID)
+		}
+	}
+
+	page, err := repo.SearchUsers(context.Background(), models.UserSearchParams{Query: "ada%"})
+	if err != nil {
+		t.Fatalf("SearchUsers: unexpected error: %v", err)
+	}
+	if len(page.Users) != 0 {
+		t.Fatalf("SearchUsers treated %% as a wildcard, got %d users", len(page.Users))
+	}
+}
+
+func testSearchUsersStatus(t *testing.T, h Harness) {
+	repo := h.New(t)
+	active := mustCreate(t, repo)
+	deleted := mustCreate(t, repo)
+	mustDelete(t, repo, deleted.ID)
+
+	tests := []struct {
+		status string
+		want   []uuid.UUID
+	}{
+		{"", []uuid.UUID{active.ID}},
+		{models.UserStatusActive, []uuid.UUID{active.ID}},
+		{models.UserStatusDeleted, []uuid.UUID{deleted.ID}},
+		{models.UserStatusLocked, nil},
+		{models.UserStatusAll, []uuid.UUID{active.ID, deleted.ID}},
+	}
+
+	for _, tt := range tests {
+		page, err := repo.SearchUsers(context.Background(), models.UserSearchParams{
+			Status: tt.status,
+			Sort:   models.SortCreatedAtAsc,
+		})
+		if err != nil {
+			t.Fatalf("SearchUsers(status=%q): unexpected error: %v", tt.status, err)
+		}
+		if len(page.Users) != len(tt.want) {
+			t.Fatalf("SearchUsers(status=%q): got %d users, want %d", tt.status, len(page.Users), len(tt.want))
+		}
+		for i, id := range tt.want {
+			if page.Users[i].ID != id {
+				t.Fatalf("SearchUsers(status=%q): got user %s at %d, want %s", tt.status, page.Users[i].ID, i, id)
+			}
+		}
+	}
+}
+
+func testSearchUsersInvalidCursor(t *testing.T, h Harness) {
+	repo := h.New(t)
+
+	_, err := repo.SearchUsers(context.Background(), models.UserSearchParams{Cursor: "not-a-cursor"})
+	expectErr(t, err, utils.ErrInvalidCursor)
+}
+
+func testDeleteUserNotFound(t *testing.T, h Harness) {
+	repo := h.New(t)
+	user := mustCreate(t, repo)
+	mustDelete(t, repo, user.ID)
+
+	expectErr(t, repo.DeleteUser(context.Background(), user.ID.String()), utils.ErrNotFound)
+	expectErr(t, repo.DeleteUser(context.Background(), uuid.NewString()), utils.ErrNotFound)
+}
+
+// outbox returns the repository as an OutboxRepository, skipping the test
+// for backends without an outbox.
+func outbox(t *testing.T, repo repository.UserRepository) repository.OutboxRepository {
+	t.Helper()
+
+	outbox, ok := repo.(repository.OutboxRepository)
+	if !ok {
+		t.Skip("repository has no outbox")
+	}
+	return outbox
+}
+
+func testOutboxEvents(t *testing.T, h Harness) {
+	repo := h.New(t)
+	outbox := outbox(t, repo)
+	user := mustCreate(t, repo)
+
+	firstname := "Grace"
+	if _, err := repo.PatchUser(context.Background(), user.ID.String(), models.UserPatch{Firstname: &firstname}); err != nil {
+		t.Fatalf("PatchUser: unexpected error: %v", err)
+	}
+	// patching a field to its current value changes nothing
+	if _, err := repo.PatchUser(context.Background(), user.ID.String(), models.UserPatch{Firstname: &firstname}); err != nil {
+		t.Fatalf("PatchUser: unexpected error: %v", err)
+	}
+	if _, err := repo.UpdatePassword(context.Background(), user.ID.String(), "new-s3cret-password"); err != nil {
+		t.Fatalf("UpdatePassword: unexpected error: %v", err)
+	}
+	mustDelete(t, repo, user.ID)
+
+	events, err := outbox.ClaimEvents(context.Background(), 10, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimEvents: unexpected error: %v", err)
+	}
+
+	want := []string{
+		models.EventUserCreated, models.EventUserUpdated,
+		models.EventUserPasswordChanged, models.EventUserDeleted,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(events))
+	}
+	for i, event := range events {
+		if event.Type != want[i] || event.AggregateID != user.ID {
+			t.Fatalf("event %d: expected %s for %s, got %s for %s", i, want[i], user.ID, event.Type, event.AggregateID)
+		}
+	}
+
+	var payload models.UserEventPayload
+	if err := json.Unmarshal(events[1].Payload, &payload); err != nil {
+		t.Fatalf("invalid user.updated payload: %v", err)
+	}
+	if payload.User.Firstname != "Grace" || !reflect.DeepEqual(payload.Changes, []string{"firstname"}) {
+		t.Fatalf("unexpected user.updated payload %+v", payload)
+	}
+
+	for _, event := range events {
+		if err := outbox.MarkEventDispatched(context.Background(), event.ID); err != nil {
+			t.Fatalf("MarkEventDispatched: unexpected error: %v", err)
+		}
+	}
+
+	expectPendingEvents(t, outbox, 0)
+}
+
+func testOutboxLease(t *testing.T, h Harness) {
+	repo := h.New(t)
+	outbox := outbox(t, repo)
+	mustCreate(t, repo)
+
+	expectPendingEvents(t, outbox, 1)
+	expectPendingEvents(t, outbox, 0)
+}
+
+func testOutboxRetry(t *testing.T, h Harness) {
+	repo := h.New(t)
+	outbox := outbox(t, repo)
+	mustCreate(t, repo)
+	mustCreate(t, repo)
+
+	events, err := outbox.ClaimEvents(context.Background(), 10, time.Minute)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("ClaimEvents = %d events, %v; want 2, nil", len(events), err)
+	}
+
+	if err := outbox.MarkEventFailed(context.Background(), events[0].ID, "sink down", time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("MarkEventFailed: unexpected error: %v", err)
+	}
+	if err := outbox.MarkEventFailed(context.Background(), events[1].ID, "sink down", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("MarkEventFailed: unexpected error: %v", err)
+	}
+
+	retried, err := outbox.ClaimEvents(context.Background(), 10, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimEvents: unexpected error: %v", err)
+	}
+	if len(retried) != 1 || retried[0].ID != events[0].ID || retried[0].Attempts != 1 {
+		t.Fatalf("expected only the due event to be retried, got %+v", retried)
+	}
+}
+
+func expectPendingEvents(t *testing.T, outbox repository.OutboxRepository, want int) {
+	t.Helper()
+
+	events, err := outbox.ClaimEvents(context.Background(), 10, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimEvents: unexpected error: %v", err)
+	}
+	if len(events) != want {
+		t.Fatalf("expected %d claimable events, got %d", want, len(events))
+	}
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/tracing"
+	"github.com/rovilay/auth-service/utils"
+)
+
+func (r *postgresRepository) SearchUsers(ctx context.Context, params models.UserSearchParams) (*models.UserPage, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.SearchUsers")
+	defer span.End()
+
+	log := r.log.With().Str("method", "SearchUsers").Ctx(ctx).Logger()
+
+	params, cursor, err := prepareSearch(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var conditions []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if status := statusCondition(params.Status); status != "" {
+		conditions = append(conditions, status)
+	}
+
+	if params.Query != "" {
+		prefix := arg(escapeLike(strings.ToLower(params.Query)) + "%")
+		term := arg(strings.ToLower(params.Query))
+		conditions = append(conditions, fmt.Sprintf(`(
+			LOWER(username) LIKE %[1]s OR LOWER(email) LIKE %[1]s OR
+			LOWER(firstname) LIKE %[1]s OR LOWER(lastname) LIKE %[1]s OR
+			LOWER(firstname || ' ' || lastname) LIKE %[1]s OR
+			LOWER(username) %% %[2]s OR LOWER(email) %% %[2]s OR
+			LOWER(firstname || ' ' || lastname) %% %[2]s
+		)`, prefix, term))
+	}
+
+	if cursor != nil {
+		conditions = append(conditions, fmt.Sprintf(
+			"(created_at, id) %s (%s, %s)", cursorOperator(params.Sort), arg(cursor.CreatedAt), arg(cursor.ID),
+		))
+	}
+
+	query := "SELECT * FROM users"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT %s", orderBy(params.Sort), arg(params.Limit+1))
+
+	users := []models.User{}
+	err = r.db.SelectContext(ctx, &users, query, args...)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return newUserPage(users, params.Limit), nil
+}
+
+type userCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        uuid.UUID `json:"i"`
+}
+
+// prepareSearch applies the search defaults and decodes the cursor.
+func prepareSearch(params models.UserSearchParams) (models.UserSearchParams, *userCursor, error) {
+	params.Query = strings.TrimSpace(params.Query)
+
+	if params.Status == "" {
+		params.Status = models.UserStatusActive
+	}
+	if params.Sort == "" {
+		params.Sort = models.SortCreatedAtDesc
+	}
+	if params.Limit <= 0 {
+		params.Limit = models.DefaultSearchLimit
+	}
+	if params.Limit > models.MaxSearchLimit {
+		params.Limit = models.MaxSearchLimit
+	}
+
+	if params.Cursor == "" {
+		return params, nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(params.Cursor)
+	if err != nil {
+		return params, nil, utils.ErrInvalidCursor
+	}
+
+	var cursor userCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.ID == uuid.Nil {
+		return params, nil, utils.ErrInvalidCursor
+	}
+
+	return params, &cursor, nil
+}
+
+// newUserPage trims the extra row fetched to detect whether there is a next
+// page and builds its cursor from the last user returned.
+func newUserPage(users []models.User, limit int) *models.UserPage {
+	page := &models.UserPage{Users: users}
+	if len(users) <= limit {
+		return page
+	}
+
+	page.Users = users[:limit]
+	last := page.Users[limit-1]
+
+	raw, _ := json.Marshal(userCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	page.NextCursor = base64.RawURLEncoding.EncodeToString(raw)
+
+	return page
+}
+
+func statusCondition(status string) string {
+	switch status {
+	case models.UserStatusActive:
+		return "deleted_at IS NULL AND locked_at IS NULL"
+	case models.UserStatusLocked:
+		return "deleted_at IS NULL AND locked_at IS NOT NULL"
+	case models.UserStatusDeleted:
+		return "deleted_at IS NOT NULL"
+	default:
+		return ""
+	}
+}
+
+func orderBy(sort string) string {
+	if sort == models.SortCreatedAtAsc {
+		return "created_at ASC, id ASC"
+	}
+	return "created_at DESC, id DESC"
+}
+
+func cursorOperator(sort string) string {
+	if sort == models.SortCreatedAtAsc {
+		return ">"
+	}
+	return "<"
+}
+
+// escapeLike escapes the LIKE wildcards in s, queries use ESCAPE '\' where the
+// database needs it spelled out.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/tracing"
+	"github.com/rovilay/auth-service/utils"
+)
+
+// CreateServiceAccount inserts the account and records a
+// service_account.created event in the same transaction.
+func (r *postgresRepository) CreateServiceAccount(ctx context.Context, account *models.ServiceAccount) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.CreateServiceAccount")
+	defer span.End()
+
+	log := r.log.With().Str("method", "CreateServiceAccount").Ctx(ctx).Logger()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO service_accounts (id, name, description, owner_user_id, owner_organization_id, client_secret_hash, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+		RETURNING created_at, updated_at
+	`
+	err = tx.
+		QueryRowContext(
+			ctx, query, account.ID, account.Name, account.Description,
+			account.OwnerUserID, account.OwnerOrganizationID, account.ClientSecretHash,
+		).
+		Scan(&account.CreatedAt, &account.UpdatedAt)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if err = r.insertServiceAccountEvent(ctx, tx, models.EventServiceAccountCreated, account); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) GetServiceAccount(ctx context.Context, accountID string) (*models.ServiceAccount, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.GetServiceAccount")
+	defer span.End()
+
+	log := r.log.With().Str("method", "GetServiceAccount").Ctx(ctx).Logger()
+
+	if _, err := uuid.Parse(accountID); err != nil {
+		return nil, utils.ErrServiceAccountNotFound
+	}
+
+	query := `SELECT * FROM service_accounts WHERE id = $1 AND deleted_at IS NULL`
+
+	var account models.ServiceAccount
+	err := r.db.GetContext(ctx, &account, query, accountID)
+	if err != nil {
+		return nil, notFoundAs(r.mapDatabaseError(err, &log), utils.ErrServiceAccountNotFound)
+	}
+
+	return &account, nil
+}
+
+func (r *postgresRepository) ListUserServiceAccounts(ctx context.Context, userID string) ([]models.ServiceAccount, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.ListUserServiceAccounts")
+	defer span.End()
+
+	log := r.log.With().Str("method", "ListUserServiceAccounts").Ctx(ctx).Logger()
+
+	query := `
+		SELECT * FROM service_accounts
+		WHERE owner_user_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at DESC
+	`
+
+	accounts := []models.ServiceAccount{}
+	err := r.db.SelectContext(ctx, &accounts, query, userID)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return accounts, nil
+}
+
+func (r *postgresRepository) ListOrganizationServiceAccounts(ctx context.Context, orgID string) ([]models.ServiceAccount, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.ListOrganizationServiceAccounts")
+	defer span.End()
+
+	log := r.log.With().Str("method", "ListOrganizationServiceAccounts").Ctx(ctx).Logger()
+
+	query := `
+		SELECT * FROM service_accounts
+		WHERE owner_organization_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at DESC
+	`
+
+	accounts := []models.ServiceAccount{}
+	err := r.db.SelectContext(ctx, &accounts, query, orgID)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return accounts, nil
+}
+
+// UpdateServiceAccountSecret replaces the client secret hash and records a
+// service_account.secret_rotated event in the same transaction.
+func (r *postgresRepository) UpdateServiceAccountSecret(ctx context.Context, accountID string, secretHash string) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.UpdateServiceAccountSecret")
+	defer span.End()
+
+	log := r.log.With().Str("method", "UpdateServiceAccountSecret").Ctx(ctx).Logger()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE service_accounts
+		SET client_secret_hash = $1, updated_at = NOW()
+		WHERE id = $2 AND deleted_at IS NULL
+		RETURNING *
+	`
+
+	var account models.ServiceAccount
+	if err = tx.GetContext(ctx, &account, query, secretHash, accountID); err != nil {
+		return notFoundAs(r.mapDatabaseError(err, &log), utils.ErrServiceAccountNotFound)
+	}
+
+	if err = r.insertServiceAccountEvent(ctx, tx, models.EventServiceAccountSecretRotated, &account); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+// DeleteServiceAccount soft deletes the account and revokes its access
+// tokens so they stop working immediately. It records a
+// service_account.deleted event in the same transaction.
+func (r *postgresRepository) DeleteServiceAccount(ctx context.Context, accountID string) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.DeleteServiceAccount")
+	defer span.End()
+
+	log := r.log.With().Str("method", "DeleteServiceAccount").Ctx(ctx).Logger()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE service_accounts
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING *
+	`
+
+	var account models.ServiceAccount
+	if err = tx.GetContext(ctx, &account, query, accountID); err != nil {
+		return notFoundAs(r.mapDatabaseError(err, &log), utils.ErrServiceAccountNotFound)
+	}
+
+	query = `
+		UPDATE access_tokens
+		SET revoked_at = NOW()
+		WHERE service_account_id = $1 AND revoked_at IS NULL
+	`
+	if _, err = tx.ExecContext(ctx, query, accountID); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if err = r.insertServiceAccountEvent(ctx, tx, models.EventServiceAccountDeleted, &account); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
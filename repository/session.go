@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/tracing"
+	"github.com/rovilay/auth-service/utils"
+)
+
+func (r *postgresRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.CreateSession")
+	defer span.End()
+
+	log := r.log.With().Str("method", "CreateSession").Ctx(ctx).Logger()
+
+	query := `
+		INSERT INTO sessions (
+			id, user_id, token_hash, csrf_token_hash, user_agent, ip_address,
+			created_at, last_seen_at, idle_expires_at, expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW(), $7, $8)
+		RETURNING created_at, last_seen_at
+	`
+	err := r.db.
+		QueryRowContext(
+			ctx, query, session.ID, session.UserID, session.TokenHash, session.CSRFTokenHash,
+			session.UserAgent, session.IPAddress, session.IdleExpiresAt, session.ExpiresAt,
+		).
+		Scan(&session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+// GetSessionByTokenHash returns the session matching tokenHash as long as its
+// user still exists. Expiry and revocation are checked by the caller.
+func (r *postgresRepository) GetSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.GetSessionByTokenHash")
+	defer span.End()
+
+	log := r.log.With().Str("method", "GetSessionByTokenHash").Ctx(ctx).Logger()
+
+	query := `
+		SELECT s.* FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND u.deleted_at IS NULL
+	`
+
+	var session models.Session
+	err := r.db.GetContext(ctx, &session, query, tokenHash)
+	if err != nil {
+		return nil, notFoundAs(r.mapDatabaseError(err, &log), utils.ErrInvalidSession)
+	}
+
+	return &session, nil
+}
+
+// TouchSession records activity on the session and extends its idle expiry.
+func (r *postgresRepository) TouchSession(ctx context.Context, sessionID uuid.UUID, idleExpiresAt time.Time) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.TouchSession")
+	defer span.End()
+
+	log := r.log.With().Str("method", "TouchSession").Ctx(ctx).Logger()
+
+	query := `UPDATE sessions SET last_seen_at = NOW(), idle_expires_at = $1 WHERE id = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, idleExpiresAt, sessionID); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.RevokeSession")
+	defer span.End()
+
+	log := r.log.With().Str("method", "RevokeSession").Ctx(ctx).Logger()
+
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+
+	res, err := r.db.ExecContext(ctx, query, sessionID)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	} else if n == 0 {
+		return utils.ErrInvalidSession
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.RevokeUserSessions")
+	defer span.End()
+
+	log := r.log.With().Str("method", "RevokeUserSessions").Ctx(ctx).Logger()
+
+	if err := r.revokeUserSessions(ctx, r.db, userID); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+// revokeUserSessions revokes the sessions of the user with db, which may be a
+// transaction.
+func (r *postgresRepository) revokeUserSessions(ctx context.Context, db sqlx.ExecerContext, userID uuid.UUID) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+
+	_, err := db.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,553 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/tracing"
+	"github.com/rovilay/auth-service/utils"
+	"github.com/rs/zerolog"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteRepository is a UserRepository for single node deployments that
+// don't run postgres. Timestamps are set from Go since SQLite has no NOW().
+type sqliteRepository struct {
+	db  *sqlx.DB
+	log *zerolog.Logger
+
+	// configured is set once the pragmas are applied, until then Ping retries
+	configured atomic.Bool
+}
+
+func NewSQLiteRepository(ctx context.Context, db *sqlx.DB, log *zerolog.Logger) *sqliteRepository {
+	logger := log.With().Str("repository", "sqliteRepository").Logger()
+
+	// SQLite allows a single writer, a single connection avoids SQLITE_BUSY
+	// errors and keeps the per-connection pragmas from configure in effect.
+	db.SetMaxOpenConns(1)
+
+	r := &sqliteRepository{
+		log: &logger,
+		db:  db,
+	}
+	if err := r.configure(ctx); err != nil {
+		logger.Err(err).Msg("failed to configure sqlite")
+	}
+
+	return r
+}
+
+// configure applies the pragmas the repository relies on.
+func (r *sqliteRepository) configure(ctx context.Context) error {
+	if r.configured.Load() {
+		return nil
+	}
+
+	pragmas := `
+		PRAGMA foreign_keys = ON;
+		PRAGMA busy_timeout = 5000;
+		PRAGMA journal_mode = WAL;
+	`
+	if _, err := r.db.ExecContext(ctx, pragmas); err != nil {
+		return err
+	}
+	r.configured.Store(true)
+
+	return nil
+}
+
+func (r *sqliteRepository) CreateUser(ctx context.Context, user *models.User) error {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.CreateUser")
+	defer span.End()
+
+	log := r.log.With().Str("method", "CreateUser").Ctx(ctx).Logger()
+
+	hashedPassword, err := utils.HashPassword(ctx, user.Password)
+	if err != nil {
+		log.Err(err).Msg(utils.ErrPasswordHash.Error())
+		return utils.ErrPasswordHash
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO users (id, firstname, lastname, username, email, password, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, firstname, lastname, username, email, password, created_at, updated_at, version, metadata
+	`
+
+	now := sqliteTimestamp(time.Now())
+	err = tx.QueryRowContext(
+		ctx, query, user.ID, user.Firstname, user.Lastname,
+		user.Username, user.Email, hashedPassword, now, now,
+	).Scan(
+		&user.ID, &user.Firstname, &user.Lastname,
+		&user.Username, &user.Email, &user.Password,
+		&user.CreatedAt, &user.UpdatedAt, &user.Version, &user.Metadata,
+	)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if err = r.insertUserEvent(ctx, tx, models.EventUserCreated, user, nil); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+// UpdateUser writes the profile only if user.Version is still the stored
+// version, and returns utils.ErrVersionConflict otherwise.
+func (r *sqliteRepository) UpdateUser(ctx context.Context, user *models.User) error {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.UpdateUser")
+	defer span.End()
+
+	log := r.log.With().Str("method", "UpdateUser").Ctx(ctx).Logger()
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	before, err := r.getUser(ctx, tx, user.ID.String())
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	query := `
+		UPDATE users
+		SET firstname = ?, lastname = ?, username = ?, email = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND deleted_at IS NULL AND version = ?
+		RETURNING id, firstname, lastname, username, email, password, created_at, updated_at, version, metadata
+	`
+	err = tx.
+		QueryRowContext(
+			ctx, query, user.Firstname, user.Lastname, user.Username,
+			user.Email, sqliteTimestamp(time.Now()), user.ID.String(), user.Version,
+		).
+		Scan(
+			&user.ID, &user.Firstname, &user.Lastname,
+			&user.Username, &user.Email, &user.Password,
+			&user.CreatedAt, &user.UpdatedAt, &user.Version, &user.Metadata,
+		)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the user was read in this transaction, only the version can differ
+		return utils.ErrVersionConflict
+	}
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if changes := userChanges(before, user); len(changes) > 0 {
+		if err = r.insertUserEvent(ctx, tx, models.EventUserUpdated, user, changes); err != nil {
+			return r.mapDatabaseError(err, &log)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+// PatchUser updates only the fields set in patch. When patch.Version is set
+// the update also requires the stored version to match.
+func (r *sqliteRepository) PatchUser(ctx context.Context, userId string, patch models.UserPatch) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.PatchUser")
+	defer span.End()
+
+	log := r.log.With().Str("method", "PatchUser").Ctx(ctx).Logger()
+
+	if _, err := uuid.Parse(userId); err != nil {
+		return nil, utils.ErrNotFound
+	}
+
+	if patch.IsEmpty() {
+		return unchangedUser(ctx, r, userId, patch)
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	before, err := r.getUser(ctx, tx, userId)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	if patch.Version != 0 && before.Version != patch.Version {
+		return nil, utils.ErrVersionConflict
+	}
+
+	columns, args := patchAssignments(patch)
+	set := make([]string, 0, len(columns)+2)
+	for _, column := range columns {
+		set = append(set, column+" = ?")
+	}
+	set = append(set, "updated_at = ?", "version = version + 1")
+	args = append(args, sqliteTimestamp(time.Now()), userId)
+
+	query := fmt.Sprintf(`
+		UPDATE users SET %s WHERE id = ? AND deleted_at IS NULL
+		RETURNING id, firstname, lastname, username, email, password, created_at, updated_at, version, metadata
+	`, strings.Join(set, ", "))
+
+	var user models.User
+	err = tx.
+		QueryRowContext(ctx, query, args...).
+		Scan(
+			&user.ID, &user.Firstname, &user.Lastname,
+			&user.Username, &user.Email, &user.Password,
+			&user.CreatedAt, &user.UpdatedAt, &user.Version, &user.Metadata,
+		)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	if changes := userChanges(before, &user); len(changes) > 0 {
+		if err = r.insertUserEvent(ctx, tx, models.EventUserUpdated, &user, changes); err != nil {
+			return nil, r.mapDatabaseError(err, &log)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return &user, nil
+}
+
+// getUser reads the user inside tx. The repository has a single
+// connection, so queries can't go through r.db while tx is open.
+func (r *sqliteRepository) getUser(ctx context.Context, tx *sqlx.Tx, userId string) (*models.User, error) {
+	var user models.User
+	err := tx.GetContext(ctx, &user, `SELECT * FROM users WHERE id = ? AND deleted_at IS NULL`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *sqliteRepository) UpdatePassword(ctx context.Context, userId string, password string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.UpdatePassword")
+	defer span.End()
+
+	log := r.log.With().Str("method", "UpdatePassword").Ctx(ctx).Logger()
+
+	hashedPassword, err := utils.HashPassword(ctx, password)
+	if err != nil {
+		log.Err(err).Msg(utils.ErrPasswordHash.Error())
+		return nil, utils.ErrPasswordHash
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users
+		SET password = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND deleted_at IS NULL
+		RETURNING id, firstname, lastname, username, email, password, created_at, updated_at, version, metadata
+	`
+
+	var user models.User
+	err = tx.
+		QueryRowContext(ctx, query, hashedPassword, sqliteTimestamp(time.Now()), userId).
+		Scan(
+			&user.ID, &user.Firstname, &user.Lastname,
+			&user.Username, &user.Email, &user.Password,
+			&user.CreatedAt, &user.UpdatedAt, &user.Version, &user.Metadata,
+		)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	if err = r.insertUserEvent(ctx, tx, models.EventUserPasswordChanged, &user, nil); err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	// sessions started with the old password must not outlive it
+	if err = r.revokeUserSessions(ctx, tx, user.ID); err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return &user, nil
+}
+
+func (r *sqliteRepository) GetUserByIDorEmail(ctx context.Context, idOrEmail string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.GetUserByIDorEmail")
+	defer span.End()
+
+	log := r.log.With().Str("method", "GetUserByIDorEmail").Ctx(ctx).Logger()
+
+	query := `SELECT * FROM users WHERE email = ? AND deleted_at IS NULL`
+	// Check if the provided string looks like a UUID
+	if _, err := uuid.Parse(idOrEmail); err == nil {
+		// Search by UUID
+		query = `SELECT * FROM users WHERE id = ? AND deleted_at IS NULL`
+	}
+
+	var user models.User
+	err := r.db.GetContext(ctx, &user, query, idOrEmail)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return &user, nil
+}
+
+func (r *sqliteRepository) CheckUserNameExist(ctx context.Context, username string) (bool, error) {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.CheckUserNameExist")
+	defer span.End()
+
+	log := r.log.With().Str("method", "CheckUserNameExist").Ctx(ctx).Logger()
+
+	query := "SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)"
+
+	var exists bool
+	err := r.db.QueryRowContext(ctx, query, username).Scan(&exists)
+	if err != nil {
+		return true, r.mapDatabaseError(err, &log)
+	}
+
+	return exists, nil
+}
+
+// DeleteUser soft deletes the user by setting deleted_at.
+func (r *sqliteRepository) DeleteUser(ctx context.Context, userId string) error {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.DeleteUser")
+	defer span.End()
+
+	log := r.log.With().Str("method", "DeleteUser").Ctx(ctx).Logger()
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users
+		SET deleted_at = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND deleted_at IS NULL
+		RETURNING *
+	`
+
+	var user models.User
+	now := sqliteTimestamp(time.Now())
+	err = tx.GetContext(ctx, &user, query, now, now, userId)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if err = r.insertUserEvent(ctx, tx, models.EventUserDeleted, &user, nil); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) SearchUsers(ctx context.Context, params models.UserSearchParams) (*models.UserPage, error) {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.SearchUsers")
+	defer span.End()
+
+	log := r.log.With().Str("method", "SearchUsers").Ctx(ctx).Logger()
+
+	params, cursor, err := prepareSearch(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var conditions []string
+	var args []any
+
+	if status := statusCondition(params.Status); status != "" {
+		conditions = append(conditions, status)
+	}
+
+	// SQLite has no trigram support, substring matching stands in for it
+	if params.Query != "" {
+		prefix := escapeLike(strings.ToLower(params.Query)) + "%"
+		term := strings.ToLower(params.Query)
+		conditions = append(conditions, `(
+			LOWER(username) LIKE ? ESCAPE '\' OR LOWER(email) LIKE ? ESCAPE '\' OR
+			LOWER(firstname) LIKE ? ESCAPE '\' OR LOWER(lastname) LIKE ? ESCAPE '\' OR
+			LOWER(firstname || ' ' || lastname) LIKE ? ESCAPE '\' OR
+			INSTR(LOWER(username), ?) > 0 OR INSTR(LOWER(email), ?) > 0 OR
+			INSTR(LOWER(firstname || ' ' || lastname), ?) > 0
+		)`)
+		args = append(args, prefix, prefix, prefix, prefix, prefix, term, term, term)
+	}
+
+	if cursor != nil {
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) %s (?, ?)", cursorOperator(params.Sort)))
+		args = append(args, sqliteTimestamp(cursor.CreatedAt), cursor.ID.String())
+	}
+
+	query := "SELECT * FROM users"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT ?", orderBy(params.Sort))
+	args = append(args, params.Limit+1)
+
+	users := []models.User{}
+	err = r.db.SelectContext(ctx, &users, query, args...)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return newUserPage(users, params.Limit), nil
+}
+
+func (r *sqliteRepository) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]models.Event, error) {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.ClaimEvents")
+	defer span.End()
+
+	log := r.log.With().Str("method", "ClaimEvents").Ctx(ctx).Logger()
+
+	query := `
+		UPDATE outbox_events
+		SET locked_until = ?
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE dispatched_at IS NULL AND (locked_until IS NULL OR locked_until < ?)
+			ORDER BY created_at
+			LIMIT ?
+		)
+		RETURNING *
+	`
+
+	now := time.Now()
+	events := []models.Event{}
+	err := r.db.SelectContext(ctx, &events, query, sqliteTimestamp(now.Add(lease)), sqliteTimestamp(now), limit)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	sortEvents(events)
+
+	return events, nil
+}
+
+func (r *sqliteRepository) MarkEventDispatched(ctx context.Context, eventID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.MarkEventDispatched")
+	defer span.End()
+
+	log := r.log.With().Str("method", "MarkEventDispatched").Ctx(ctx).Logger()
+
+	query := `UPDATE outbox_events SET dispatched_at = ?, locked_until = NULL WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, sqliteTimestamp(time.Now()), eventID.String()); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) MarkEventFailed(ctx context.Context, eventID uuid.UUID, reason string, retryAt time.Time) error {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.MarkEventFailed")
+	defer span.End()
+
+	log := r.log.With().Str("method", "MarkEventFailed").Ctx(ctx).Logger()
+
+	query := `UPDATE outbox_events SET attempts = attempts + 1, last_error = ?, locked_until = ? WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, reason, sqliteTimestamp(retryAt), eventID.String()); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) insertUserEvent(ctx context.Context, tx *sqlx.Tx, eventType string, user *models.User, changes []string) error {
+	event, err := newUserEvent(ctx, eventType, user, changes)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO outbox_events (id, type, aggregate_id, payload, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	_, err = tx.ExecContext(
+		ctx, query, event.ID.String(), event.Type, event.AggregateID.String(),
+		event.Payload, sqliteTimestamp(event.CreatedAt),
+	)
+	return err
+}
+
+func (r *sqliteRepository) Ping(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.Ping")
+	defer span.End()
+
+	if err := r.configure(ctx); err != nil {
+		return err
+	}
+
+	return r.db.PingContext(ctx)
+}
+
+// sqliteTimestamp formats t with a fixed width so that timestamps stored as
+// text sort chronologically, which keyset pagination relies on.
+func sqliteTimestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000Z07:00")
+}
+
+// mapDatabaseError maps SQLite errors onto the same utils errors as the
+// postgres repository.
+func (r *sqliteRepository) mapDatabaseError(err error, log *zerolog.Logger) error {
+	log.Err(err).Msg("database operation failed!")
+
+	var sqliteErr *sqlite.Error
+	if ok := errors.As(err, &sqliteErr); ok {
+		log.Debug().Msg(fmt.Sprintf("%v:%v", ok, sqliteErr.Code()))
+
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return utils.ErrDuplicateEntry
+		case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			return utils.ErrForeignKeyViolation
+		default:
+			return fmt.Errorf("database error (%d): %w", sqliteErr.Code(), err)
+		}
+	} else if errors.Is(err, sql.ErrNoRows) {
+		return utils.ErrNotFound
+	} else {
+		return fmt.Errorf("database error: %w", err)
+	}
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/tracing"
+	"github.com/rovilay/auth-service/utils"
+)
+
+func (r *sqliteRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.CreateSession")
+	defer span.End()
+
+	log := r.log.With().Str("method", "CreateSession").Ctx(ctx).Logger()
+
+	query := `
+		INSERT INTO sessions (
+			id, user_id, token_hash, csrf_token_hash, user_agent, ip_address,
+			created_at, last_seen_at, idle_expires_at, expires_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING created_at, last_seen_at
+	`
+
+	now := sqliteTimestamp(time.Now())
+	err := r.db.
+		QueryRowContext(
+			ctx, query, session.ID.String(), session.UserID.String(), session.TokenHash, session.CSRFTokenHash,
+			session.UserAgent, session.IPAddress, now, now,
+			sqliteTimestamp(session.IdleExpiresAt), sqliteTimestamp(session.ExpiresAt),
+		).
+		Scan(&session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) GetSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.GetSessionByTokenHash")
+	defer span.End()
+
+	log := r.log.With().Str("method", "GetSessionByTokenHash").Ctx(ctx).Logger()
+
+	query := `
+		SELECT s.* FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = ? AND u.deleted_at IS NULL
+	`
+
+	var session models.Session
+	err := r.db.GetContext(ctx, &session, query, tokenHash)
+	if err != nil {
+		return nil, notFoundAs(r.mapDatabaseError(err, &log), utils.ErrInvalidSession)
+	}
+
+	return &session, nil
+}
+
+func (r *sqliteRepository) TouchSession(ctx context.Context, sessionID uuid.UUID, idleExpiresAt time.Time) error {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.TouchSession")
+	defer span.End()
+
+	log := r.log.With().Str("method", "TouchSession").Ctx(ctx).Logger()
+
+	query := `UPDATE sessions SET last_seen_at = ?, idle_expires_at = ? WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query, sqliteTimestamp(time.Now()), sqliteTimestamp(idleExpiresAt), sessionID.String())
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.RevokeSession")
+	defer span.End()
+
+	log := r.log.With().Str("method", "RevokeSession").Ctx(ctx).Logger()
+
+	query := `UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`
+
+	res, err := r.db.ExecContext(ctx, query, sqliteTimestamp(time.Now()), sessionID.String())
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	} else if n == 0 {
+		return utils.ErrInvalidSession
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.RevokeUserSessions")
+	defer span.End()
+
+	log := r.log.With().Str("method", "RevokeUserSessions").Ctx(ctx).Logger()
+
+	if err := r.revokeUserSessions(ctx, r.db, userID); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+// revokeUserSessions revokes the sessions of the user with db, which may be a
+// transaction.
+func (r *sqliteRepository) revokeUserSessions(ctx context.Context, db sqlx.ExecerContext, userID uuid.UUID) error {
+	query := `UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`
+
+	_, err := db.ExecContext(ctx, query, sqliteTimestamp(time.Now()), userID.String())
+	return err
+}
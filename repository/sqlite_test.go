@@ -0,0 +1,47 @@
+package repository_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/migrations"
+	"github.com/rovilay/auth-service/migrator"
+	"github.com/rovilay/auth-service/repository"
+	"github.com/rovilay/auth-service/repository/repositorytest"
+	"github.com/rs/zerolog"
+)
+
+func TestSQLiteRepository(t *testing.T) {
+	logger := zerolog.Nop()
+
+	repositorytest.RunUserRepositoryTests(t, repositorytest.Harness{
+		New: func(t *testing.T) repository.UserRepository {
+			ctx := context.Background()
+
+			db, err := sqlx.Open(config.DriverSQLite, filepath.Join(t.TempDir(), "auth.db"))
+			if err != nil {
+				t.Fatalf("open sqlite: %v", err)
+			}
+			t.Cleanup(func() { db.Close() })
+
+			repo := repository.NewSQLiteRepository(ctx, db, &logger)
+
+			source, err := migrations.ForDriver(config.DriverSQLite)
+			if err != nil {
+				t.Fatalf("load migrations: %v", err)
+			}
+			m, err := migrator.New(db, config.DriverSQLite, source, &logger)
+			if err != nil {
+				t.Fatalf("create migrator: %v", err)
+			}
+			if err := m.Up(ctx); err != nil {
+				t.Fatalf("apply migrations: %v", err)
+			}
+
+			return repo
+		},
+	})
+}
@@ -0,0 +1,245 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/tracing"
+	"github.com/rovilay/auth-service/utils"
+)
+
+func (r *sqliteRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.CreateWebhook")
+	defer span.End()
+
+	log := r.log.With().Str("method", "CreateWebhook").Ctx(ctx).Logger()
+
+	query := `
+		INSERT INTO webhooks (id, url, secret, events, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING created_at, updated_at
+	`
+
+	now := sqliteTimestamp(time.Now())
+	err := r.db.
+		QueryRowContext(ctx, query, webhook.ID.String(), webhook.URL, webhook.Secret, webhook.Events, now, now).
+		Scan(&webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.ListWebhooks")
+	defer span.End()
+
+	log := r.log.With().Str("method", "ListWebhooks").Ctx(ctx).Logger()
+
+	webhooks := []models.Webhook{}
+	err := r.db.SelectContext(ctx, &webhooks, `SELECT * FROM webhooks ORDER BY created_at`)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return webhooks, nil
+}
+
+func (r *sqliteRepository) GetWebhook(ctx context.Context, webhookID string) (*models.Webhook, error) {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.GetWebhook")
+	defer span.End()
+
+	log := r.log.With().Str("method", "GetWebhook").Ctx(ctx).Logger()
+
+	if _, err := uuid.Parse(webhookID); err != nil {
+		return nil, utils.ErrWebhookNotFound
+	}
+
+	var webhook models.Webhook
+	err := r.db.GetContext(ctx, &webhook, `SELECT * FROM webhooks WHERE id = ?`, webhookID)
+	if err != nil {
+		return nil, notFoundAs(r.mapDatabaseError(err, &log), utils.ErrWebhookNotFound)
+	}
+
+	return &webhook, nil
+}
+
+func (r *sqliteRepository) DeleteWebhook(ctx context.Context, webhookID string) error {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.DeleteWebhook")
+	defer span.End()
+
+	log := r.log.With().Str("method", "DeleteWebhook").Ctx(ctx).Logger()
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, webhookID)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	} else if n == 0 {
+		return utils.ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) EnqueueWebhookDeliveries(ctx context.Context, event models.Event) error {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.EnqueueWebhookDeliveries")
+	defer span.End()
+
+	log := r.log.With().Str("method", "EnqueueWebhookDeliveries").Ctx(ctx).Logger()
+
+	webhooks, err := r.ListWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := webhookPayload(event)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (webhook_id, event_id) DO NOTHING
+	`
+
+	now := sqliteTimestamp(time.Now())
+	for _, webhook := range webhooks {
+		if !webhook.Events.Matches(event.Type) {
+			continue
+		}
+
+		_, err = tx.ExecContext(
+			ctx, query, uuid.NewString(), webhook.ID.String(), event.ID.String(), event.Type,
+			payload, models.WebhookDeliveryPending, now, now, now,
+		)
+		if err != nil {
+			return r.mapDatabaseError(err, &log)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.ClaimWebhookDeliveries")
+	defer span.End()
+
+	log := r.log.With().Str("method", "ClaimWebhookDeliveries").Ctx(ctx).Logger()
+
+	query := `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status IN (?, ?) AND next_attempt_at <= ?
+			ORDER BY next_attempt_at
+			LIMIT ?
+		)
+		RETURNING *
+	`
+
+	now := time.Now()
+	deliveries := []models.WebhookDelivery{}
+	err := r.db.SelectContext(
+		ctx, &deliveries, query, sqliteTimestamp(now.Add(lease)),
+		models.WebhookDeliveryPending, models.WebhookDeliveryFailed, sqliteTimestamp(now), limit,
+	)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return deliveries, nil
+}
+
+func (r *sqliteRepository) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.UpdateWebhookDelivery")
+	defer span.End()
+
+	log := r.log.With().Str("method", "UpdateWebhookDelivery").Ctx(ctx).Logger()
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?,
+			last_error = ?, delivered_at = ?, updated_at = ?
+		WHERE id = ?
+		RETURNING updated_at
+	`
+	err := r.db.
+		QueryRowContext(
+			ctx, query, delivery.Status, delivery.Attempts, sqliteNullableTimestamp(delivery.NextAttemptAt),
+			delivery.LastStatusCode, delivery.LastError, sqliteNullableTimestamp(delivery.DeliveredAt),
+			sqliteTimestamp(time.Now()), delivery.ID.String(),
+		).
+		Scan(&delivery.UpdatedAt)
+	if err != nil {
+		return notFoundAs(r.mapDatabaseError(err, &log), utils.ErrWebhookDeliveryNotFound)
+	}
+
+	return nil
+}
+
+func (r *sqliteRepository) ListWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.ListWebhookDeliveries")
+	defer span.End()
+
+	log := r.log.With().Str("method", "ListWebhookDeliveries").Ctx(ctx).Logger()
+
+	query := `SELECT * FROM webhook_deliveries WHERE webhook_id = ? ORDER BY created_at DESC, id DESC LIMIT ?`
+
+	deliveries := []models.WebhookDelivery{}
+	err := r.db.SelectContext(ctx, &deliveries, query, webhookID, limit)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return deliveries, nil
+}
+
+func (r *sqliteRepository) RedeliverWebhookDelivery(ctx context.Context, webhookID string, deliveryID string) (*models.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "sqliteRepository.RedeliverWebhookDelivery")
+	defer span.End()
+
+	log := r.log.With().Str("method", "RedeliverWebhookDelivery").Ctx(ctx).Logger()
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = 0, next_attempt_at = ?, updated_at = ?
+		WHERE id = ? AND webhook_id = ?
+		RETURNING *
+	`
+
+	var delivery models.WebhookDelivery
+	now := sqliteTimestamp(time.Now())
+	err := r.db.GetContext(ctx, &delivery, query, models.WebhookDeliveryPending, now, now, deliveryID, webhookID)
+	if err != nil {
+		return nil, notFoundAs(r.mapDatabaseError(err, &log), utils.ErrWebhookDeliveryNotFound)
+	}
+
+	return &delivery, nil
+}
+
+func sqliteNullableTimestamp(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+
+	ts := sqliteTimestamp(*t)
+	return &ts
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/tracing"
+	"github.com/rovilay/auth-service/utils"
+)
+
+func (r *postgresRepository) CreateAccessToken(ctx context.Context, token *models.AccessToken) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.CreateAccessToken")
+	defer span.End()
+
+	log := r.log.With().Str("method", "CreateAccessToken").Ctx(ctx).Logger()
+
+	query := `
+		INSERT INTO access_tokens (id, user_id, service_account_id, name, prefix, token_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+		RETURNING created_at
+	`
+	err := r.db.
+		QueryRowContext(
+			ctx, query, token.ID, token.UserID, token.ServiceAccountID, token.Name,
+			token.Prefix, token.TokenHash, token.Scopes, token.ExpiresAt,
+		).
+		Scan(&token.CreatedAt)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) ListAccessTokens(ctx context.Context, owner models.Principal) ([]models.AccessToken, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.ListAccessTokens")
+	defer span.End()
+
+	log := r.log.With().Str("method", "ListAccessTokens").Ctx(ctx).Logger()
+
+	query := fmt.Sprintf(`
+		SELECT * FROM access_tokens
+		WHERE %s = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, tokenOwnerColumn(owner))
+
+	tokens := []models.AccessToken{}
+	err := r.db.SelectContext(ctx, &tokens, query, owner.ID)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return tokens, nil
+}
+
+// GetAccessTokenByHash returns the token matching tokenHash as long as its
+// owner, a user or a service account, still exists. Expiry and revocation are
+// checked by the caller.
+func (r *postgresRepository) GetAccessTokenByHash(ctx context.Context, tokenHash string) (*models.AccessToken, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.GetAccessTokenByHash")
+	defer span.End()
+
+	log := r.log.With().Str("method", "GetAccessTokenByHash").Ctx(ctx).Logger()
+
+	query := `
+		SELECT t.* FROM access_tokens t
+		LEFT JOIN users u ON u.id = t.user_id
+		LEFT JOIN service_accounts s ON s.id = t.service_account_id
+		WHERE t.token_hash = $1
+			AND (u.id IS NOT NULL OR s.id IS NOT NULL)
+			AND u.deleted_at IS NULL AND s.deleted_at IS NULL
+	`
+
+	var token models.AccessToken
+	err := r.db.GetContext(ctx, &token, query, tokenHash)
+	if err != nil {
+		return nil, notFoundAs(r.mapDatabaseError(err, &log), utils.ErrInvalidAccessToken)
+	}
+
+	return &token, nil
+}
+
+func (r *postgresRepository) TouchAccessToken(ctx context.Context, tokenID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.TouchAccessToken")
+	defer span.End()
+
+	log := r.log.With().Str("method", "TouchAccessToken").Ctx(ctx).Logger()
+
+	query := `UPDATE access_tokens SET last_used_at = NOW() WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, tokenID); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) RevokeAccessToken(ctx context.Context, owner models.Principal, tokenID string) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.RevokeAccessToken")
+	defer span.End()
+
+	log := r.log.With().Str("method", "RevokeAccessToken").Ctx(ctx).Logger()
+
+	if _, err := uuid.Parse(tokenID); err != nil {
+		return utils.ErrAccessTokenNotFound
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE access_tokens
+		SET revoked_at = NOW()
+		WHERE id = $1 AND %s = $2 AND revoked_at IS NULL
+	`, tokenOwnerColumn(owner))
+
+	res, err := r.db.ExecContext(ctx, query, tokenID, owner.ID)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	} else if n == 0 {
+		return utils.ErrAccessTokenNotFound
+	}
+
+	return nil
+}
+
+func tokenOwnerColumn(owner models.Principal) string {
+	if owner.Type == models.PrincipalServiceAccount {
+		return "service_account_id"
+	}
+	return "user_id"
+}
@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/tracing"
+	"github.com/rovilay/auth-service/utils"
+)
+
+func (r *postgresRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.CreateWebhook")
+	defer span.End()
+
+	log := r.log.With().Str("method", "CreateWebhook").Ctx(ctx).Logger()
+
+	query := `
+		INSERT INTO webhooks (id, url, secret, events, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		RETURNING created_at, updated_at
+	`
+	err := r.db.
+		QueryRowContext(ctx, query, webhook.ID, webhook.URL, webhook.Secret, webhook.Events).
+		Scan(&webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.ListWebhooks")
+	defer span.End()
+
+	log := r.log.With().Str("method", "ListWebhooks").Ctx(ctx).Logger()
+
+	webhooks := []models.Webhook{}
+	err := r.db.SelectContext(ctx, &webhooks, `SELECT * FROM webhooks ORDER BY created_at`)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return webhooks, nil
+}
+
+func (r *postgresRepository) GetWebhook(ctx context.Context, webhookID string) (*models.Webhook, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.GetWebhook")
+	defer span.End()
+
+	log := r.log.With().Str("method", "GetWebhook").Ctx(ctx).Logger()
+
+	if _, err := uuid.Parse(webhookID); err != nil {
+		return nil, utils.ErrWebhookNotFound
+	}
+
+	var webhook models.Webhook
+	err := r.db.GetContext(ctx, &webhook, `SELECT * FROM webhooks WHERE id = $1`, webhookID)
+	if err != nil {
+		return nil, notFoundAs(r.mapDatabaseError(err, &log), utils.ErrWebhookNotFound)
+	}
+
+	return &webhook, nil
+}
+
+// DeleteWebhook deletes the webhook together with its deliveries.
+func (r *postgresRepository) DeleteWebhook(ctx context.Context, webhookID string) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.DeleteWebhook")
+	defer span.End()
+
+	log := r.log.With().Str("method", "DeleteWebhook").Ctx(ctx).Logger()
+
+	if _, err := uuid.Parse(webhookID); err != nil {
+		return utils.ErrWebhookNotFound
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, webhookID)
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	} else if n == 0 {
+		return utils.ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// EnqueueWebhookDeliveries creates a pending delivery of the event for every
+// webhook subscribed to it. Enqueueing the same event twice is a no-op, so the
+// outbox can redeliver events safely.
+func (r *postgresRepository) EnqueueWebhookDeliveries(ctx context.Context, event models.Event) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.EnqueueWebhookDeliveries")
+	defer span.End()
+
+	log := r.log.With().Str("method", "EnqueueWebhookDeliveries").Ctx(ctx).Logger()
+
+	webhooks, err := r.ListWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := webhookPayload(event)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW(), NOW())
+		ON CONFLICT (webhook_id, event_id) DO NOTHING
+	`
+	for _, webhook := range webhooks {
+		if !webhook.Events.Matches(event.Type) {
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, query, uuid.New(), webhook.ID, event.ID, event.Type, payload, models.WebhookDeliveryPending)
+		if err != nil {
+			return r.mapDatabaseError(err, &log)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return r.mapDatabaseError(err, &log)
+	}
+
+	return nil
+}
+
+// ClaimWebhookDeliveries returns up to limit due deliveries and pushes their
+// next attempt back by lease, so other workers skip them meanwhile.
+func (r *postgresRepository) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.ClaimWebhookDeliveries")
+	defer span.End()
+
+	log := r.log.With().Str("method", "ClaimWebhookDeliveries").Ctx(ctx).Logger()
+
+	query := `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = NOW() + $1 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status IN ($2, $3) AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`
+
+	deliveries := []models.WebhookDelivery{}
+	err := r.db.SelectContext(
+		ctx, &deliveries, query, lease.Milliseconds(),
+		models.WebhookDeliveryPending, models.WebhookDeliveryFailed, limit,
+	)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery records the outcome of a delivery attempt.
+func (r *postgresRepository) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	ctx, span := tracing.Start(ctx, "postgresRepository.UpdateWebhookDelivery")
+	defer span.End()
+
+	log := r.log.With().Str("method", "UpdateWebhookDelivery").Ctx(ctx).Logger()
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, next_attempt_at = $3, last_status_code = $4,
+			last_error = $5, delivered_at = $6, updated_at = NOW()
+		WHERE id = $7
+		RETURNING updated_at
+	`
+	err := r.db.
+		QueryRowContext(
+			ctx, query, delivery.Status, delivery.Attempts, delivery.NextAttemptAt,
+			delivery.LastStatusCode, delivery.LastError, delivery.DeliveredAt, delivery.ID,
+		).
+		Scan(&delivery.UpdatedAt)
+	if err != nil {
+		return notFoundAs(r.mapDatabaseError(err, &log), utils.ErrWebhookDeliveryNotFound)
+	}
+
+	return nil
+}
+
+// ListWebhookDeliveries returns the latest deliveries of the webhook, newest
+// first.
+func (r *postgresRepository) ListWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.ListWebhookDeliveries")
+	defer span.End()
+
+	log := r.log.With().Str("method", "ListWebhookDeliveries").Ctx(ctx).Logger()
+
+	if _, err := uuid.Parse(webhookID); err != nil {
+		return nil, utils.ErrWebhookNotFound
+	}
+
+	query := `SELECT * FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`
+
+	deliveries := []models.WebhookDelivery{}
+	err := r.db.SelectContext(ctx, &deliveries, query, webhookID, limit)
+	if err != nil {
+		return nil, r.mapDatabaseError(err, &log)
+	}
+
+	return deliveries, nil
+}
+
+// RedeliverWebhookDelivery queues the delivery again with a fresh set of
+// attempts, whatever its current status.
+func (r *postgresRepository) RedeliverWebhookDelivery(ctx context.Context, webhookID string, deliveryID string) (*models.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "postgresRepository.RedeliverWebhookDelivery")
+	defer span.End()
+
+	log := r.log.With().Str("method", "RedeliverWebhookDelivery").Ctx(ctx).Logger()
+
+	if _, err := uuid.Parse(webhookID); err != nil {
+		return nil, utils.ErrWebhookDeliveryNotFound
+	}
+	if _, err := uuid.Parse(deliveryID); err != nil {
+		return nil, utils.ErrWebhookDeliveryNotFound
+	}
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = 0, next_attempt_at = NOW(), updated_at = NOW()
+		WHERE id = $2 AND webhook_id = $3
+		RETURNING *
+	`
+
+	var delivery models.WebhookDelivery
+	err := r.db.GetContext(ctx, &delivery, query, models.WebhookDeliveryPending, deliveryID, webhookID)
+	if err != nil {
+		return nil, notFoundAs(r.mapDatabaseError(err, &log), utils.ErrWebhookDeliveryNotFound)
+	}
+
+	return &delivery, nil
+}
+
+// webhookPayload is the body sent to webhooks, the event as it's written to
+// the other sinks.
+func webhookPayload(event models.Event) (models.RawJSON, error) {
+	return json.Marshal(event)
+}
@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/XSAM/otelsql"
+	"github.com/rovilay/auth-service/config"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// OpenDB opens a database whose queries are traced as child spans of the
+// span in the query's context. Like Start it skips queries without a parent
+// span, e.g. migrations and background polling.
+func OpenDB(driverName, dsn string) (*sql.DB, error) {
+	var attrs []attribute.KeyValue
+	switch driverName {
+	case config.DriverPostgres:
+		attrs = append(attrs, semconv.DBSystemPostgreSQL)
+	case config.DriverSQLite:
+		attrs = append(attrs, semconv.DBSystemSqlite)
+	}
+
+	return otelsql.Open(driverName, dsn,
+		otelsql.WithAttributes(attrs...),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+				return HasParent(ctx)
+			},
+		}),
+	)
+}
@@ -10,3 +10,31 @@ var ErrTokenGeneration = errors.New("error generating token")
 var ErrMissingAuthToken = errors.New("missing authorization token")
 var ErrUserUnAuthorized = errors.New("user is Unauthorized")
 var ErrSomethingWentWrong = errors.New("something went wrong")
+var ErrForbidden = errors.New("insufficient permissions")
+var ErrOrganizationNotFound = errors.New("organization not found")
+var ErrInvitationNotFound = errors.New("invitation not found")
+var ErrDuplicateInvitation = errors.New("a pending invitation already exists for this email")
+var ErrInvalidInvitation = errors.New("invitation is invalid or has expired")
+var ErrInvitationRequired = errors.New("signup requires a valid invitation")
+var ErrAccessTokenNotFound = errors.New("access token not found")
+var ErrInvalidAccessToken = errors.New("access token is invalid, expired or revoked")
+var ErrInsufficientScope = errors.New("access token lacks the required scope")
+var ErrInvalidSession = errors.New("session is invalid or expired")
+var ErrInvalidCSRFToken = errors.New("missing or invalid CSRF token")
+var ErrServiceAccountNotFound = errors.New("service account not found")
+var ErrInvalidClientCredentials = errors.New("invalid client credentials")
+var ErrUnsupportedGrantType = errors.New("unsupported grant type")
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+var ErrVersionConflict = errors.New("user was modified concurrently")
+var ErrPreconditionFailed = errors.New("resource does not match If-Match precondition")
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+var ErrInvalidMetadata = errors.New("invalid metadata")
+var ErrWebhookNotFound = errors.New("webhook not found")
+var ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+var ErrInvalidEventFilter = errors.New("invalid event filter")
+var ErrInvalidToken = errors.New("token is invalid or expired")
+var ErrInvalidCredentials = errors.New("invalid email or password")
+var ErrInvalidPassword = errors.New("invalid password")
+var ErrRouteNotFound = errors.New("route not found")
+var ErrMethodNotAllowed = errors.New("method not allowed")
+var ErrMalformedBody = errors.New("malformed request body")
@@ -1,13 +1,28 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"context"
+	"time"
+
+	"github.com/rovilay/auth-service/metrics"
+	"github.com/rovilay/auth-service/tracing"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func HashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracing.Start(ctx, "bcrypt.Hash")
+	defer span.End()
+	defer metrics.ObserveBcrypt("hash", time.Now())
 
-func HashPassword(password string) (string, error) {
 	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(hashedBytes), err
 }
 
-func CheckPasswordHash(password, hash string) bool {
+func CheckPasswordHash(ctx context.Context, password, hash string) bool {
+	_, span := tracing.Start(ctx, "bcrypt.Compare")
+	defer span.End()
+	defer metrics.ObserveBcrypt("compare", time.Now())
+
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -9,6 +10,9 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
 	"github.com/rovilay/auth-service/config"
+	"github.com/rovilay/auth-service/metrics"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/tracing"
 )
 
 func ExtractToken(authString string) (string, error) {
@@ -20,17 +24,68 @@ func ExtractToken(authString string) (string, error) {
 	return parts[1], nil
 }
 
-func GenerateJWT(userID uuid.UUID) (string, error) {
+// GenerateJWT issues a token for the user. The metadata keys listed in
+// METADATA_CLAIMS are projected into a metadata claim.
+func GenerateJWT(ctx context.Context, user *models.User) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"user_id":        user.ID,
+		"sub":            user.ID,
+		"principal_type": models.PrincipalUser,
+		"exp":            time.Now().Add(time.Hour * 24).Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.Config.JwtSecret))
+	if metadata := user.Metadata.Claims(config.Config.MetadataClaims); len(metadata) > 0 {
+		claims["metadata"] = metadata
+	}
+
+	return signJWT(ctx, claims, models.PrincipalUser)
+}
+
+// GenerateServiceAccountJWT issues a token for a service account. It carries no
+// user_id claim so it can't be mistaken for a user token.
+func GenerateServiceAccountJWT(ctx context.Context, accountID uuid.UUID, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"sub":            accountID,
+		"principal_type": models.PrincipalServiceAccount,
+		"exp":            time.Now().Add(ttl).Unix(),
+	}
+
+	return signJWT(ctx, claims, models.PrincipalServiceAccount)
 }
 
+func signJWT(ctx context.Context, claims jwt.MapClaims, principalType string) (string, error) {
+	_, span := tracing.Start(ctx, "jwt.Sign")
+	defer span.End()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.Config.JwtSecret))
+	if err != nil {
+		return "", err
+	}
+
+	metrics.TokensIssued.WithLabelValues(principalType).Inc()
+	return token, nil
+}
+
+// ValidateJWT validates a user token and returns the user ID. Service account
+// tokens are rejected, use ParseJWT to accept any principal.
 func ValidateJWT(tokenString string) (string, error) {
+	principal, err := ParseJWT(tokenString)
+	if err != nil {
+		return "", err
+	}
+
+	if !principal.IsUser() {
+		metrics.TokensRejected.WithLabelValues("principal_type").Inc()
+		return "", ErrUserUnAuthorized
+	}
+
+	return principal.ID.String(), nil
+}
+
+// ParseJWT validates the token and returns the principal it was issued for.
+// Tokens without a principal_type claim predate service accounts and belong to
+// users.
+func ParseJWT(tokenString string) (*models.Principal, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -39,13 +94,55 @@ func ValidateJWT(tokenString string) (string, error) {
 	})
 
 	if err != nil {
-		return "", err
+		metrics.TokensRejected.WithLabelValues(rejectionReason(err)).Inc()
+		return nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID := claims["user_id"].(string)
-		return userID, nil
-	} else {
-		return "", err
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		metrics.TokensRejected.WithLabelValues("invalid").Inc()
+		return nil, ErrUserUnAuthorized
+	}
+
+	principalType, _ := claims["principal_type"].(string)
+	if principalType == "" {
+		principalType = models.PrincipalUser
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		subject, _ = claims["user_id"].(string)
+	}
+
+	id, err := uuid.Parse(subject)
+	if err != nil {
+		metrics.TokensRejected.WithLabelValues("invalid_subject").Inc()
+		return nil, ErrUserUnAuthorized
+	}
+
+	return &models.Principal{ID: id, Type: principalType}, nil
+}
+
+// rejectionReason maps a jwt-go parse error to the reason label of the
+// tokens_rejected_total metric.
+func rejectionReason(err error) string {
+	var validationErr *jwt.ValidationError
+	if !errors.As(err, &validationErr) {
+		return "invalid"
+	}
+
+	switch {
+	case validationErr.Errors&jwt.ValidationErrorMalformed != 0:
+		return "malformed"
+	case validationErr.Errors&jwt.ValidationErrorUnverifiable != 0:
+		return "unverifiable"
+	case validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		return "signature_invalid"
+	case validationErr.Errors&jwt.ValidationErrorExpired != 0:
+		return "expired"
+	case validationErr.Errors&(jwt.ValidationErrorNotValidYet|jwt.ValidationErrorIssuedAt) != 0:
+		return "not_valid_yet"
+	default:
+		return "invalid"
 	}
 }
@@ -0,0 +1,23 @@
+package webhooks
+
+import (
+	"context"
+
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/repository"
+)
+
+// Sink is the outbox sink of webhooks. It only queues a delivery per
+// subscribed webhook, the Worker sends them, so a slow receiver doesn't hold
+// up the other sinks.
+type Sink struct {
+	repo repository.WebhookRepository
+}
+
+func NewSink(repo repository.WebhookRepository) *Sink {
+	return &Sink{repo: repo}
+}
+
+func (s *Sink) Deliver(ctx context.Context, event models.Event) error {
+	return s.repo.EnqueueWebhookDeliveries(ctx, event)
+}
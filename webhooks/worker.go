@@ -0,0 +1,188 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/repository"
+	"github.com/rs/zerolog"
+)
+
+const (
+	batchSize = 50
+	// firstRetryDelay doubles with every failed attempt up to maxRetryDelay.
+	firstRetryDelay = 30 * time.Second
+	maxRetryDelay   = 12 * time.Hour
+)
+
+// Worker sends the queued webhook deliveries. Failed deliveries are retried
+// with exponential backoff until maxAttempts is reached, then they are dead
+// and only sent again when redelivered through the admin API.
+type Worker struct {
+	repo        repository.WebhookRepository
+	client      *http.Client
+	interval    time.Duration
+	maxAttempts int
+	log         *zerolog.Logger
+}
+
+func NewWorker(repo repository.WebhookRepository, interval, timeout time.Duration, maxAttempts int, log *zerolog.Logger) *Worker {
+	logger := log.With().Str("webhooks", "Worker").Logger()
+
+	return &Worker{
+		repo:        repo,
+		client:      &http.Client{Timeout: timeout},
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		log:         &logger,
+	}
+}
+
+// Run sends deliveries until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := w.work(ctx)
+		if err != nil && ctx.Err() == nil {
+			w.log.Err(err).Msg("failed to send webhook deliveries")
+		}
+
+		if n == batchSize && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) work(ctx context.Context) (int, error) {
+	// the lease covers a whole batch of requests timing out
+	lease := w.client.Timeout*batchSize + time.Minute
+
+	deliveries, err := w.repo.ClaimWebhookDeliveries(ctx, batchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	webhooks := map[string]*models.Webhook{}
+	for i := range deliveries {
+		delivery := &deliveries[i]
+
+		webhook, ok := webhooks[delivery.WebhookID.String()]
+		if !ok {
+			webhook, err = w.repo.GetWebhook(ctx, delivery.WebhookID.String())
+			if err != nil {
+				return len(deliveries), err
+			}
+			webhooks[delivery.WebhookID.String()] = webhook
+		}
+
+		w.attempt(ctx, webhook, delivery)
+
+		if err = w.repo.UpdateWebhookDelivery(ctx, delivery); err != nil {
+			return len(deliveries), err
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+// attempt sends the delivery once and records the outcome on it.
+func (w *Worker) attempt(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) {
+	log := w.log.With().
+		Str("webhook_id", webhook.ID.String()).
+		Str("delivery_id", delivery.ID.String()).
+		Str("event_type", delivery.EventType).
+		Logger()
+
+	delivery.Attempts++
+	statusCode, err := w.send(ctx, webhook, delivery)
+	now := time.Now()
+
+	delivery.LastStatusCode = nil
+	if statusCode != 0 {
+		delivery.LastStatusCode = &statusCode
+	}
+
+	if err == nil {
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+		delivery.LastError = nil
+		return
+	}
+
+	reason := err.Error()
+	delivery.LastError = &reason
+
+	if delivery.Attempts >= w.maxAttempts {
+		delivery.Status = models.WebhookDeliveryDead
+		delivery.NextAttemptAt = nil
+		log.Warn().Err(err).Int("attempts", delivery.Attempts).Msg("webhook delivery is dead")
+		return
+	}
+
+	retryAt := now.Add(retryDelay(delivery.Attempts))
+	delivery.Status = models.WebhookDeliveryFailed
+	delivery.NextAttemptAt = &retryAt
+	log.Info().Err(err).Int("attempts", delivery.Attempts).Time("retry_at", retryAt).Msg("webhook delivery failed")
+}
+
+func (w *Worker) send(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	id := delivery.EventID.String()
+	timestamp := time.Now()
+	signature, err := Sign(webhook.Secret, id, timestamp, delivery.Payload)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "auth-service-webhooks")
+	req.Header.Set(HeaderID, id)
+	req.Header.Set(HeaderTimestamp, fmt.Sprint(timestamp.Unix()))
+	req.Header.Set(HeaderSignature, signature)
+	req.Header.Set(HeaderEvent, delivery.EventType)
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected response status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+func retryDelay(attempts int) time.Duration {
+	if attempts > 16 {
+		return maxRetryDelay
+	}
+
+	delay := firstRetryDelay << (attempts - 1)
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,234 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovilay/auth-service/models"
+	"github.com/rovilay/auth-service/repository"
+	"github.com/rs/zerolog"
+)
+
+// deliveryRepository keeps one webhook and its deliveries in memory. Claims
+// ignore next_attempt_at, so every work call is a retry.
+type deliveryRepository struct {
+	repository.WebhookRepository
+	webhook    *models.Webhook
+	deliveries []*models.WebhookDelivery
+}
+
+func (r *deliveryRepository) GetWebhook(ctx context.Context, webhookID string) (*models.Webhook, error) {
+	return r.webhook, nil
+}
+
+func (r *deliveryRepository) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	var claimed []models.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.Status == models.WebhookDeliveryPending || delivery.Status == models.WebhookDeliveryFailed {
+			claimed = append(claimed, *delivery)
+		}
+	}
+	return claimed, nil
+}
+
+func (r *deliveryRepository) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	for i := range r.deliveries {
+		if r.deliveries[i].ID == delivery.ID {
+			updated := *delivery
+			r.deliveries[i] = &updated
+		}
+	}
+	return nil
+}
+
+// receiver answers webhook requests with the given statuses in turn, the last
+// one repeats, and records the requests.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rec := &receiver{statuses: statuses}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.requests = append(rec.requests, r)
+		rec.bodies = append(rec.bodies, body)
+
+		status := rec.statuses[0]
+		if len(rec.statuses) > 1 {
+			rec.statuses = rec.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rec.Close)
+	return rec
+}
+
+func newTestWorker(t *testing.T, url string, maxAttempts int) (*Worker, *deliveryRepository) {
+	t.Helper()
+
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret: %v", err)
+	}
+
+	webhook := &models.Webhook{ID: uuid.New(), URL: url, Secret: secret, Events: models.EventFilter{"user.*"}}
+	repo := &deliveryRepository{
+		webhook: webhook,
+		deliveries: []*models.WebhookDelivery{{
+			ID:        uuid.New(),
+			WebhookID: webhook.ID,
+			EventID:   uuid.New(),
+			EventType: "user.created",
+			Payload:   models.RawJSON(`{"type":"user.created"}`),
+			Status:    models.WebhookDeliveryPending,
+		}},
+	}
+
+	logger := zerolog.Nop()
+	return NewWorker(repo, time.Second, 5*time.Second, maxAttempts, &logger), repo
+}
+
+func TestWorkerSignsRequests(t *testing.T) {
+	rec := newReceiver(t, http.StatusNoContent)
+	w, repo := newTestWorker(t, rec.URL, 3)
+
+	if _, err := w.work(context.Background()); err != nil {
+		t.Fatalf("work: %v", err)
+	}
+	if len(rec.requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(rec.requests))
+	}
+
+	req, body := rec.requests[0], rec.bodies[0]
+	delivery := repo.deliveries[0]
+	if id := req.Header.Get(HeaderID); id != delivery.EventID.String() {
+		t.Errorf("%s = %q, want the event ID", HeaderID, id)
+	}
+	if event := req.Header.Get(HeaderEvent); event != "user.created" {
+		t.Errorf("%s = %q, want user.created", HeaderEvent, event)
+	}
+	if string(body) != string(delivery.Payload) {
+		t.Errorf("body = %s, want the payload", body)
+	}
+
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("%s: %v", HeaderTimestamp, err)
+	}
+	if since := time.Since(time.Unix(timestamp, 0)); since < 0 || since > time.Minute {
+		t.Errorf("%s is %s off", HeaderTimestamp, since)
+	}
+
+	// the signature is checked without Sign or Verify, the way a receiver
+	// following Standard Webhooks would
+	key, err := base64.StdEncoding.DecodeString(repo.webhook.Secret[len(models.WebhookSecretPrefix):])
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(req.Header.Get(HeaderID) + "." + req.Header.Get(HeaderTimestamp) + "."))
+	h.Write(body)
+	if want := "v1," + base64.StdEncoding.EncodeToString(h.Sum(nil)); req.Header.Get(HeaderSignature) != want {
+		t.Errorf("%s = %q, want %q", HeaderSignature, req.Header.Get(HeaderSignature), want)
+	}
+	if err := Verify(repo.webhook.Secret, req.Header, body, time.Minute); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	if delivery.Status != models.WebhookDeliverySucceeded || delivery.DeliveredAt == nil || delivery.NextAttemptAt != nil {
+		t.Errorf("unexpected delivery %+v", delivery)
+	}
+}
+
+func TestWorkerRetriesWithBackoff(t *testing.T) {
+	rec := newReceiver(t, http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusOK)
+	w, repo := newTestWorker(t, rec.URL, 5)
+
+	for attempt, wantDelay := range []time.Duration{firstRetryDelay, 2 * firstRetryDelay} {
+		before := time.Now()
+		if _, err := w.work(context.Background()); err != nil {
+			t.Fatalf("work: %v", err)
+		}
+
+		delivery := repo.deliveries[0]
+		if delivery.Status != models.WebhookDeliveryFailed || delivery.Attempts != attempt+1 {
+			t.Fatalf("attempt %d: status %s after %d attempts", attempt+1, delivery.Status, delivery.Attempts)
+		}
+		if delivery.LastStatusCode == nil || *delivery.LastStatusCode < 500 || delivery.LastError == nil {
+			t.Errorf("attempt %d: expected the 5xx to be recorded, got %+v", attempt+1, delivery)
+		}
+		if delivery.NextAttemptAt == nil {
+			t.Fatalf("attempt %d: expected a retry to be scheduled", attempt+1)
+		}
+		if delay := delivery.NextAttemptAt.Sub(before); delay < wantDelay || delay > wantDelay+time.Minute {
+			t.Errorf("attempt %d: retry in %s, want %s", attempt+1, delay, wantDelay)
+		}
+	}
+
+	if _, err := w.work(context.Background()); err != nil {
+		t.Fatalf("work: %v", err)
+	}
+	delivery := repo.deliveries[0]
+	if delivery.Status != models.WebhookDeliverySucceeded || delivery.Attempts != 3 || delivery.LastError != nil {
+		t.Errorf("unexpected delivery %+v", delivery)
+	}
+	if len(rec.requests) != 3 {
+		t.Errorf("got %d requests, want 3", len(rec.requests))
+	}
+}
+
+func TestWorkerMarksDeliveryDead(t *testing.T) {
+	rec := newReceiver(t, http.StatusBadGateway)
+	w, repo := newTestWorker(t, rec.URL, 3)
+
+	for range 5 {
+		if _, err := w.work(context.Background()); err != nil {
+			t.Fatalf("work: %v", err)
+		}
+	}
+
+	delivery := repo.deliveries[0]
+	if delivery.Status != models.WebhookDeliveryDead || delivery.Attempts != 3 || delivery.NextAttemptAt != nil {
+		t.Errorf("unexpected delivery %+v", delivery)
+	}
+	if len(rec.requests) != 3 {
+		t.Errorf("got %d requests, want 3, dead deliveries aren't claimed again", len(rec.requests))
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 5, want: 8 * time.Minute},
+		{attempts: 12, want: maxRetryDelay},
+		{attempts: 100, want: maxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}